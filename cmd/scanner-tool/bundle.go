@@ -0,0 +1,293 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/schidstorm/scanner-tool/pkg/encryption"
+	"github.com/schidstorm/scanner-tool/pkg/filequeue"
+	queueoutputcreator "github.com/schidstorm/scanner-tool/pkg/queue_output_creator"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+func bundleCommand() *cobra.Command {
+	bundleCmd := &cobra.Command{
+		Use:   "bundle",
+		Short: "Inspect and repair bundles",
+		Long: "Inspect and repair bundles. Encrypted bundles need --config for the key. " +
+			"Repaired bundles can be put back into a queue with archive reinject.",
+	}
+	bundleCmd.PersistentFlags().String("config", "", "Path to the configuration file, needed for encrypted bundles")
+
+	inspectCmd := &cobra.Command{
+		Use:   "inspect <bundle>",
+		Short: "Show files, page order and metadata of a bundle",
+		Args:  cobra.ExactArgs(1),
+		Run:   helpInterceptor(bundleInspect),
+	}
+	inspectCmd.Flags().Bool("json", false, "Print the manifest as JSON")
+
+	extractCmd := &cobra.Command{
+		Use:   "extract <bundle> <dir>",
+		Short: "Extract the files and the manifest of a bundle into a directory",
+		Args:  cobra.ExactArgs(2),
+		Run:   helpInterceptor(bundleExtract),
+	}
+
+	packCmd := &cobra.Command{
+		Use:   "pack <dir> <bundle>",
+		Short: "Pack a directory, e.g. from extract, into a bundle",
+		Args:  cobra.ExactArgs(2),
+		Run:   helpInterceptor(bundlePack),
+	}
+	packCmd.Flags().String("format", "zip", "Bundle format, zip or dir")
+
+	editMetaCmd := &cobra.Command{
+		Use:   "edit-meta <bundle>",
+		Short: "Change metadata of a bundle in place",
+		Args:  cobra.ExactArgs(1),
+		Run:   helpInterceptor(bundleEditMeta),
+	}
+	editMetaCmd.Flags().StringArray("set", nil, "Metadata to set as key=value, an empty value removes it")
+	editMetaCmd.Flags().String("file", "", "Change the metadata of this file instead of the bundle")
+
+	bundleCmd.AddCommand(inspectCmd, extractCmd, packCmd, editMetaCmd)
+	return bundleCmd
+}
+
+func cipherFromConfigFlag(cmd *cobra.Command) (*encryption.Cipher, error) {
+	configPath, _ := cmd.Flags().GetString("config")
+	if configPath == "" {
+		return nil, nil
+	}
+
+	opts, err := parseConfig(configPath)
+	if err != nil {
+		return nil, err
+	}
+
+	return encryption.NewCipherFromOptions(opts.Encryption)
+}
+
+func openBundleFromArgs(cmd *cobra.Command, bundlePath string) (queueoutputcreator.QueueZipFileReader, io.Closer, error) {
+	cipher, err := cipherFromConfigFlag(cmd)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return queueoutputcreator.OpenBundle(bundlePath, cipher)
+}
+
+func bundleInspect(cmd *cobra.Command, args []string) {
+	reader, closer, err := openBundleFromArgs(cmd, args[0])
+	if err != nil {
+		logrus.WithError(err).Error("Failed to open bundle")
+		return
+	}
+	defer closer.Close()
+
+	manifest := reader.Manifest()
+	if asJson, _ := cmd.Flags().GetBool("json"); asJson {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(manifest)
+		return
+	}
+
+	fmt.Printf("id:      %s\n", manifest.ID)
+	fmt.Printf("created: %s\n", manifest.CreatedAt.Format(time.RFC3339))
+	if manifest.Source.Device != "" || manifest.Source.Profile != "" {
+		fmt.Printf("source:  %s %s\n", manifest.Source.Device, manifest.Source.Profile)
+	}
+	if metadata := formatMetadata(manifest.Properties.ToMap()); metadata != "" {
+		fmt.Printf("meta:    %s\n", metadata)
+	}
+	for _, record := range manifest.History {
+		fmt.Printf("stage:   %s %s (%s)\n", record.Stage, record.StartedAt.Format(time.RFC3339), record.FinishedAt.Sub(record.StartedAt))
+	}
+
+	fmt.Println()
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "PAGE\tKIND\tSIZE\tSHA256\tNAME\tMETADATA")
+	for _, file := range manifest.Files {
+		page := "-"
+		if file.Page > 0 {
+			page = fmt.Sprint(file.Page)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%d\t%.12s\t%s\t%s\n", page, file.Kind, file.Size, file.SHA256, file.Name, formatMetadata(file.ToMap()))
+	}
+	w.Flush()
+}
+
+func formatMetadata(metadata map[string]string) string {
+	keys := make([]string, 0, len(metadata))
+	for key := range metadata {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var parts []string
+	for _, key := range keys {
+		parts = append(parts, fmt.Sprintf("%s=%q", key, metadata[key]))
+	}
+	return strings.Join(parts, " ")
+}
+
+func bundleExtract(cmd *cobra.Command, args []string) {
+	reader, closer, err := openBundleFromArgs(cmd, args[0])
+	if err != nil {
+		logrus.WithError(err).Error("Failed to open bundle")
+		return
+	}
+	defer closer.Close()
+
+	err = queueoutputcreator.ExtractBundle(reader, args[1])
+	if err != nil {
+		logrus.WithError(err).Error("Failed to extract bundle")
+		return
+	}
+
+	logrus.WithField("dir", args[1]).Info("Extracted bundle")
+}
+
+func newBundleWriter(format string, cipher *encryption.Cipher) (queueoutputcreator.QueueZipFileWriter, error) {
+	switch format {
+	case "zip":
+		return queueoutputcreator.CreateEncryptedZipFileWriter(cipher), nil
+	case "dir":
+		return queueoutputcreator.CreateDirWriter(cipher), nil
+	default:
+		return nil, fmt.Errorf("unknown bundle format %q", format)
+	}
+}
+
+func bundlePack(cmd *cobra.Command, args []string) {
+	cipher, err := cipherFromConfigFlag(cmd)
+	if err != nil {
+		logrus.WithError(err).Error("Failed to load encryption key")
+		return
+	}
+
+	format, _ := cmd.Flags().GetString("format")
+	writer, err := newBundleWriter(format, cipher)
+	if err != nil {
+		logrus.WithError(err).Error("Failed to create bundle")
+		return
+	}
+
+	err = queueoutputcreator.PackBundle(args[0], writer)
+	if err != nil {
+		logrus.WithError(err).Error("Failed to pack bundle")
+		writer.Discard()
+		return
+	}
+
+	bundlePath, err := writer.Finalize()
+	if err != nil {
+		logrus.WithError(err).Error("Failed to pack bundle")
+		return
+	}
+
+	err = filequeue.MoveBundle(bundlePath, args[1])
+	if err != nil {
+		os.RemoveAll(bundlePath)
+		logrus.WithError(err).Error("Failed to write bundle")
+		return
+	}
+
+	logrus.WithField("bundle", args[1]).Info("Packed bundle")
+}
+
+func bundleEditMeta(cmd *cobra.Command, args []string) {
+	bundlePath := args[0]
+	cipher, err := cipherFromConfigFlag(cmd)
+	if err != nil {
+		logrus.WithError(err).Error("Failed to load encryption key")
+		return
+	}
+
+	reader, closer, err := queueoutputcreator.OpenBundle(bundlePath, cipher)
+	if err != nil {
+		logrus.WithError(err).Error("Failed to open bundle")
+		return
+	}
+
+	format := "zip"
+	if info, err := os.Stat(bundlePath); err == nil && info.IsDir() {
+		format = "dir"
+	}
+	writer, _ := newBundleWriter(format, cipher)
+	err = queueoutputcreator.CopyBundle(reader, writer)
+	closer.Close()
+	if err == nil {
+		err = applyMetadataEdits(cmd, writer.Manifest())
+	}
+	if err != nil {
+		logrus.WithError(err).Error("Failed to edit bundle")
+		writer.Discard()
+		return
+	}
+
+	newPath, err := writer.Finalize()
+	if err != nil {
+		logrus.WithError(err).Error("Failed to edit bundle")
+		return
+	}
+
+	err = replaceBundle(bundlePath, newPath)
+	if err != nil {
+		logrus.WithError(err).Error("Failed to replace bundle")
+		return
+	}
+
+	logrus.WithField("bundle", bundlePath).Info("Updated bundle metadata")
+}
+
+func applyMetadataEdits(cmd *cobra.Command, manifest *queueoutputcreator.Manifest) error {
+	properties := &manifest.Properties
+	if fileName, _ := cmd.Flags().GetString("file"); fileName != "" {
+		file := manifest.File(fileName)
+		if file == nil {
+			return fmt.Errorf("bundle has no file %s", fileName)
+		}
+		properties = &file.Properties
+	}
+
+	edits, _ := cmd.Flags().GetStringArray("set")
+	for _, edit := range edits {
+		key, value, ok := strings.Cut(edit, "=")
+		if !ok || key == "" {
+			return fmt.Errorf("invalid metadata %q, expected key=value", edit)
+		}
+		properties.SetMetadata(key, value)
+	}
+
+	return manifest.Validate()
+}
+
+// replaceBundle swaps in the new bundle and keeps the old one until that
+// succeeded.
+func replaceBundle(bundlePath, newPath string) error {
+	backupPath := bundlePath + ".bak"
+	err := os.Rename(bundlePath, backupPath)
+	if err != nil {
+		os.RemoveAll(newPath)
+		return err
+	}
+
+	err = filequeue.MoveBundle(newPath, bundlePath)
+	if err != nil {
+		os.RemoveAll(newPath)
+		os.Rename(backupPath, bundlePath)
+		return err
+	}
+
+	return os.RemoveAll(backupPath)
+}
@@ -6,7 +6,9 @@ import (
 	"os"
 	"os/signal"
 	"path"
+	"time"
 
+	"github.com/schidstorm/scanner-tool/pkg/filequeue"
 	"github.com/schidstorm/scanner-tool/pkg/server"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
@@ -37,6 +39,34 @@ func main() {
 
 	cmd.AddCommand(emptyConfigCmd)
 
+	archiveCmd := &cobra.Command{
+		Use:   "archive",
+		Short: "Manage archived bundles",
+	}
+
+	archiveListCmd := &cobra.Command{
+		Use:   "list",
+		Short: "List archived bundles",
+		Run:   helpInterceptor(archiveList),
+	}
+	archiveListCmd.Flags().String("config", "", "Path to the configuration file")
+	archiveListCmd.MarkFlagRequired("config")
+
+	archiveReinjectCmd := &cobra.Command{
+		Use:   "reinject <bundle>",
+		Short: "Feed an archived bundle into a pipeline stage",
+		Args:  cobra.ExactArgs(1),
+		Run:   helpInterceptor(archiveReinject),
+	}
+	archiveReinjectCmd.Flags().String("config", "", "Path to the configuration file")
+	archiveReinjectCmd.MarkFlagRequired("config")
+	archiveReinjectCmd.Flags().String("stage", "", "Name of the stage to feed the bundle to, e.g. TesseractHandler")
+	archiveReinjectCmd.MarkFlagRequired("stage")
+
+	archiveCmd.AddCommand(archiveListCmd, archiveReinjectCmd)
+	cmd.AddCommand(archiveCmd)
+	cmd.AddCommand(bundleCommand())
+
 	err := cmd.Execute()
 	if err != nil {
 		logrus.WithError(err).Error("Failed to execute command")
@@ -80,7 +110,11 @@ func startServer(cmd *cobra.Command, args []string) {
 		return
 	}
 
-	s := server.NewServer(opts)
+	s, err := server.NewServer(opts)
+	if err != nil {
+		logrus.WithError(err).Error("Failed to create server")
+		return
+	}
 
 	s.Start()
 
@@ -92,6 +126,73 @@ func startServer(cmd *cobra.Command, args []string) {
 	s.Stop()
 }
 
+// archiveOptions reads the queue options. The archive lives in the fs queue
+// directory, no server is needed to use it.
+func archiveOptions(cmd *cobra.Command) (server.QueueOptions, error) {
+	configPath, _ := cmd.Flags().GetString("config")
+	opts, err := parseConfig(configPath)
+	if err != nil {
+		return server.QueueOptions{}, err
+	}
+	if opts.QueueOptions.Backend == "nats" {
+		return server.QueueOptions{}, fmt.Errorf("the nats queue backend has no archive")
+	}
+
+	return opts.QueueOptions, nil
+}
+
+func archiveList(cmd *cobra.Command, args []string) {
+	opts, err := archiveOptions(cmd)
+	if err != nil {
+		logrus.WithError(err).Error("Failed to read config")
+		return
+	}
+
+	queueNames, err := filequeue.ListArchivedQueues()
+	if err != nil {
+		logrus.WithError(err).Error("Failed to list archive")
+		return
+	}
+
+	for _, queueName := range queueNames {
+		err = filequeue.NewFsQueue(queueName).WithArchive(opts.Archive[queueName]).PruneArchive()
+		if err != nil {
+			logrus.WithError(err).WithField("queue", queueName).Error("Failed to prune archive")
+			return
+		}
+
+		bundles, err := filequeue.ListArchive(queueName)
+		if err != nil {
+			logrus.WithError(err).WithField("queue", queueName).Error("Failed to list archive")
+			return
+		}
+		for _, bundle := range bundles {
+			fmt.Printf("%s\t%s\t%d\t%s\n", bundle.Queue, bundle.ArchivedAt.Format(time.RFC3339), bundle.Size, bundle.Path)
+		}
+	}
+}
+
+func archiveReinject(cmd *cobra.Command, args []string) {
+	_, err := archiveOptions(cmd)
+	if err != nil {
+		logrus.WithError(err).Error("Failed to read config")
+		return
+	}
+
+	stage, _ := cmd.Flags().GetString("stage")
+	queueName, err := server.InputQueueName(stage)
+	if err == nil {
+		// archived bundles are kept as queued, encrypted ones stay encrypted
+		err = filequeue.Reinject(args[0], filequeue.NewFsQueue(queueName))
+	}
+	if err != nil {
+		logrus.WithError(err).WithField("stages", server.Stages).Error("Failed to reinject bundle")
+		return
+	}
+
+	logrus.WithField("stage", stage).Info("Reinjected bundle")
+}
+
 func parseConfig(p string) (server.Options, error) {
 	var opts server.Options
 	fileContent, err := os.ReadFile(p)
@@ -61,7 +61,7 @@ func (g *ChatGPTFileNameGuesser) guess(text string) (string, error) {
 		return "", errors.New("no filename found in response")
 	}
 
-	fileName := match[2]
+	fileName := sanitizeFileName(match[2])
 	if len(fileName) > 255 {
 		return "", errors.New("filename is too long")
 	}
@@ -78,3 +78,10 @@ func (g *ChatGPTFileNameGuesser) guess(text string) (string, error) {
 
 	return fileName, nil
 }
+
+// sanitizeFileName makes a guessed name usable as a bundle file name, e.g.
+// "2024/05/01_Rechnung.pdf" becomes "2024-05-01_Rechnung.pdf".
+func sanitizeFileName(fileName string) string {
+	fileName = strings.NewReplacer("/", "-", "\\", "-").Replace(fileName)
+	return strings.TrimLeft(fileName, ".")
+}
@@ -0,0 +1,34 @@
+package ai
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGuessSanitizesFileName(t *testing.T) {
+	for answer, expected := range map[string]string{
+		"'2024/05/01_Rechnung.pdf'":  "2024-05-01_Rechnung.pdf",
+		`"..\Vertrag_Miete.pdf"`:     "-Vertrag_Miete.pdf",
+		"'.2024-05-01_Rechnung.txt'": "2024-05-01_Rechnung.pdf",
+	} {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			json.NewEncoder(w).Encode(map[string]any{
+				"status": "completed",
+				"output": []any{map[string]any{"content": []any{map[string]any{"type": "output_text", "text": answer}}}},
+			})
+		}))
+		oldUrl := chatGptUrl
+		chatGptUrl = server.URL
+
+		fileName, err := NewChatGPTFileNameGuesser(NewChatGPTClient("key")).Guess("text")
+		assert.NoError(t, err)
+		assert.Equal(t, expected, fileName)
+
+		chatGptUrl = oldUrl
+		server.Close()
+	}
+}
@@ -0,0 +1,364 @@
+package encryption
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Encrypted files start with magic followed by a random nonce prefix. The
+// payload is split into chunks of chunkSize plaintext bytes which are sealed
+// individually, so files can be streamed and read at random offsets.
+var magic = []byte("STENC01\n")
+
+const (
+	keySize         = 32
+	noncePrefixSize = 8
+	headerSize      = 8 + noncePrefixSize
+	chunkSize       = 64 * 1024
+	tagSize         = 16
+	sealedChunkSize = chunkSize + tagSize
+)
+
+var ErrNoKey = errors.New("no encryption key configured")
+var ErrNotEncrypted = errors.New("data is not encrypted")
+var ErrCorrupted = errors.New("encrypted data is corrupted")
+
+type Options struct {
+	// KeyFile points to a file holding a 32 byte key, either raw, hex or
+	// base64 encoded.
+	KeyFile string `yaml:"keyfile"`
+	// Credential is the name of a systemd credential (LoadCredential=)
+	// holding the key. It is looked up in $CREDENTIALS_DIRECTORY.
+	Credential string `yaml:"credential"`
+}
+
+type Cipher struct {
+	aead cipher.AEAD
+}
+
+// NewCipherFromOptions loads the configured key. It returns nil without an
+// error when encryption is not configured.
+func NewCipherFromOptions(opts Options) (*Cipher, error) {
+	keyPath := opts.KeyFile
+	if opts.Credential != "" {
+		credentialsDir := os.Getenv("CREDENTIALS_DIRECTORY")
+		if credentialsDir == "" {
+			return nil, fmt.Errorf("credential %s requested but CREDENTIALS_DIRECTORY is not set", opts.Credential)
+		}
+		keyPath = filepath.Join(credentialsDir, opts.Credential)
+	}
+
+	if keyPath == "" {
+		return nil, nil
+	}
+
+	key, err := LoadKey(keyPath)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewCipher(key)
+}
+
+func LoadKey(p string) ([]byte, error) {
+	data, err := os.ReadFile(p)
+	if err != nil {
+		return nil, err
+	}
+
+	return parseKey(data)
+}
+
+func parseKey(data []byte) ([]byte, error) {
+	if len(data) == keySize {
+		return data, nil
+	}
+
+	text := strings.TrimSpace(string(data))
+	if key, err := hex.DecodeString(text); err == nil && len(key) == keySize {
+		return key, nil
+	}
+	if key, err := base64.StdEncoding.DecodeString(text); err == nil && len(key) == keySize {
+		return key, nil
+	}
+
+	return nil, fmt.Errorf("key must be %d bytes, raw, hex or base64 encoded", keySize)
+}
+
+func NewCipher(key []byte) (*Cipher, error) {
+	if len(key) != keySize {
+		return nil, fmt.Errorf("key must be %d bytes", keySize)
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Cipher{aead: aead}, nil
+}
+
+// IsEncrypted reports whether r starts with the encryption header.
+func IsEncrypted(r io.ReaderAt) bool {
+	header := make([]byte, len(magic))
+	n, _ := r.ReadAt(header, 0)
+	return n == len(magic) && bytes.Equal(header, magic)
+}
+
+func (c *Cipher) nonce(prefix []byte, index uint64) []byte {
+	nonce := make([]byte, c.aead.NonceSize())
+	copy(nonce, prefix)
+	binary.BigEndian.PutUint32(nonce[noncePrefixSize:], uint32(index))
+	return nonce
+}
+
+// additionalData binds the chunk position and the final chunk marker, so
+// chunks can neither be reordered nor truncated unnoticed.
+func additionalData(index uint64, last bool) []byte {
+	ad := make([]byte, 9)
+	binary.BigEndian.PutUint64(ad, index)
+	if last {
+		ad[8] = 1
+	}
+	return ad
+}
+
+type Writer struct {
+	cipher *Cipher
+	w      io.Writer
+	prefix []byte
+	buf    []byte
+	index  uint64
+	err    error
+}
+
+// NewWriter returns a writer encrypting everything written to w. Close must
+// be called to write the final chunk; it does not close w.
+func (c *Cipher) NewWriter(w io.Writer) (*Writer, error) {
+	prefix := make([]byte, noncePrefixSize)
+	_, err := rand.Read(prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = w.Write(append(append([]byte{}, magic...), prefix...))
+	if err != nil {
+		return nil, err
+	}
+
+	return &Writer{
+		cipher: c,
+		w:      w,
+		prefix: prefix,
+		buf:    make([]byte, 0, chunkSize),
+	}, nil
+}
+
+func (w *Writer) Write(p []byte) (int, error) {
+	if w.err != nil {
+		return 0, w.err
+	}
+
+	written := 0
+	for len(p) > 0 {
+		n := copy(w.buf[len(w.buf):chunkSize], p)
+		w.buf = w.buf[:len(w.buf)+n]
+		p = p[n:]
+		written += n
+
+		// A full chunk is only sealed once more data arrives, so the last
+		// chunk can always be marked as such on Close.
+		if len(w.buf) == chunkSize && len(p) > 0 {
+			w.err = w.flush(false)
+			if w.err != nil {
+				return written, w.err
+			}
+		}
+	}
+
+	return written, nil
+}
+
+func (w *Writer) flush(last bool) error {
+	sealed := w.cipher.aead.Seal(nil, w.cipher.nonce(w.prefix, w.index), w.buf, additionalData(w.index, last))
+	w.index++
+	w.buf = w.buf[:0]
+
+	_, err := w.w.Write(sealed)
+	return err
+}
+
+func (w *Writer) Close() error {
+	if w.err != nil {
+		return w.err
+	}
+
+	w.err = w.flush(true)
+	if w.err != nil {
+		return w.err
+	}
+
+	w.err = os.ErrClosed
+	return nil
+}
+
+// ReaderAt decrypts an encrypted file with random access.
+type ReaderAt struct {
+	cipher *Cipher
+	r      io.ReaderAt
+	prefix []byte
+	chunks uint64
+	size   int64
+	// the last decrypted chunk, ReadAt may be called concurrently
+	cacheMutex sync.Mutex
+	cached     []byte
+	cachedIdx  uint64
+}
+
+func (c *Cipher) NewReaderAt(r io.ReaderAt, encryptedSize int64) (*ReaderAt, error) {
+	if !IsEncrypted(r) {
+		return nil, ErrNotEncrypted
+	}
+
+	payload := encryptedSize - headerSize
+	if payload < tagSize {
+		return nil, ErrCorrupted
+	}
+
+	chunks := uint64((payload + sealedChunkSize - 1) / sealedChunkSize)
+	lastChunk := payload - int64(chunks-1)*sealedChunkSize
+	if lastChunk < tagSize {
+		return nil, ErrCorrupted
+	}
+
+	prefix := make([]byte, noncePrefixSize)
+	_, err := r.ReadAt(prefix, int64(len(magic)))
+	if err != nil {
+		return nil, err
+	}
+
+	return &ReaderAt{
+		cipher:    c,
+		r:         r,
+		prefix:    prefix,
+		chunks:    chunks,
+		size:      payload - int64(chunks)*tagSize,
+		cachedIdx: ^uint64(0),
+	}, nil
+}
+
+// Size returns the plaintext size.
+func (r *ReaderAt) Size() int64 {
+	return r.size
+}
+
+func (r *ReaderAt) chunk(index uint64) ([]byte, error) {
+	r.cacheMutex.Lock()
+	if index == r.cachedIdx {
+		plain := r.cached
+		r.cacheMutex.Unlock()
+		return plain, nil
+	}
+	r.cacheMutex.Unlock()
+
+	last := index == r.chunks-1
+	length := int64(sealedChunkSize)
+	if last {
+		length = r.size + int64(r.chunks)*tagSize - int64(index)*sealedChunkSize
+	}
+
+	sealed := make([]byte, length)
+	_, err := r.r.ReadAt(sealed, headerSize+int64(index)*sealedChunkSize)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+
+	plain, err := r.cipher.aead.Open(nil, r.cipher.nonce(r.prefix, index), sealed, additionalData(index, last))
+	if err != nil {
+		return nil, ErrCorrupted
+	}
+
+	r.cacheMutex.Lock()
+	r.cached = plain
+	r.cachedIdx = index
+	r.cacheMutex.Unlock()
+	return plain, nil
+}
+
+func (r *ReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errors.New("negative offset")
+	}
+
+	n := 0
+	for n < len(p) {
+		pos := off + int64(n)
+		if pos >= r.size {
+			return n, io.EOF
+		}
+
+		plain, err := r.chunk(uint64(pos / chunkSize))
+		if err != nil {
+			return n, err
+		}
+
+		n += copy(p[n:], plain[pos%chunkSize:])
+	}
+
+	return n, nil
+}
+
+// EncryptFile encrypts the file at src into dst.
+func (c *Cipher) EncryptFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+
+	err = c.encryptTo(out, in)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(dst)
+	}
+
+	return err
+}
+
+func (c *Cipher) encryptTo(out io.Writer, in io.Reader) error {
+	w, err := c.NewWriter(out)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(w, in)
+	if err != nil {
+		return err
+	}
+
+	return w.Close()
+}
@@ -0,0 +1,116 @@
+package encryption
+
+import (
+	"bytes"
+	"crypto/rand"
+	"io"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testCipher(t *testing.T) *Cipher {
+	key := make([]byte, keySize)
+	_, err := rand.Read(key)
+	assert.NoError(t, err)
+
+	c, err := NewCipher(key)
+	assert.NoError(t, err)
+	return c
+}
+
+func TestRoundTrip(t *testing.T) {
+	c := testCipher(t)
+
+	for _, size := range []int{0, 1, chunkSize - 1, chunkSize, chunkSize + 1, 3*chunkSize + 17} {
+		plain := make([]byte, size)
+		_, err := rand.Read(plain)
+		assert.NoError(t, err)
+
+		encrypted := &bytes.Buffer{}
+		assert.NoError(t, c.encryptTo(encrypted, bytes.NewReader(plain)))
+
+		r, err := c.NewReaderAt(bytes.NewReader(encrypted.Bytes()), int64(encrypted.Len()))
+		assert.NoError(t, err)
+		assert.Equal(t, int64(size), r.Size())
+
+		decrypted, err := io.ReadAll(io.NewSectionReader(r, 0, r.Size()))
+		assert.NoError(t, err)
+		assert.Equal(t, plain, decrypted)
+	}
+}
+
+func TestReadAtOffset(t *testing.T) {
+	c := testCipher(t)
+	plain := bytes.Repeat([]byte("0123456789"), chunkSize/5)
+
+	encrypted := &bytes.Buffer{}
+	assert.NoError(t, c.encryptTo(encrypted, bytes.NewReader(plain)))
+	r, err := c.NewReaderAt(bytes.NewReader(encrypted.Bytes()), int64(encrypted.Len()))
+	assert.NoError(t, err)
+
+	p := make([]byte, 20)
+	n, err := r.ReadAt(p, chunkSize-10)
+	assert.NoError(t, err)
+	assert.Equal(t, 20, n)
+	assert.Equal(t, plain[chunkSize-10:chunkSize+10], p)
+}
+
+func TestReadAtConcurrently(t *testing.T) {
+	c := testCipher(t)
+	plain := make([]byte, 4*chunkSize)
+	_, err := rand.Read(plain)
+	assert.NoError(t, err)
+
+	encrypted := &bytes.Buffer{}
+	assert.NoError(t, c.encryptTo(encrypted, bytes.NewReader(plain)))
+	r, err := c.NewReaderAt(bytes.NewReader(encrypted.Bytes()), int64(encrypted.Len()))
+	assert.NoError(t, err)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(off int64) {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				p := make([]byte, 64)
+				_, err := r.ReadAt(p, off)
+				assert.NoError(t, err)
+				assert.Equal(t, plain[off:off+64], p)
+			}
+		}(int64(i%4)*chunkSize + int64(i))
+	}
+	wg.Wait()
+}
+
+func TestDetectsTampering(t *testing.T) {
+	c := testCipher(t)
+	plain := bytes.Repeat([]byte{1}, 2*chunkSize)
+
+	encrypted := &bytes.Buffer{}
+	assert.NoError(t, c.encryptTo(encrypted, bytes.NewReader(plain)))
+	data := encrypted.Bytes()
+
+	flipped := append([]byte{}, data...)
+	flipped[headerSize+10] ^= 0xff
+	r, err := c.NewReaderAt(bytes.NewReader(flipped), int64(len(flipped)))
+	assert.NoError(t, err)
+	_, err = io.ReadAll(io.NewSectionReader(r, 0, r.Size()))
+	assert.ErrorIs(t, err, ErrCorrupted)
+
+	truncated := data[:headerSize+sealedChunkSize]
+	r, err = c.NewReaderAt(bytes.NewReader(truncated), int64(len(truncated)))
+	assert.NoError(t, err)
+	_, err = io.ReadAll(io.NewSectionReader(r, 0, r.Size()))
+	assert.ErrorIs(t, err, ErrCorrupted)
+}
+
+func TestParseKey(t *testing.T) {
+	_, err := parseKey([]byte("too short"))
+	assert.Error(t, err)
+
+	key, err := parseKey([]byte("000102030405060708090a0b0c0d0e0f000102030405060708090a0b0c0d0e0f\n"))
+	assert.NoError(t, err)
+	assert.Len(t, key, keySize)
+}
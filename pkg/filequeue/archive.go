@@ -0,0 +1,179 @@
+package filequeue
+
+import (
+	"os"
+	"path"
+	"sort"
+	"time"
+)
+
+// ArchiveOptions keep finished bundles of a queue around instead of deleting
+// them, so they can be re-injected later. Zero values mean unlimited.
+type ArchiveOptions struct {
+	Enabled  bool          `yaml:"enabled"`
+	TTL      time.Duration `yaml:"ttl"`
+	MaxBytes int64         `yaml:"maxbytes"`
+}
+
+type ArchivedBundle struct {
+	Queue      string
+	Path       string
+	Size       int64
+	ArchivedAt time.Time
+}
+
+func archiveDir(queueName string) string {
+	return baseDir + "/.archive/" + queueName
+}
+
+func (q *FsQueue) archive(filePath string) error {
+	dir := archiveDir(q.name)
+	err := ensureDir(dir)
+	if err != nil {
+		return err
+	}
+
+	archivedPath := dir + "/" + path.Base(filePath)
+	err = os.Rename(filePath, archivedPath)
+	if err != nil {
+		return err
+	}
+
+	// the modification time marks when the bundle was archived
+	now := time.Now()
+	os.Chtimes(archivedPath, now, now)
+
+	return q.PruneArchive()
+}
+
+// PruneArchive removes archived bundles exceeding the TTL and then the oldest
+// bundles until the archive fits into MaxBytes.
+func (q *FsQueue) PruneArchive() error {
+	if !q.archiveOptions.Enabled {
+		return nil
+	}
+
+	bundles, err := ListArchive(q.name)
+	if err != nil {
+		return err
+	}
+
+	var total int64
+	for _, bundle := range bundles {
+		total += bundle.Size
+	}
+
+	for _, bundle := range bundles {
+		expired := q.archiveOptions.TTL > 0 && time.Since(bundle.ArchivedAt) > q.archiveOptions.TTL
+		oversized := q.archiveOptions.MaxBytes > 0 && total > q.archiveOptions.MaxBytes
+		if !expired && !oversized {
+			continue
+		}
+
+		log.WithField("bundle", bundle.Path).Debug("Pruning archived bundle")
+		err = os.RemoveAll(bundle.Path)
+		if err != nil {
+			return err
+		}
+		total -= bundle.Size
+	}
+
+	return nil
+}
+
+// PruneArchives prunes the archives of queues right away and then every
+// interval until stop is closed. Archives are otherwise only pruned when a
+// bundle is archived, so bundles of an idle system would outlive their TTL.
+func PruneArchives(queues []*FsQueue, interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		for _, q := range queues {
+			err := q.PruneArchive()
+			if err != nil {
+				log.WithError(err).WithField("queue", q.name).Warn("Failed to prune archive")
+			}
+		}
+
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// ListArchive returns the archived bundles of a queue, oldest first.
+func ListArchive(queueName string) ([]ArchivedBundle, error) {
+	entries, err := os.ReadDir(archiveDir(queueName))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	bundles := make([]ArchivedBundle, 0, len(entries))
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+
+		bundlePath := archiveDir(queueName) + "/" + entry.Name()
+		bundles = append(bundles, ArchivedBundle{
+			Queue:      queueName,
+			Path:       bundlePath,
+			Size:       bundleSize(bundlePath),
+			ArchivedAt: info.ModTime(),
+		})
+	}
+
+	sort.Slice(bundles, func(i, j int) bool {
+		return bundles[i].ArchivedAt.Before(bundles[j].ArchivedAt)
+	})
+
+	return bundles, nil
+}
+
+// ListArchivedQueues returns the names of all queues with archived bundles.
+func ListArchivedQueues() ([]string, error) {
+	entries, err := os.ReadDir(baseDir + "/.archive")
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, entry := range entries {
+		if entry.IsDir() {
+			names = append(names, entry.Name())
+		}
+	}
+
+	return names, nil
+}
+
+// Reinject copies an archived bundle into target. The archived copy is kept.
+func Reinject(archivedPath string, target Queue) error {
+	err := ensureDir(baseDir)
+	if err != nil {
+		return err
+	}
+
+	tmpDir, err := os.MkdirTemp(baseDir, ".reinject-*")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	tmpPath := tmpDir + "/" + path.Base(archivedPath)
+	err = copyBundle(archivedPath, tmpPath)
+	if err != nil {
+		return err
+	}
+
+	return target.EnqueueFilePath(tmpPath)
+}
@@ -0,0 +1,87 @@
+package filequeue
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestArchiveAndReinject(t *testing.T) {
+	baseDir = t.TempDir()
+
+	q := NewFsQueue("scans").WithArchive(ArchiveOptions{Enabled: true, TTL: time.Hour})
+	assert.NoError(t, q.Enqueue([]byte("raw scan")))
+
+	f, err := q.Dequeue()
+	assert.NoError(t, err)
+	f.Close()
+	f.Done()
+
+	assert.Empty(t, listFiles(baseDir+"/scans"))
+	bundles, err := ListArchive("scans")
+	assert.NoError(t, err)
+	assert.Len(t, bundles, 1)
+
+	target := NewFsQueue("ocr")
+	assert.NoError(t, Reinject(bundles[0].Path, target))
+	reinjected := listFiles(baseDir + "/ocr")
+	assert.Len(t, reinjected, 1)
+	data, err := os.ReadFile(reinjected[0])
+	assert.NoError(t, err)
+	assert.Equal(t, "raw scan", string(data))
+
+	old := time.Now().Add(-2 * time.Hour)
+	assert.NoError(t, os.Chtimes(bundles[0].Path, old, old))
+	assert.NoError(t, q.PruneArchive())
+	bundles, err = ListArchive("scans")
+	assert.NoError(t, err)
+	assert.Empty(t, bundles)
+}
+
+func TestArchiveMaxBytes(t *testing.T) {
+	baseDir = t.TempDir()
+
+	q := NewFsQueue("scans").WithArchive(ArchiveOptions{Enabled: true, MaxBytes: 10})
+	for _, data := range []string{"first!", "second"} {
+		assert.NoError(t, q.Enqueue([]byte(data)))
+		f, err := q.Dequeue()
+		assert.NoError(t, err)
+		f.Close()
+		f.Done()
+	}
+
+	bundles, err := ListArchive("scans")
+	assert.NoError(t, err)
+	assert.Len(t, bundles, 1)
+	data, err := os.ReadFile(bundles[0].Path)
+	assert.NoError(t, err)
+	assert.Equal(t, "second", string(data))
+}
+
+func TestPruneArchivesWhileIdle(t *testing.T) {
+	baseDir = t.TempDir()
+
+	q := NewFsQueue("scans").WithArchive(ArchiveOptions{Enabled: true, TTL: 50 * time.Millisecond})
+	assert.NoError(t, q.Enqueue([]byte("raw scan")))
+	f, err := q.Dequeue()
+	assert.NoError(t, err)
+	f.Close()
+	f.Done()
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		PruneArchives([]*FsQueue{q}, 10*time.Millisecond, stop)
+	}()
+
+	// no other bundle is archived
+	assert.Eventually(t, func() bool {
+		bundles, err := ListArchive("scans")
+		return err == nil && len(bundles) == 0
+	}, 2*time.Second, 10*time.Millisecond)
+	close(stop)
+	<-done
+}
@@ -2,11 +2,15 @@ package filequeue
 
 import (
 	"fmt"
+	"io"
 	"os"
+	"path"
 	"sort"
+	"strings"
 	"time"
 
 	"github.com/fsnotify/fsnotify"
+	"github.com/schidstorm/scanner-tool/pkg/encryption"
 	"github.com/schidstorm/scanner-tool/pkg/logger"
 )
 
@@ -14,23 +18,107 @@ var log = logger.Logger(FsQueue{})
 
 type fsQueueFile struct {
 	*os.File
+	content *io.SectionReader
+	queue   *FsQueue
+}
+
+func openFsQueueFile(q *FsQueue, filePath string) (*fsQueueFile, error) {
+	file, content, err := openQueueFile(filePath, q.cipher)
+	if err != nil {
+		return nil, err
+	}
+
+	return &fsQueueFile{
+		File:    file,
+		content: content,
+		queue:   q,
+	}, nil
+}
+
+// openQueueFile opens a queued file and transparently decrypts it if it was
+// written encrypted.
+func openQueueFile(filePath string, cipher *encryption.Cipher) (*os.File, *io.SectionReader, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	stat, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, nil, err
+	}
+
+	var content io.ReaderAt = file
+	size := stat.Size()
+	if encryption.IsEncrypted(file) {
+		if cipher == nil {
+			file.Close()
+			return nil, nil, encryption.ErrNoKey
+		}
+
+		decrypted, err := cipher.NewReaderAt(file, size)
+		if err != nil {
+			file.Close()
+			return nil, nil, err
+		}
+		content = decrypted
+		size = decrypted.Size()
+	}
+
+	return file, io.NewSectionReader(content, 0, size), nil
+}
+
+func (f *fsQueueFile) Read(p []byte) (int, error) {
+	return f.content.Read(p)
+}
+
+func (f *fsQueueFile) ReadAt(p []byte, off int64) (int, error) {
+	return f.content.ReadAt(p, off)
 }
 
 func (f *fsQueueFile) Done() {
+	if f.queue == nil {
+		return
+	}
+	if f.queue.archiveOptions.Enabled {
+		err := f.queue.archive(f.Name())
+		if err == nil {
+			return
+		}
+		log.WithError(err).Warn("Failed to archive bundle, removing it")
+	}
+
 	os.Remove(f.Name())
 }
 
-func (f *fsQueueFile) Size() (int64, error) {
-	stat, err := f.Stat()
+// Nack leaves the file in the queue directory, where it is picked up again.
+func (f *fsQueueFile) Nack() {
+}
+
+func (f *fsQueueFile) Quarantine(reason error) {
+	if f.queue == nil {
+		return
+	}
+	quarantinedPath, err := f.queue.quarantine(f.Name(), reason)
 	if err != nil {
-		return 0, err
+		log.WithError(err).Error("Failed to quarantine bundle, removing it")
+		os.Remove(f.Name())
+		return
 	}
-	return stat.Size(), nil
+	log.WithField("path", quarantinedPath).Warn("Quarantined bundle")
+}
+
+func (f *fsQueueFile) Size() (int64, error) {
+	return f.content.Size(), nil
 }
 
 type FsQueue struct {
-	name    string
-	counter int
+	name           string
+	counter        int
+	limits         Limits
+	cipher         *encryption.Cipher
+	archiveOptions ArchiveOptions
 }
 
 func NewFsQueue(name string) *FsQueue {
@@ -39,6 +127,49 @@ func NewFsQueue(name string) *FsQueue {
 	}
 }
 
+func (q *FsQueue) WithLimits(limits Limits) *FsQueue {
+	q.limits = limits
+	return q
+}
+
+// WithCipher encrypts everything enqueued from now on. Files that are already
+// encrypted, e.g. by an encrypting zip writer, are moved as they are.
+func (q *FsQueue) WithCipher(cipher *encryption.Cipher) *FsQueue {
+	q.cipher = cipher
+	return q
+}
+
+// WithArchive moves finished bundles into the queue's archive instead of
+// deleting them.
+func (q *FsQueue) WithArchive(archiveOptions ArchiveOptions) *FsQueue {
+	q.archiveOptions = archiveOptions
+	return q
+}
+
+func (q *FsQueue) Full() error {
+	dir := baseDir + "/" + q.name
+	err := ensureDir(dir)
+	if err != nil {
+		return err
+	}
+
+	err = checkFreeDisk(dir)
+	if err != nil {
+		return err
+	}
+
+	if q.limits.MaxItems == 0 && q.limits.MaxBytes == 0 {
+		return nil
+	}
+
+	items, bytes := dirUsage(dir)
+	if q.limits.exceeded(items, bytes) {
+		return ErrQueueFull
+	}
+
+	return nil
+}
+
 func (q *FsQueue) Enqueue(data []byte) error {
 	log.Debugf("Enqueueing data to queue %s", q.name)
 	dir := baseDir + "/" + q.name
@@ -47,20 +178,30 @@ func (q *FsQueue) Enqueue(data []byte) error {
 		return err
 	}
 
-	filePath := fmt.Sprintf("%s/queue-%d-%d", dir, time.Now().Unix(), q.counter)
-	q.counter++
-	file, err := os.Create(filePath)
+	filePath := q.nextFilePath(dir)
+	tmpFilePath := partialFilePath(filePath)
+	file, err := os.OpenFile(tmpFilePath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
 	if err != nil {
 		return err
 	}
-	defer file.Close()
 
-	_, err = file.Write(data)
+	if q.cipher != nil {
+		err = q.writeEncrypted(file, data)
+	} else {
+		_, err = file.Write(data)
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
 	if err != nil {
+		os.Remove(tmpFilePath)
+		if isNoSpace(err) {
+			return ErrDiskFull
+		}
 		return err
 	}
 
-	return nil
+	return os.Rename(tmpFilePath, filePath)
 }
 
 func (q *FsQueue) EnqueueFilePath(existingFilePath string) error {
@@ -71,8 +212,26 @@ func (q *FsQueue) EnqueueFilePath(existingFilePath string) error {
 		return err
 	}
 
-	filePath := fmt.Sprintf("%s/queue-%d-%d", dir, time.Now().Unix(), q.counter)
-	q.counter++
+	filePath := q.nextFilePath(dir)
+
+	// directory bundles are encrypted file by file by their writer
+	if q.cipher != nil && !isDir(existingFilePath) && !isEncryptedFile(existingFilePath) {
+		tmpFilePath := partialFilePath(filePath)
+		err = q.cipher.EncryptFile(existingFilePath, tmpFilePath)
+		if err != nil {
+			if isNoSpace(err) {
+				return ErrDiskFull
+			}
+			return err
+		}
+		err = os.Rename(tmpFilePath, filePath)
+		if err != nil {
+			os.Remove(tmpFilePath)
+			return err
+		}
+		return os.Remove(existingFilePath)
+	}
+
 	err = os.Rename(existingFilePath, filePath)
 	if err != nil {
 		return err
@@ -81,6 +240,48 @@ func (q *FsQueue) EnqueueFilePath(existingFilePath string) error {
 	return nil
 }
 
+// nextFilePath returns a free, sortable file name. Several queue instances
+// or processes may enqueue into the same directory.
+func (q *FsQueue) nextFilePath(dir string) string {
+	for {
+		filePath := fmt.Sprintf("%s/queue-%d-%d", dir, time.Now().UnixNano(), q.counter)
+		q.counter++
+		if _, err := os.Stat(filePath); os.IsNotExist(err) {
+			return filePath
+		}
+	}
+}
+
+// partialFilePath is where a bundle is written before it is renamed into the
+// queue. Consumers skip dot-files, so they never see half written bundles.
+func partialFilePath(filePath string) string {
+	return path.Dir(filePath) + "/." + path.Base(filePath) + ".partial"
+}
+
+func (q *FsQueue) writeEncrypted(file *os.File, data []byte) error {
+	w, err := q.cipher.NewWriter(file)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(data)
+	if err != nil {
+		return err
+	}
+
+	return w.Close()
+}
+
+func isEncryptedFile(filePath string) bool {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+
+	return encryption.IsEncrypted(file)
+}
+
 func ensureDir(dir string) error {
 	if _, err := os.Stat(dir); os.IsNotExist(err) {
 		err = os.MkdirAll(dir, 0755)
@@ -104,12 +305,11 @@ func (q *FsQueue) Dequeue() (QueueFile, error) {
 		return nil, err
 	}
 
-	file, err := os.Open(filPaths[0])
-	if err != nil {
-		return nil, err
+	if isDir(filPaths[0]) {
+		return &fsQueueDir{path: filPaths[0], queue: q, cipher: q.cipher}, nil
 	}
 
-	return &fsQueueFile{File: file}, nil
+	return openFsQueueFile(q, filPaths[0])
 }
 
 func waitUntilSomeFiles(dir string) ([]string, error) {
@@ -167,6 +367,21 @@ func waitUntilSomeFiles(dir string) ([]string, error) {
 	return nil, nil
 }
 
+func dirUsage(dir string) (int, int64) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		log.WithError(err).Warn("Failed to list files")
+		return 0, 0
+	}
+
+	var bytes int64
+	for _, entry := range entries {
+		bytes += bundleSize(dir + "/" + entry.Name())
+	}
+
+	return len(entries), bytes
+}
+
 func listFiles(dir string) []string {
 	files, err := os.ReadDir(dir)
 	if err != nil {
@@ -176,6 +391,9 @@ func listFiles(dir string) []string {
 
 	filPaths := make([]string, 0, len(files))
 	for _, file := range files {
+		if strings.HasPrefix(file.Name(), ".") {
+			continue
+		}
 		filPaths = append(filPaths, dir+"/"+file.Name())
 	}
 	sort.Strings(filPaths)
@@ -0,0 +1,227 @@
+package filequeue
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/schidstorm/scanner-tool/pkg/encryption"
+)
+
+var ErrIsDir = errors.New("queue file is a directory bundle")
+
+// fsQueueDir is a directory bundle in a FsQueue. Directories are moved
+// between queues with a single rename.
+type fsQueueDir struct {
+	path   string
+	queue  *FsQueue
+	cipher *encryption.Cipher
+}
+
+// OpenDirBundle opens a directory bundle outside of any queue, e.g. for
+// inspection. Done, Nack and Quarantine do nothing.
+func OpenDirBundle(path string, cipher *encryption.Cipher) DirQueueFile {
+	return &fsQueueDir{path: path, cipher: cipher}
+}
+
+// OpenBundle opens a bundle file or directory outside of any queue.
+// Encrypted bundles need cipher.
+func OpenBundle(path string, cipher *encryption.Cipher) (QueueFile, error) {
+	if isDir(path) {
+		return OpenDirBundle(path, cipher), nil
+	}
+
+	file, content, err := openQueueFile(path, cipher)
+	if err != nil {
+		return nil, err
+	}
+
+	return &fsQueueFile{File: file, content: content}, nil
+}
+
+// MoveBundle moves a bundle file or directory, copying it if src and dst are
+// on different filesystems.
+func MoveBundle(src, dst string) error {
+	err := os.Rename(src, dst)
+	if err == nil {
+		return nil
+	}
+
+	err = copyBundle(src, dst)
+	if err != nil {
+		os.RemoveAll(dst)
+		return err
+	}
+
+	return os.RemoveAll(src)
+}
+
+func (d *fsQueueDir) Dir() string {
+	return d.path
+}
+
+func (d *fsQueueDir) OpenEntry(name string) (*DirEntry, error) {
+	if name != filepath.Base(name) {
+		return nil, fs.ErrInvalid
+	}
+
+	filePath := filepath.Join(d.path, name)
+	file, content, err := openQueueFile(filePath, d.cipher)
+	if err != nil {
+		return nil, err
+	}
+
+	return &DirEntry{
+		file:      file,
+		content:   content,
+		encrypted: encryption.IsEncrypted(file),
+	}, nil
+}
+
+// DirEntry is an opened file of a directory bundle.
+type DirEntry struct {
+	file      *os.File
+	content   *io.SectionReader
+	encrypted bool
+}
+
+func (e *DirEntry) Read(p []byte) (int, error) {
+	return e.content.Read(p)
+}
+
+func (e *DirEntry) ReadAt(p []byte, off int64) (int, error) {
+	return e.content.ReadAt(p, off)
+}
+
+// Size is the size of the decrypted content.
+func (e *DirEntry) Size() int64 {
+	return e.content.Size()
+}
+
+// Path returns the path of the file on disk, if it can be used directly. It
+// is empty for encrypted files.
+func (e *DirEntry) Path() string {
+	if e.encrypted {
+		return ""
+	}
+	return e.file.Name()
+}
+
+func (e *DirEntry) Close() error {
+	return e.file.Close()
+}
+
+func (d *fsQueueDir) Read(p []byte) (int, error) {
+	return 0, ErrIsDir
+}
+
+func (d *fsQueueDir) ReadAt(p []byte, off int64) (int, error) {
+	return 0, ErrIsDir
+}
+
+func (d *fsQueueDir) Close() error {
+	return nil
+}
+
+func (d *fsQueueDir) Size() (int64, error) {
+	return bundleSize(d.path), nil
+}
+
+func (d *fsQueueDir) Done() {
+	if d.queue == nil {
+		return
+	}
+	if d.queue.archiveOptions.Enabled {
+		err := d.queue.archive(d.path)
+		if err == nil {
+			return
+		}
+		log.WithError(err).Warn("Failed to archive bundle, removing it")
+	}
+
+	os.RemoveAll(d.path)
+}
+
+// Nack leaves the directory in the queue, where it is picked up again.
+func (d *fsQueueDir) Nack() {
+}
+
+func (d *fsQueueDir) Quarantine(reason error) {
+	if d.queue == nil {
+		return
+	}
+	quarantinedPath, err := d.queue.quarantine(d.path, reason)
+	if err != nil {
+		log.WithError(err).Error("Failed to quarantine bundle, removing it")
+		os.RemoveAll(d.path)
+		return
+	}
+	log.WithField("path", quarantinedPath).Warn("Quarantined bundle")
+}
+
+func isDir(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
+}
+
+// bundleSize is the size of a file bundle or the total size of all files in
+// a directory bundle.
+func bundleSize(path string) int64 {
+	var size int64
+	filepath.WalkDir(path, func(_ string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return nil
+		}
+		if info, err := entry.Info(); err == nil {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size
+}
+
+// copyBundle copies a file or directory bundle.
+func copyBundle(src, dst string) error {
+	if !isDir(src) {
+		return copyFile(src, dst)
+	}
+
+	err := os.Mkdir(dst, 0o700)
+	if err != nil {
+		return err
+	}
+
+	entries, err := os.ReadDir(src)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		err = copyFile(filepath.Join(src, entry.Name()), filepath.Join(dst, entry.Name()))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(out, in)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
@@ -0,0 +1,70 @@
+package filequeue
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func makeDirBundle(t *testing.T) string {
+	dir, err := os.MkdirTemp(baseDir, "bundle-*")
+	assert.NoError(t, err)
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "page.png"), []byte("page"), 0o600))
+	return dir
+}
+
+func TestFsQueueDirBundle(t *testing.T) {
+	baseDir = t.TempDir()
+
+	q := NewFsQueue("scans").WithArchive(ArchiveOptions{Enabled: true, TTL: time.Hour})
+	assert.NoError(t, q.EnqueueFilePath(makeDirBundle(t)))
+
+	f, err := q.Dequeue()
+	assert.NoError(t, err)
+	dirFile, ok := f.(DirQueueFile)
+	assert.True(t, ok)
+
+	_, err = f.Read(make([]byte, 1))
+	assert.ErrorIs(t, err, ErrIsDir)
+	size, _ := f.Size()
+	assert.Equal(t, int64(4), size)
+
+	entry, err := dirFile.OpenEntry("page.png")
+	assert.NoError(t, err)
+	data, _ := io.ReadAll(entry)
+	entry.Close()
+	assert.Equal(t, "page", string(data))
+	assert.Equal(t, filepath.Join(dirFile.Dir(), "page.png"), entry.Path())
+
+	_, err = dirFile.OpenEntry("../page.png")
+	assert.Error(t, err)
+
+	f.Done()
+	assert.Empty(t, listFiles(baseDir+"/scans"))
+
+	bundles, err := ListArchive("scans")
+	assert.NoError(t, err)
+	assert.Len(t, bundles, 1)
+	assert.Equal(t, int64(4), bundles[0].Size)
+
+	target := NewFsQueue("ocr")
+	assert.NoError(t, Reinject(bundles[0].Path, target))
+	reinjected := listFiles(baseDir + "/ocr")
+	assert.Len(t, reinjected, 1)
+	assert.True(t, isDir(reinjected[0]))
+
+	items, bytes := dirUsage(baseDir + "/ocr")
+	assert.Equal(t, 1, items)
+	assert.Equal(t, int64(4), bytes)
+}
+
+func TestMemQueueRejectsDirBundles(t *testing.T) {
+	baseDir = t.TempDir()
+
+	q := &MemQueryFileQueue{}
+	assert.ErrorIs(t, q.EnqueueFilePath(makeDirBundle(t)), ErrIsDir)
+}
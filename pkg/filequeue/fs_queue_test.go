@@ -0,0 +1,102 @@
+package filequeue
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"testing"
+
+	"github.com/schidstorm/scanner-tool/pkg/encryption"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFsQueueLimits(t *testing.T) {
+	baseDir = t.TempDir()
+
+	q := NewFsQueue("limits").WithLimits(Limits{MaxItems: 2})
+	assert.NoError(t, q.Full())
+
+	assert.NoError(t, q.Enqueue([]byte("first")))
+	assert.NoError(t, q.Full())
+
+	assert.NoError(t, q.Enqueue([]byte("second")))
+	assert.ErrorIs(t, q.Full(), ErrQueueFull)
+
+	q = NewFsQueue("bytes").WithLimits(Limits{MaxBytes: 4})
+	assert.NoError(t, q.Enqueue([]byte("data")))
+	assert.ErrorIs(t, q.Full(), ErrQueueFull)
+}
+
+func TestFsQueueMinFreeDisk(t *testing.T) {
+	baseDir = t.TempDir()
+	defer SetMinFreeDiskBytes(0)
+
+	q := NewFsQueue("disk")
+	SetMinFreeDiskBytes(1)
+	assert.NoError(t, q.Full())
+
+	SetMinFreeDiskBytes(1 << 62)
+	assert.ErrorIs(t, q.Full(), ErrDiskFull)
+}
+
+func TestFsQueueEncryption(t *testing.T) {
+	baseDir = t.TempDir()
+
+	cipher, err := encryption.NewCipher(bytes.Repeat([]byte{7}, 32))
+	assert.NoError(t, err)
+
+	q := NewFsQueue("encrypted").WithCipher(cipher)
+	assert.NoError(t, q.Enqueue([]byte("bank statement")))
+
+	files := listFiles(baseDir + "/encrypted")
+	assert.Len(t, files, 1)
+	raw, err := os.ReadFile(files[0])
+	assert.NoError(t, err)
+	assert.NotContains(t, string(raw), "bank statement")
+
+	f, err := q.Dequeue()
+	assert.NoError(t, err)
+	defer f.Close()
+
+	size, err := f.Size()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(len("bank statement")), size)
+
+	data, err := io.ReadAll(f)
+	assert.NoError(t, err)
+	assert.Equal(t, "bank statement", string(data))
+
+	_, err = NewFsQueue("encrypted").Dequeue()
+	assert.ErrorIs(t, err, encryption.ErrNoKey)
+}
+
+func TestFsQueueHidesPartialFiles(t *testing.T) {
+	baseDir = t.TempDir()
+
+	cipher, err := encryption.NewCipher(bytes.Repeat([]byte{7}, 32))
+	assert.NoError(t, err)
+	q := NewFsQueue("encrypted").WithCipher(cipher)
+
+	// a bundle that is still being encrypted
+	assert.NoError(t, os.MkdirAll(baseDir+"/encrypted", 0o755))
+	assert.NoError(t, os.WriteFile(partialFilePath(baseDir+"/encrypted/queue-1-0"), []byte("half"), 0o644))
+	assert.Empty(t, listFiles(baseDir+"/encrypted"))
+
+	existing := t.TempDir() + "/bundle.zip"
+	assert.NoError(t, os.WriteFile(existing, []byte("bank statement"), 0o644))
+	assert.NoError(t, q.EnqueueFilePath(existing))
+	assert.NoFileExists(t, existing)
+
+	files := listFiles(baseDir + "/encrypted")
+	assert.Len(t, files, 1)
+	entries, err := os.ReadDir(baseDir + "/encrypted")
+	assert.NoError(t, err)
+	assert.Len(t, entries, 2)
+
+	f, err := q.Dequeue()
+	assert.NoError(t, err)
+	defer f.Close()
+	data, err := io.ReadAll(f)
+	assert.NoError(t, err)
+	assert.Equal(t, "bank statement", string(data))
+}
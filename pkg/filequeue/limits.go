@@ -0,0 +1,65 @@
+package filequeue
+
+import (
+	"errors"
+	"syscall"
+)
+
+var ErrQueueFull = errors.New("queue is full")
+var ErrDiskFull = errors.New("not enough free disk space")
+
+// minFreeDiskBytes is the global free space threshold below which no queue
+// accepts new work. Zero disables the check.
+var minFreeDiskBytes int64
+
+// Limits bounds the amount of work a single queue may hold. Zero values mean
+// unlimited.
+type Limits struct {
+	MaxItems int   `yaml:"maxitems" json:"maxitems"`
+	MaxBytes int64 `yaml:"maxbytes" json:"maxbytes"`
+}
+
+func (l Limits) exceeded(items int, bytes int64) bool {
+	if l.MaxItems > 0 && items >= l.MaxItems {
+		return true
+	}
+	if l.MaxBytes > 0 && bytes >= l.MaxBytes {
+		return true
+	}
+	return false
+}
+
+func SetMinFreeDiskBytes(bytes int64) {
+	minFreeDiskBytes = bytes
+}
+
+func checkFreeDisk(dir string) error {
+	if minFreeDiskBytes <= 0 {
+		return nil
+	}
+
+	free, err := freeDiskBytes(dir)
+	if err != nil {
+		return err
+	}
+
+	if free < minFreeDiskBytes {
+		return ErrDiskFull
+	}
+
+	return nil
+}
+
+func freeDiskBytes(dir string) (int64, error) {
+	var stat syscall.Statfs_t
+	err := syscall.Statfs(dir, &stat)
+	if err != nil {
+		return 0, err
+	}
+
+	return int64(stat.Bavail) * int64(stat.Bsize), nil
+}
+
+func isNoSpace(err error) bool {
+	return errors.Is(err, syscall.ENOSPC)
+}
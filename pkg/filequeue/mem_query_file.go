@@ -4,24 +4,37 @@ import (
 	"io"
 	"os"
 	"strconv"
+	"sync"
+	"time"
 )
 
+var memDequeueWait = 5 * time.Second
+
 type MemQueryFile struct {
 	Name string
 	Data []byte
-}
 
-/*
-io.Reader
-	io.ReaderAt
-	io.Closer
+	offset int64
+	queue  *MemQueryFileQueue
+	lease  int
+}
 
-	Done()
-	Size() (int64, error)
-*/
+func (f *MemQueryFile) Done() {
+	if f.queue != nil {
+		f.queue.ack(f)
+	}
+}
 
-func (f MemQueryFile) Done() {
+func (f *MemQueryFile) Nack() {
+	if f.queue != nil {
+		f.queue.nack(f)
+	}
+}
 
+func (f *MemQueryFile) Quarantine(reason error) {
+	if f.queue != nil {
+		f.queue.quarantine(f)
+	}
 }
 
 func (f *MemQueryFile) Size() (int64, error) {
@@ -29,14 +42,13 @@ func (f *MemQueryFile) Size() (int64, error) {
 }
 
 func (f *MemQueryFile) Read(p []byte) (n int, err error) {
-	if len(f.Data) == 0 {
-		return 0, io.EOF
+	n, err = f.ReadAt(p, f.offset)
+	f.offset += int64(n)
+	if err == io.EOF && n > 0 {
+		err = nil
 	}
 
-	n = copy(p, f.Data)
-	f.Data = f.Data[n:]
-
-	return n, nil
+	return n, err
 }
 
 func (f *MemQueryFile) ReadAt(p []byte, off int64) (n int, err error) {
@@ -56,42 +68,258 @@ func (f *MemQueryFile) ReadAt(p []byte, off int64) (n int, err error) {
 	return n, nil
 }
 
-func (f MemQueryFile) Close() error {
+func (f *MemQueryFile) Close() error {
 	// No resources to release
 	return nil
 }
 
+type memLease struct {
+	file    MemQueryFile
+	expires time.Time
+}
+
+// MemQueryFileQueue is an in-memory Queue with the same semantics as the
+// filesystem queue: Dequeue blocks until a file is available, dequeued files
+// are leased until they are acknowledged with Done or returned with Nack.
+// Leases that are not settled within LeaseTime are handed out again. It is
+// safe for concurrent use.
 type MemQueryFileQueue struct {
-	Files []MemQueryFile
+	Files  []MemQueryFile
+	Limits Limits
+	// LeaseTime defaults to one hour.
+	LeaseTime time.Duration
+	// DequeueWait is how long Dequeue blocks on an empty queue before it
+	// returns nil. It defaults to memDequeueWait.
+	DequeueWait time.Duration
+
+	mutex       sync.Mutex
+	available   chan struct{}
+	leases      map[int]*memLease
+	leaseID     int
+	counter     int
+	done        []MemQueryFile
+	quarantined []MemQueryFile
+	closed      bool
+}
+
+func (q *MemQueryFileQueue) Full() error {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	var bytes int64
+	for _, file := range q.Files {
+		bytes += int64(len(file.Data))
+	}
+
+	if q.Limits.exceeded(len(q.Files)+len(q.leases), bytes) {
+		return ErrQueueFull
+	}
+
+	return nil
 }
 
 func (q *MemQueryFileQueue) Enqueue(data []byte) error {
-	q.Files = append(q.Files, MemQueryFile{
-		Name: "file-" + strconv.FormatInt(int64(len(q.Files)), 10),
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	q.push(MemQueryFile{
+		Name: "file-" + strconv.Itoa(q.counter),
 		Data: data,
 	})
 	return nil
 }
 
+// EnqueueFilePath moves the file into memory, like the filesystem queue
+// moves it into the queue directory.
 func (q *MemQueryFileQueue) EnqueueFilePath(existingFilePath string) error {
+	if isDir(existingFilePath) {
+		return ErrIsDir
+	}
+
 	data, err := os.ReadFile(existingFilePath)
 	if err != nil {
 		return err
 	}
-	q.Files = append(q.Files, MemQueryFile{
+
+	q.mutex.Lock()
+	q.push(MemQueryFile{
 		Name: existingFilePath,
 		Data: data,
 	})
-	return nil
+	q.mutex.Unlock()
+
+	return os.Remove(existingFilePath)
+}
+
+func (q *MemQueryFileQueue) push(file MemQueryFile) {
+	q.counter++
+	q.Files = append(q.Files, file)
+	q.signal()
+}
+
+// signal wakes up all waiting dequeuers. The mutex must be held.
+func (q *MemQueryFileQueue) signal() {
+	if q.available != nil {
+		close(q.available)
+		q.available = nil
+	}
 }
 
 func (q *MemQueryFileQueue) Dequeue() (QueueFile, error) {
-	if len(q.Files) == 0 {
-		return nil, io.EOF
+	wait := q.DequeueWait
+	if wait == 0 {
+		wait = memDequeueWait
+	}
+	deadline := time.After(wait)
+
+	for {
+		q.mutex.Lock()
+		q.expireLeases()
+
+		if len(q.Files) > 0 {
+			file := q.lease(q.Files[0])
+			q.Files = q.Files[1:]
+			q.mutex.Unlock()
+			return file, nil
+		}
+
+		if q.closed {
+			q.mutex.Unlock()
+			return nil, nil
+		}
+
+		if q.available == nil {
+			q.available = make(chan struct{})
+		}
+		available := q.available
+		q.mutex.Unlock()
+
+		select {
+		case <-available:
+		case <-deadline:
+			return nil, nil
+		case <-time.After(q.nextLeaseExpiry()):
+		}
+	}
+}
+
+func (q *MemQueryFileQueue) lease(file MemQueryFile) *MemQueryFile {
+	if q.leases == nil {
+		q.leases = make(map[int]*memLease)
+	}
+
+	leaseTime := q.LeaseTime
+	if leaseTime == 0 {
+		leaseTime = time.Hour
+	}
+
+	q.leaseID++
+	q.leases[q.leaseID] = &memLease{
+		file:    file,
+		expires: time.Now().Add(leaseTime),
+	}
+
+	file.offset = 0
+	file.queue = q
+	file.lease = q.leaseID
+	return &file
+}
+
+// expireLeases puts files with expired leases back to the front of the
+// queue. The mutex must be held.
+func (q *MemQueryFileQueue) expireLeases() {
+	now := time.Now()
+	for id, lease := range q.leases {
+		if now.After(lease.expires) {
+			delete(q.leases, id)
+			q.Files = append([]MemQueryFile{lease.file}, q.Files...)
+		}
+	}
+}
+
+func (q *MemQueryFileQueue) nextLeaseExpiry() time.Duration {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	next := time.Hour
+	for _, lease := range q.leases {
+		if until := time.Until(lease.expires); until < next {
+			next = until
+		}
+	}
+
+	return max(next, time.Millisecond)
+}
+
+func (q *MemQueryFileQueue) ack(file *MemQueryFile) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	lease, ok := q.leases[file.lease]
+	if !ok {
+		return
+	}
+
+	delete(q.leases, file.lease)
+	q.done = append(q.done, lease.file)
+}
+
+func (q *MemQueryFileQueue) nack(file *MemQueryFile) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	lease, ok := q.leases[file.lease]
+	if !ok {
+		return
+	}
+
+	delete(q.leases, file.lease)
+	q.Files = append([]MemQueryFile{lease.file}, q.Files...)
+	q.signal()
+}
+
+func (q *MemQueryFileQueue) quarantine(file *MemQueryFile) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	lease, ok := q.leases[file.lease]
+	if !ok {
+		return
 	}
 
-	file := q.Files[0]
-	q.Files = q.Files[1:]
+	delete(q.leases, file.lease)
+	q.quarantined = append(q.quarantined, lease.file)
+}
+
+// Quarantined returns all files that were quarantined.
+func (q *MemQueryFileQueue) Quarantined() []MemQueryFile {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	return append([]MemQueryFile{}, q.quarantined...)
+}
+
+// Acknowledged returns all files that were marked Done.
+func (q *MemQueryFileQueue) Acknowledged() []MemQueryFile {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	return append([]MemQueryFile{}, q.done...)
+}
+
+// Len returns the number of pending and leased files.
+func (q *MemQueryFileQueue) Len() int {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	return len(q.Files) + len(q.leases)
+}
+
+// Close wakes up all blocked dequeuers, which then return nil.
+func (q *MemQueryFileQueue) Close() {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
 
-	return &file, nil
+	q.closed = true
+	q.signal()
 }
@@ -0,0 +1,73 @@
+package filequeue
+
+import (
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemQueueBlockingDequeue(t *testing.T) {
+	q := &MemQueryFileQueue{DequeueWait: time.Second}
+
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		q.Enqueue([]byte("late"))
+	}()
+
+	f, err := q.Dequeue()
+	assert.NoError(t, err)
+	data, err := io.ReadAll(f)
+	assert.NoError(t, err)
+	assert.Equal(t, "late", string(data))
+
+	q.DequeueWait = 10 * time.Millisecond
+	f, err = q.Dequeue()
+	assert.NoError(t, err)
+	assert.Nil(t, f)
+}
+
+func TestMemQueueAckNack(t *testing.T) {
+	q := &MemQueryFileQueue{DequeueWait: 10 * time.Millisecond}
+	q.Enqueue([]byte("first"))
+	q.Enqueue([]byte("second"))
+
+	f, err := q.Dequeue()
+	assert.NoError(t, err)
+	f.Nack()
+
+	f, err = q.Dequeue()
+	assert.NoError(t, err)
+	assert.Equal(t, "first", string(f.(*MemQueryFile).Data))
+	f.Done()
+	f.Done()
+
+	assert.Len(t, q.Acknowledged(), 1)
+	assert.Equal(t, 1, q.Len())
+}
+
+func TestMemQueueLeaseExpiry(t *testing.T) {
+	q := &MemQueryFileQueue{LeaseTime: 20 * time.Millisecond, DequeueWait: time.Second}
+	q.Enqueue([]byte("leased"))
+
+	f, err := q.Dequeue()
+	assert.NoError(t, err)
+	assert.NotNil(t, f)
+
+	f, err = q.Dequeue()
+	assert.NoError(t, err)
+	assert.Equal(t, "leased", string(f.(*MemQueryFile).Data))
+}
+
+func TestMemQueueClose(t *testing.T) {
+	q := &MemQueryFileQueue{DequeueWait: time.Minute}
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		q.Close()
+	}()
+
+	f, err := q.Dequeue()
+	assert.NoError(t, err)
+	assert.Nil(t, f)
+}
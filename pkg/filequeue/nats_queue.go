@@ -0,0 +1,333 @@
+package filequeue
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/nats-io/nuid"
+	"github.com/schidstorm/scanner-tool/pkg/encryption"
+	"github.com/schidstorm/scanner-tool/pkg/workspace"
+)
+
+var natsDequeueWait = 5 * time.Second
+var natsRequestTimeout = 30 * time.Second
+
+// NatsQueue is a Queue backed by NATS JetStream. Bundles are stored in an
+// object store bucket, a work queue stream carries the object names. Several
+// processes on different hosts may consume the same queue.
+type NatsQueue struct {
+	name     string
+	js       jetstream.JetStream
+	store    jetstream.ObjectStore
+	stream   jetstream.Stream
+	consumer jetstream.Consumer
+	limits   Limits
+	cipher   *encryption.Cipher
+}
+
+type natsQueueFile struct {
+	*os.File
+	content *io.SectionReader
+	queue   *NatsQueue
+	msg     jetstream.Msg
+	object  string
+}
+
+type NatsOptions struct {
+	Url       string `yaml:"url"`
+	CredsFile string `yaml:"credsfile"`
+	// LeaseTime is how long a consumer may work on a bundle before it is
+	// handed out again.
+	LeaseTime time.Duration `yaml:"leasetime"`
+}
+
+func natsSubject(name string) string {
+	return "scanner-tool.queue." + name
+}
+
+func NewNatsQueue(js jetstream.JetStream, name string, leaseTime time.Duration) (*NatsQueue, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), natsRequestTimeout)
+	defer cancel()
+
+	if leaseTime == 0 {
+		leaseTime = time.Hour
+	}
+
+	store, err := js.CreateOrUpdateObjectStore(ctx, jetstream.ObjectStoreConfig{
+		Bucket: "scanner-tool-" + name,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create object store for queue %s: %w", name, err)
+	}
+
+	stream, err := js.CreateOrUpdateStream(ctx, jetstream.StreamConfig{
+		Name:      "scanner-tool-" + name,
+		Subjects:  []string{natsSubject(name)},
+		Retention: jetstream.WorkQueuePolicy,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create stream for queue %s: %w", name, err)
+	}
+
+	consumer, err := stream.CreateOrUpdateConsumer(ctx, jetstream.ConsumerConfig{
+		Durable:   "workers",
+		AckPolicy: jetstream.AckExplicitPolicy,
+		AckWait:   leaseTime,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create consumer for queue %s: %w", name, err)
+	}
+
+	return &NatsQueue{
+		name:     name,
+		js:       js,
+		store:    store,
+		stream:   stream,
+		consumer: consumer,
+	}, nil
+}
+
+func (q *NatsQueue) WithLimits(limits Limits) *NatsQueue {
+	q.limits = limits
+	return q
+}
+
+func (q *NatsQueue) WithCipher(cipher *encryption.Cipher) *NatsQueue {
+	q.cipher = cipher
+	return q
+}
+
+func (q *NatsQueue) Full() error {
+	if q.limits.MaxItems == 0 && q.limits.MaxBytes == 0 {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), natsRequestTimeout)
+	defer cancel()
+
+	info, err := q.stream.Info(ctx)
+	if err != nil {
+		return err
+	}
+
+	status, err := q.store.Status(ctx)
+	if err != nil {
+		return err
+	}
+
+	if q.limits.exceeded(int(info.State.Msgs), int64(status.Size())) {
+		return ErrQueueFull
+	}
+
+	return nil
+}
+
+func (q *NatsQueue) Enqueue(data []byte) error {
+	log.Debugf("Enqueueing data to nats queue %s", q.name)
+	return q.putReader(bytes.NewReader(data))
+}
+
+func (q *NatsQueue) EnqueueFilePath(existingFilePath string) error {
+	if isDir(existingFilePath) {
+		return ErrIsDir
+	}
+
+	log.Debugf("Enqueueing file to nats queue %s", q.name)
+	file, err := os.Open(existingFilePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if encryption.IsEncrypted(file) {
+		err = q.put(func(ctx context.Context, name string) error {
+			_, err := q.store.Put(ctx, jetstream.ObjectMeta{Name: name}, file)
+			return err
+		})
+	} else {
+		err = q.putReader(file)
+	}
+	if err != nil {
+		return err
+	}
+
+	return os.Remove(existingFilePath)
+}
+
+// putReader stores r, encrypting it on the fly if a cipher is configured.
+func (q *NatsQueue) putReader(r io.Reader) error {
+	if q.cipher != nil {
+		encrypted := newEncryptingReader(q.cipher, r)
+		defer encrypted.Close()
+		r = encrypted
+	}
+
+	return q.put(func(ctx context.Context, name string) error {
+		_, err := q.store.Put(ctx, jetstream.ObjectMeta{Name: name}, r)
+		return err
+	})
+}
+
+func newEncryptingReader(cipher *encryption.Cipher, r io.Reader) io.ReadCloser {
+	pr, pw := io.Pipe()
+	go func() {
+		w, err := cipher.NewWriter(pw)
+		if err == nil {
+			_, err = io.Copy(w, r)
+		}
+		if err == nil {
+			err = w.Close()
+		}
+		pw.CloseWithError(err)
+	}()
+
+	return pr
+}
+
+func (q *NatsQueue) put(store func(ctx context.Context, name string) error) error {
+	ctx, cancel := context.WithTimeout(context.Background(), natsRequestTimeout)
+	defer cancel()
+
+	name := nuid.Next()
+	err := store(ctx, name)
+	if err != nil {
+		return err
+	}
+
+	_, err = q.js.Publish(ctx, natsSubject(q.name), []byte(name))
+	if err != nil {
+		q.store.Delete(ctx, name)
+		return err
+	}
+
+	return nil
+}
+
+// Dequeue waits up to natsDequeueWait for a bundle and returns nil if there
+// is none. The bundle is downloaded to a temporary file so it can be read
+// with random access.
+func (q *NatsQueue) Dequeue() (QueueFile, error) {
+	log.Debugf("Dequeueing file from nats queue %s", q.name)
+	batch, err := q.consumer.Fetch(1, jetstream.FetchMaxWait(natsDequeueWait))
+	if err != nil {
+		return nil, err
+	}
+
+	var msg jetstream.Msg
+	for m := range batch.Messages() {
+		msg = m
+	}
+	if err := batch.Error(); err != nil && !errors.Is(err, jetstream.ErrNoMessages) {
+		return nil, err
+	}
+	if msg == nil {
+		return nil, nil
+	}
+
+	object := string(msg.Data())
+	tmpPath, err := q.download(object)
+	if err != nil {
+		msg.Nak()
+		return nil, err
+	}
+
+	file, content, err := openQueueFile(tmpPath, q.cipher)
+	if err != nil {
+		os.Remove(tmpPath)
+		msg.Nak()
+		return nil, err
+	}
+
+	return &natsQueueFile{
+		File:    file,
+		content: content,
+		queue:   q,
+		msg:     msg,
+		object:  object,
+	}, nil
+}
+
+func (q *NatsQueue) download(object string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), natsRequestTimeout)
+	defer cancel()
+
+	result, err := q.store.Get(ctx, object)
+	if err != nil {
+		return "", err
+	}
+	defer result.Close()
+
+	tmpFile, err := workspace.CreateTemp("nats", "")
+	if err != nil {
+		return "", err
+	}
+
+	_, err = io.Copy(tmpFile, result)
+	if closeErr := tmpFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmpFile.Name())
+		return "", err
+	}
+
+	return tmpFile.Name(), nil
+}
+
+func (f *natsQueueFile) Read(p []byte) (int, error) {
+	return f.content.Read(p)
+}
+
+func (f *natsQueueFile) ReadAt(p []byte, off int64) (int, error) {
+	return f.content.ReadAt(p, off)
+}
+
+func (f *natsQueueFile) Size() (int64, error) {
+	return f.content.Size(), nil
+}
+
+func (f *natsQueueFile) Close() error {
+	err := f.File.Close()
+	os.Remove(f.Name())
+	return err
+}
+
+func (f *natsQueueFile) Nack() {
+	err := f.msg.Nak()
+	if err != nil {
+		log.WithError(err).Warn("Failed to return bundle to queue")
+	}
+}
+
+func (f *natsQueueFile) Done() {
+	ctx, cancel := context.WithTimeout(context.Background(), natsRequestTimeout)
+	defer cancel()
+
+	err := f.msg.DoubleAck(ctx)
+	if err != nil {
+		log.WithError(err).Warn("Failed to acknowledge bundle")
+		return
+	}
+
+	err = f.queue.store.Delete(ctx, f.object)
+	if err != nil {
+		log.WithError(err).Warn("Failed to delete acknowledged bundle")
+	}
+}
+
+// Quarantine terminates the message, so it is not redelivered, and keeps the
+// object in the bucket for inspection.
+func (f *natsQueueFile) Quarantine(reason error) {
+	err := f.msg.Term()
+	if err != nil {
+		log.WithError(err).Warn("Failed to terminate bundle")
+		return
+	}
+	log.WithError(reason).WithField("object", f.object).Warn("Quarantined bundle")
+}
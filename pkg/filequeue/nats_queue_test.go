@@ -0,0 +1,95 @@
+package filequeue
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/schidstorm/scanner-tool/pkg/encryption"
+	"github.com/stretchr/testify/assert"
+)
+
+func startNats(t *testing.T) jetstream.JetStream {
+	ns, err := server.NewServer(&server.Options{
+		Host:      "127.0.0.1",
+		Port:      -1,
+		JetStream: true,
+		StoreDir:  t.TempDir(),
+	})
+	assert.NoError(t, err)
+
+	go ns.Start()
+	if !ns.ReadyForConnections(10 * time.Second) {
+		t.Fatal("nats server did not start")
+	}
+	t.Cleanup(ns.Shutdown)
+
+	nc, err := nats.Connect(ns.ClientURL())
+	assert.NoError(t, err)
+	t.Cleanup(nc.Close)
+
+	js, err := jetstream.New(nc)
+	assert.NoError(t, err)
+	return js
+}
+
+func TestNatsQueue(t *testing.T) {
+	natsDequeueWait = 100 * time.Millisecond
+	js := startNats(t)
+
+	q, err := NewNatsQueue(js, "TesseractHandler", time.Minute)
+	assert.NoError(t, err)
+
+	empty, err := q.Dequeue()
+	assert.NoError(t, err)
+	assert.Nil(t, empty)
+
+	assert.NoError(t, q.Enqueue([]byte("first")))
+
+	tmpPath := path.Join(t.TempDir(), "bundle.zip")
+	assert.NoError(t, os.WriteFile(tmpPath, []byte("second"), 0o644))
+	assert.NoError(t, q.EnqueueFilePath(tmpPath))
+	assert.NoFileExists(t, tmpPath)
+
+	q.WithLimits(Limits{MaxItems: 2})
+	assert.ErrorIs(t, q.Full(), ErrQueueFull)
+
+	for _, expected := range []string{"first", "second"} {
+		f, err := q.Dequeue()
+		assert.NoError(t, err)
+		data, err := io.ReadAll(f)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, string(data))
+		f.Close()
+		f.Done()
+	}
+
+	assert.NoError(t, q.Full())
+}
+
+func TestNatsQueueEncryption(t *testing.T) {
+	natsDequeueWait = 100 * time.Millisecond
+	js := startNats(t)
+
+	cipher, err := encryption.NewCipher(bytes.Repeat([]byte{3}, 32))
+	assert.NoError(t, err)
+
+	q, err := NewNatsQueue(js, "MergeHandler", time.Minute)
+	assert.NoError(t, err)
+	q.WithCipher(cipher)
+
+	assert.NoError(t, q.Enqueue([]byte("tax letter")))
+
+	f, err := q.Dequeue()
+	assert.NoError(t, err)
+	defer f.Close()
+	data, err := io.ReadAll(f)
+	assert.NoError(t, err)
+	assert.Equal(t, "tax letter", string(data))
+}
@@ -0,0 +1,55 @@
+package filequeue
+
+import (
+	"os"
+	"path"
+)
+
+func quarantineDir(queueName string) string {
+	return baseDir + "/.quarantine/" + queueName
+}
+
+// quarantine moves a broken bundle out of the queue. The reason is written
+// next to it.
+func (q *FsQueue) quarantine(filePath string, reason error) (string, error) {
+	dir := quarantineDir(q.name)
+	err := ensureDir(dir)
+	if err != nil {
+		return "", err
+	}
+
+	quarantinedPath := dir + "/" + path.Base(filePath)
+	err = os.Rename(filePath, quarantinedPath)
+	if err != nil {
+		return "", err
+	}
+
+	if reason != nil {
+		os.WriteFile(quarantinedPath+".reason", []byte(reason.Error()+"\n"), 0o600)
+	}
+
+	return quarantinedPath, nil
+}
+
+// ListQuarantine lists the quarantined bundles of a queue. They can be put
+// back with Reinject once repaired.
+func ListQuarantine(queueName string) ([]string, error) {
+	entries, err := os.ReadDir(quarantineDir(queueName))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var bundles []string
+	for _, entry := range entries {
+		// directory bundles are listed like zip bundles
+		if path.Ext(entry.Name()) == ".reason" {
+			continue
+		}
+		bundles = append(bundles, quarantineDir(queueName)+"/"+entry.Name())
+	}
+
+	return bundles, nil
+}
@@ -0,0 +1,56 @@
+package filequeue
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQuarantine(t *testing.T) {
+	baseDir = t.TempDir()
+
+	q := NewFsQueue("scans")
+	assert.NoError(t, q.Enqueue([]byte("broken")))
+
+	f, err := q.Dequeue()
+	assert.NoError(t, err)
+	f.Quarantine(errors.New("checksum mismatch"))
+	f.Close()
+
+	assert.Empty(t, listFiles(baseDir+"/scans"))
+	bundles, err := ListQuarantine("scans")
+	assert.NoError(t, err)
+	assert.Len(t, bundles, 1)
+
+	reason, err := os.ReadFile(bundles[0] + ".reason")
+	assert.NoError(t, err)
+	assert.Equal(t, "checksum mismatch\n", string(reason))
+}
+
+func TestQuarantineDirBundle(t *testing.T) {
+	baseDir = t.TempDir()
+
+	q := NewFsQueue("scans")
+	assert.NoError(t, q.EnqueueFilePath(makeDirBundle(t)))
+
+	f, err := q.Dequeue()
+	assert.NoError(t, err)
+	f.Quarantine(errors.New("page missing"))
+	f.Close()
+
+	assert.Empty(t, listFiles(baseDir+"/scans"))
+	bundles, err := ListQuarantine("scans")
+	assert.NoError(t, err)
+	if !assert.Len(t, bundles, 1) {
+		return
+	}
+	assert.True(t, isDir(bundles[0]))
+
+	target := NewFsQueue("scans")
+	assert.NoError(t, Reinject(bundles[0], target))
+	reinjected := listFiles(baseDir + "/scans")
+	assert.Len(t, reinjected, 1)
+	assert.FileExists(t, reinjected[0]+"/page.png")
+}
@@ -11,6 +11,9 @@ type Queue interface {
 	Enqueue(data []byte) error
 	EnqueueFilePath(existingFilePath string) error
 	Dequeue() (QueueFile, error)
+	// Full returns ErrQueueFull or ErrDiskFull while the queue must not
+	// receive new work.
+	Full() error
 }
 
 type QueueFile interface {
@@ -18,6 +21,21 @@ type QueueFile interface {
 	io.ReaderAt
 	io.Closer
 
+	// Done acknowledges the file, it will not be handed out again.
 	Done()
+	// Nack returns the file to the queue, so it is retried.
+	Nack()
+	// Quarantine takes a broken file out of the queue for inspection. It
+	// is not handed out again.
+	Quarantine(reason error)
 	Size() (int64, error)
 }
+
+// DirQueueFile is a queued directory bundle. Its files are read with
+// OpenEntry, Read and ReadAt fail with ErrIsDir.
+type DirQueueFile interface {
+	QueueFile
+	Dir() string
+	// OpenEntry opens a file of the bundle and transparently decrypts it.
+	OpenEntry(name string) (*DirEntry, error)
+}
@@ -0,0 +1,62 @@
+package ingest
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"time"
+)
+
+// ErrUnsupportedFile fails batches that can never be ingested, they are not
+// retried.
+var ErrUnsupportedFile = errors.New("unsupported file")
+
+// File is a file that enters the pipeline without being scanned. Its content
+// is opened while the batch is ingested, dropped files and uploads are not
+// held in memory.
+type File struct {
+	Name string
+	Open func() (io.ReadSeekCloser, error)
+}
+
+// PathFile is a file on disk, e.g. in a watched folder.
+func PathFile(name string, filePath string) File {
+	return File{Name: name, Open: func() (io.ReadSeekCloser, error) {
+		return os.Open(filePath)
+	}}
+}
+
+// DataFile is a file that is already in memory, e.g. a mail attachment.
+func DataFile(name string, data []byte) File {
+	return File{Name: name, Open: func() (io.ReadSeekCloser, error) {
+		return nopCloser{bytes.NewReader(data)}, nil
+	}}
+}
+
+type nopCloser struct {
+	io.ReadSeeker
+}
+
+func (nopCloser) Close() error {
+	return nil
+}
+
+// Batch is a group of files that becomes one bundle, e.g. a dropped file, a
+// sub-folder or the attachments of a mail.
+type Batch struct {
+	Files []File
+	// Source is recorded like the device of scanned bundles, e.g.
+	// "watch:/srv/inbox".
+	Source  string
+	Profile string
+	Title   string
+	Tags    []string
+	// Correspondent and Created are known for mails.
+	Correspondent string
+	Created       time.Time
+}
+
+// IngestFunc puts a batch into the pipeline. Batches that failed are
+// ingested again later.
+type IngestFunc func(batch Batch) error
@@ -0,0 +1,377 @@
+package ingest
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/client"
+	"github.com/emersion/go-imap/commands"
+	_ "github.com/emersion/go-message/charset"
+	"github.com/emersion/go-message/mail"
+	"github.com/schidstorm/scanner-tool/pkg/logger"
+)
+
+var mailboxLog = logger.Logger(Mailbox{})
+
+// ProcessedFlag marks ingested mails if no processed folder is configured.
+const ProcessedFlag = "$ScannerToolIngested"
+
+// FailedFlag marks mails that can never be ingested, e.g. because an
+// attachment is broken. They are left alone until the flag is removed.
+const FailedFlag = "$ScannerToolFailed"
+
+const (
+	SecurityTls      = "tls"
+	SecurityStartTls = "starttls"
+	SecurityNone     = "none"
+)
+
+// maxMailSize flags mails that are too large to hold in memory as failed.
+var maxMailSize uint32 = 64 << 20
+
+type MailboxOptions struct {
+	// Addr is the host and port of the IMAP server.
+	Addr string `yaml:"addr"`
+	// Security is "tls" (default), "starttls" or "none".
+	Security string `yaml:"security"`
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+	// Folder is polled for new mails, INBOX by default.
+	Folder string `yaml:"folder"`
+	// ProcessedFolder receives ingested mails. If it is empty, they are
+	// flagged instead.
+	ProcessedFolder string `yaml:"processedfolder"`
+	// PollInterval is how often the folder is checked, 1m by default.
+	PollInterval time.Duration `yaml:"pollinterval"`
+	Profile      string        `yaml:"profile"`
+	Tags         []string      `yaml:"tags"`
+}
+
+func (o MailboxOptions) Validate() error {
+	if o.Addr == "" {
+		return errors.New("mailbox needs an addr")
+	}
+	switch o.Security {
+	case "", SecurityTls, SecurityStartTls, SecurityNone:
+	default:
+		return fmt.Errorf("unknown mailbox security %q", o.Security)
+	}
+	if o.PollInterval < 0 {
+		return errors.New("poll interval must not be negative")
+	}
+	return nil
+}
+
+func (o MailboxOptions) folder() string {
+	if o.Folder == "" {
+		return "INBOX"
+	}
+	return o.Folder
+}
+
+func (o MailboxOptions) pollInterval() time.Duration {
+	if o.PollInterval == 0 {
+		return time.Minute
+	}
+	return o.PollInterval
+}
+
+// Mailbox ingests the attachments of mails in an IMAP folder.
+type Mailbox struct {
+	options  MailboxOptions
+	ingest   IngestFunc
+	stop     chan struct{}
+	wgClosed sync.WaitGroup
+}
+
+func NewMailbox(opts MailboxOptions, ingest IngestFunc) *Mailbox {
+	return &Mailbox{
+		options: opts,
+		ingest:  ingest,
+	}
+}
+
+func (m *Mailbox) Start() {
+	m.stop = make(chan struct{})
+	m.wgClosed.Add(1)
+	go m.run()
+}
+
+func (m *Mailbox) Stop() {
+	if m.stop == nil {
+		return
+	}
+	close(m.stop)
+	m.wgClosed.Wait()
+	m.stop = nil
+}
+
+// Source names the mailbox in bundle manifests.
+func (m *Mailbox) Source() string {
+	return fmt.Sprintf("imap:%s@%s/%s", m.options.Username, m.options.Addr, m.options.folder())
+}
+
+func (m *Mailbox) run() {
+	defer m.wgClosed.Done()
+
+	ticker := time.NewTicker(m.options.pollInterval())
+	defer ticker.Stop()
+	for {
+		err := m.Poll()
+		if err != nil {
+			mailboxLog.WithError(err).WithField("mailbox", m.Source()).Error("Failed to poll mailbox")
+		}
+
+		select {
+		case <-m.stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Poll ingests all mails that were not processed yet.
+func (m *Mailbox) Poll() error {
+	c, err := m.connect()
+	if err != nil {
+		return err
+	}
+	defer c.Logout()
+
+	_, err = c.Select(m.options.folder(), false)
+	if err != nil {
+		return err
+	}
+
+	criteria := imap.NewSearchCriteria()
+	criteria.WithoutFlags = []string{ProcessedFlag, FailedFlag, imap.DeletedFlag}
+	uids, err := c.UidSearch(criteria)
+	if err != nil || len(uids) == 0 {
+		return err
+	}
+
+	for _, uid := range uids {
+		err := m.processMail(c, uid)
+		if errors.Is(err, ErrUnsupportedFile) {
+			mailboxLog.WithError(err).WithField("mailbox", m.Source()).WithField("uid", uid).Error("Mail cannot be ingested, flagging it as failed")
+			err = c.UidStore(uidSet(uid), imap.FormatFlagsOp(imap.AddFlags, true), []interface{}{FailedFlag}, nil)
+		}
+		if err != nil {
+			// the mail stays unprocessed and is tried again on the next poll
+			mailboxLog.WithError(err).WithField("mailbox", m.Source()).WithField("uid", uid).Error("Failed to ingest mail")
+		}
+	}
+	return nil
+}
+
+func (m *Mailbox) connect() (*client.Client, error) {
+	var c *client.Client
+	var err error
+	if m.options.Security == "" || m.options.Security == SecurityTls {
+		c, err = client.DialTLS(m.options.Addr, nil)
+	} else {
+		c, err = client.Dial(m.options.Addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if m.options.Security == SecurityStartTls {
+		host, _, _ := strings.Cut(m.options.Addr, ":")
+		err = c.StartTLS(&tls.Config{ServerName: host})
+		if err != nil {
+			c.Logout()
+			return nil, err
+		}
+	}
+
+	err = c.Login(m.options.Username, m.options.Password)
+	if err != nil {
+		c.Logout()
+		return nil, err
+	}
+	return c, nil
+}
+
+func (m *Mailbox) processMail(c *client.Client, uid uint32) error {
+	// the size is checked before the mail is downloaded
+	msg, err := fetchMail(c, uid, imap.FetchRFC822Size)
+	if err != nil {
+		return err
+	}
+	if msg.Size > maxMailSize {
+		// the mail stays visible and can be ingested by hand
+		return fmt.Errorf("%w: mail is too large (%d bytes)", ErrUnsupportedFile, msg.Size)
+	}
+
+	section := &imap.BodySectionName{Peek: true}
+	msg, err = fetchMail(c, uid, section.FetchItem())
+	if err != nil {
+		return err
+	}
+	body := msg.GetBody(section)
+	if body == nil {
+		return fmt.Errorf("mail %d has no body", uid)
+	}
+
+	batch, err := m.parseMail(body)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrUnsupportedFile, err)
+	}
+
+	if len(batch.Files) == 0 {
+		mailboxLog.WithField("uid", uid).WithField("subject", batch.Title).Warn("Mail has no supported attachments, skipping it")
+		return m.markProcessed(c, uid)
+	}
+
+	err = m.ingest(batch)
+	if err != nil {
+		return err
+	}
+
+	mailboxLog.WithField("subject", batch.Title).WithField("from", batch.Correspondent).WithField("files", len(batch.Files)).Info("Ingested mail")
+	return m.markProcessed(c, uid)
+}
+
+func fetchMail(c *client.Client, uid uint32, item imap.FetchItem) (*imap.Message, error) {
+	messages := make(chan *imap.Message, 1)
+	err := c.UidFetch(uidSet(uid), []imap.FetchItem{item}, messages)
+	if err != nil {
+		return nil, err
+	}
+
+	msg := <-messages
+	if msg == nil {
+		return nil, fmt.Errorf("mail %d vanished", uid)
+	}
+	return msg, nil
+}
+
+// parseMail collects the supported attachments and takes title, sender and
+// date from the headers.
+func (m *Mailbox) parseMail(r io.Reader) (Batch, error) {
+	reader, err := mail.CreateReader(r)
+	if err != nil {
+		return Batch{}, err
+	}
+	defer reader.Close()
+
+	batch := Batch{
+		Source:  m.Source(),
+		Profile: m.options.Profile,
+		Tags:    m.options.Tags,
+	}
+	batch.Title, _ = reader.Header.Subject()
+	batch.Created, _ = reader.Header.Date()
+	if from, err := reader.Header.AddressList("From"); err == nil && len(from) > 0 {
+		batch.Correspondent = from[0].Name
+		if batch.Correspondent == "" {
+			batch.Correspondent = from[0].Address
+		}
+	}
+
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return Batch{}, err
+		}
+
+		header, ok := part.Header.(*mail.AttachmentHeader)
+		if !ok {
+			continue
+		}
+
+		fileName := attachmentName(header, len(batch.Files)+1)
+		if !slices.Contains(extensions, strings.ToLower(path.Ext(fileName))) {
+			continue
+		}
+
+		data, err := io.ReadAll(part.Body)
+		if err != nil {
+			return Batch{}, err
+		}
+		batch.Files = append(batch.Files, DataFile(fileName, data))
+	}
+
+	return batch, nil
+}
+
+// attachmentName falls back to the content type for attachments without a
+// file name.
+func attachmentName(header *mail.AttachmentHeader, index int) string {
+	fileName, _ := header.Filename()
+	if fileName != "" {
+		return path.Base(fileName)
+	}
+
+	contentType, _, _ := header.ContentType()
+	exts, _ := mime.ExtensionsByType(contentType)
+	for _, ext := range exts {
+		if slices.Contains(extensions, ext) {
+			return fmt.Sprintf("attachment-%d%s", index, ext)
+		}
+	}
+	return ""
+}
+
+func (m *Mailbox) markProcessed(c *client.Client, uid uint32) error {
+	if m.options.ProcessedFolder != "" {
+		return moveMail(c, uid, m.options.ProcessedFolder)
+	}
+
+	return c.UidStore(uidSet(uid), imap.FormatFlagsOp(imap.AddFlags, true), []interface{}{ProcessedFlag, imap.SeenFlag}, nil)
+}
+
+// moveMail falls back to copy and delete on servers without a working MOVE.
+func moveMail(c *client.Client, uid uint32, folder string) error {
+	if ok, _ := c.Support("MOVE"); ok {
+		err := c.UidMove(uidSet(uid), folder)
+		if err == nil {
+			return nil
+		}
+		mailboxLog.WithError(err).Debug("Failed to move mail, copying it instead")
+	}
+
+	return copyMail(c, uid, folder)
+}
+
+// copyMail deletes the original after copying it. Other mails marked as
+// deleted, e.g. by the mail client of the user, must not be expunged, so
+// without UIDPLUS the original stays flagged instead.
+func copyMail(c *client.Client, uid uint32, folder string) error {
+	err := c.UidCopy(uidSet(uid), folder)
+	if err != nil {
+		return err
+	}
+	err = c.UidStore(uidSet(uid), imap.FormatFlagsOp(imap.AddFlags, true), []interface{}{imap.DeletedFlag, ProcessedFlag}, nil)
+	if err != nil {
+		return err
+	}
+
+	if ok, _ := c.Support("UIDPLUS"); !ok {
+		return nil
+	}
+	status, err := c.Execute(&commands.Uid{Cmd: &imap.Command{Name: "EXPUNGE", Arguments: []interface{}{uidSet(uid)}}}, nil)
+	if err != nil {
+		return err
+	}
+	return status.Err()
+}
+
+func uidSet(uid uint32) *imap.SeqSet {
+	set := new(imap.SeqSet)
+	set.AddNum(uid)
+	return set
+}
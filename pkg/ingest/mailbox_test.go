@@ -0,0 +1,230 @@
+package ingest
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/backend/memory"
+	"github.com/emersion/go-imap/client"
+	"github.com/emersion/go-imap/server"
+	"github.com/stretchr/testify/assert"
+)
+
+// startTestImap serves an in-memory mailbox with the user "username" and the
+// password "password".
+func startTestImap(t *testing.T) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+
+	s := server.New(memory.New())
+	s.AllowInsecureAuth = true
+	go s.Serve(listener)
+	t.Cleanup(func() { s.Close() })
+
+	return listener.Addr().String()
+}
+
+func testImapClient(t *testing.T, addr string) *client.Client {
+	c, err := client.Dial(addr)
+	assert.NoError(t, err)
+	assert.NoError(t, c.Login("username", "password"))
+	t.Cleanup(func() { c.Logout() })
+	return c
+}
+
+func testMail(subject string, attachments map[string]string) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("From: Acme Billing <billing@acme.example>\r\n")
+	buf.WriteString("To: scans@example.org\r\n")
+	buf.WriteString("Subject: " + subject + "\r\n")
+	buf.WriteString("Date: Mon, 05 Oct 2026 10:00:00 +0000\r\n")
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: multipart/mixed; boundary=BOUNDARY\r\n\r\n")
+	buf.WriteString("--BOUNDARY\r\nContent-Type: text/plain\r\n\r\nPlease find attached.\r\n")
+	for fileName, content := range attachments {
+		buf.WriteString("--BOUNDARY\r\n")
+		buf.WriteString("Content-Type: application/octet-stream\r\n")
+		buf.WriteString("Content-Disposition: attachment; filename=\"" + fileName + "\"\r\n")
+		buf.WriteString("Content-Transfer-Encoding: base64\r\n\r\n")
+		buf.WriteString(base64.StdEncoding.EncodeToString([]byte(content)) + "\r\n")
+	}
+	buf.WriteString("--BOUNDARY--\r\n")
+	return buf.Bytes()
+}
+
+func appendTestMail(t *testing.T, c *client.Client, mail []byte) {
+	assert.NoError(t, c.Append("INBOX", nil, time.Now(), bytes.NewReader(mail)))
+}
+
+func searchFlagged(t *testing.T, c *client.Client, folder string) []uint32 {
+	_, err := c.Select(folder, true)
+	assert.NoError(t, err)
+	criteria := imap.NewSearchCriteria()
+	criteria.WithFlags = []string{ProcessedFlag}
+	uids, err := c.UidSearch(criteria)
+	assert.NoError(t, err)
+	return uids
+}
+
+func TestMailboxIngestsAttachments(t *testing.T) {
+	addr := startTestImap(t)
+	c := testImapClient(t, addr)
+	appendTestMail(t, c, testMail("Invoice 42", map[string]string{"invoice.pdf": "pdf data", "notes.txt": "ignored"}))
+
+	ingester := &testIngester{}
+	mailbox := NewMailbox(MailboxOptions{Addr: addr, Security: SecurityNone, Username: "username", Password: "password", Tags: []string{"mail"}}, ingester.ingest)
+	assert.NoError(t, mailbox.Poll())
+
+	batches := ingester.received()
+	if !assert.Len(t, batches, 1) {
+		return
+	}
+	batch := batches[0]
+	assert.Equal(t, "Invoice 42", batch.Title)
+	assert.Equal(t, "Acme Billing", batch.Correspondent)
+	assert.Equal(t, time.Date(2026, 10, 5, 10, 0, 0, 0, time.UTC), batch.Created.UTC())
+	assert.Equal(t, []string{"mail"}, batch.Tags)
+	assert.Equal(t, "imap:username@"+addr+"/INBOX", batch.Source)
+	assert.Equal(t, []string{"invoice.pdf"}, fileNames(batch.Files))
+	assert.Equal(t, "pdf data", ingester.content("invoice.pdf"))
+
+	// the mail with the attachment and the text mail of the fake server
+	assert.Len(t, searchFlagged(t, c, "INBOX"), 2)
+
+	assert.NoError(t, mailbox.Poll())
+	assert.Len(t, ingester.received(), 1)
+}
+
+func TestMailboxKeepsMailOnError(t *testing.T) {
+	addr := startTestImap(t)
+	c := testImapClient(t, addr)
+	appendTestMail(t, c, testMail("Receipt", map[string]string{"receipt.jpg": "jpg data"}))
+
+	ingester := &testIngester{err: assert.AnError}
+	mailbox := NewMailbox(MailboxOptions{Addr: addr, Security: SecurityNone, Username: "username", Password: "password"}, ingester.ingest)
+	assert.NoError(t, mailbox.Poll())
+	assert.Len(t, searchFlagged(t, c, "INBOX"), 1)
+
+	ingester.err = nil
+	assert.NoError(t, mailbox.Poll())
+	assert.Len(t, ingester.received(), 1)
+}
+
+func TestMailboxFlagsFailedMails(t *testing.T) {
+	addr := startTestImap(t)
+	c := testImapClient(t, addr)
+	appendTestMail(t, c, testMail("Broken", map[string]string{"broken.pdf": "no pdf"}))
+
+	ingester := &testIngester{err: fmt.Errorf("%w: broken.pdf", ErrUnsupportedFile)}
+	mailbox := NewMailbox(MailboxOptions{Addr: addr, Security: SecurityNone, Username: "username", Password: "password"}, ingester.ingest)
+	assert.NoError(t, mailbox.Poll())
+
+	_, err := c.Select("INBOX", true)
+	assert.NoError(t, err)
+	criteria := imap.NewSearchCriteria()
+	criteria.WithFlags = []string{FailedFlag}
+	uids, err := c.UidSearch(criteria)
+	assert.NoError(t, err)
+	assert.Len(t, uids, 1)
+
+	// the mail is not tried again
+	ingester.err = nil
+	assert.NoError(t, mailbox.Poll())
+	assert.Empty(t, ingester.received())
+}
+
+func TestMailboxFlagsTooLargeMails(t *testing.T) {
+	oldMaxMailSize := maxMailSize
+	maxMailSize = 1000
+	t.Cleanup(func() { maxMailSize = oldMaxMailSize })
+
+	addr := startTestImap(t)
+	c := testImapClient(t, addr)
+	appendTestMail(t, c, testMail("Scans", map[string]string{"scans.pdf": strings.Repeat("pdf", 1000)}))
+
+	ingester := &testIngester{}
+	mailbox := NewMailbox(MailboxOptions{Addr: addr, Security: SecurityNone, Username: "username", Password: "password"}, ingester.ingest)
+	assert.NoError(t, mailbox.Poll())
+	assert.Empty(t, ingester.received())
+
+	_, err := c.Select("INBOX", true)
+	assert.NoError(t, err)
+	criteria := imap.NewSearchCriteria()
+	criteria.WithFlags = []string{FailedFlag}
+	failed, err := c.UidSearch(criteria)
+	assert.NoError(t, err)
+	assert.Len(t, failed, 1)
+	criteria.WithFlags = []string{ProcessedFlag}
+	processed, err := c.UidSearch(criteria)
+	assert.NoError(t, err)
+	assert.NotContains(t, processed, failed[0])
+}
+
+func TestCopyMailKeepsOtherDeletedMails(t *testing.T) {
+	addr := startTestImap(t)
+	c := testImapClient(t, addr)
+	assert.NoError(t, c.Create("Scanned"))
+	appendTestMail(t, c, testMail("Invoice", map[string]string{"invoice.pdf": "pdf"}))
+
+	_, err := c.Select("INBOX", false)
+	assert.NoError(t, err)
+	uids, err := c.UidSearch(imap.NewSearchCriteria())
+	assert.NoError(t, err)
+	if !assert.Len(t, uids, 2) {
+		return
+	}
+	// the user deleted the first mail, but did not expunge it yet
+	assert.NoError(t, c.UidStore(uidSet(uids[0]), imap.FormatFlagsOp(imap.AddFlags, true), []interface{}{imap.DeletedFlag}, nil))
+
+	assert.NoError(t, copyMail(c, uids[1], "Scanned"))
+
+	status, err := c.Status("Scanned", []imap.StatusItem{imap.StatusMessages})
+	assert.NoError(t, err)
+	assert.Equal(t, uint32(1), status.Messages)
+	remaining, err := c.UidSearch(imap.NewSearchCriteria())
+	assert.NoError(t, err)
+	assert.Equal(t, uids, remaining)
+}
+
+func TestMailboxMovesProcessedMails(t *testing.T) {
+	addr := startTestImap(t)
+	c := testImapClient(t, addr)
+	assert.NoError(t, c.Create("Scanned"))
+	appendTestMail(t, c, testMail("Contract", map[string]string{"page1.png": "1", "page2.png": "2"}))
+
+	ingester := &testIngester{}
+	mailbox := NewMailbox(MailboxOptions{Addr: addr, Security: SecurityNone, Username: "username", Password: "password", ProcessedFolder: "Scanned"}, ingester.ingest)
+	assert.NoError(t, mailbox.Poll())
+	assert.Len(t, ingester.received(), 1)
+
+	// the fake server has neither MOVE nor UIDPLUS, the originals stay
+	// marked as deleted
+	_, err := c.Select("INBOX", true)
+	assert.NoError(t, err)
+	criteria := imap.NewSearchCriteria()
+	criteria.WithoutFlags = []string{imap.DeletedFlag}
+	uids, err := c.UidSearch(criteria)
+	assert.NoError(t, err)
+	assert.Empty(t, uids)
+	status, err := c.Status("Scanned", []imap.StatusItem{imap.StatusMessages})
+	assert.NoError(t, err)
+	assert.Equal(t, uint32(2), status.Messages)
+}
+
+func TestMailboxLoginFails(t *testing.T) {
+	addr := startTestImap(t)
+	mailbox := NewMailbox(MailboxOptions{Addr: addr, Security: SecurityNone, Username: "username", Password: "wrong"}, (&testIngester{}).ingest)
+	assert.Error(t, mailbox.Poll())
+}
+
+func TestMailboxOptionsValidate(t *testing.T) {
+	assert.NoError(t, MailboxOptions{Addr: "imap.example.org:993"}.Validate())
+	assert.Error(t, MailboxOptions{}.Validate())
+	assert.Error(t, MailboxOptions{Addr: "imap.example.org:993", Security: "ssl"}.Validate())
+}
@@ -0,0 +1,410 @@
+package ingest
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/schidstorm/scanner-tool/pkg/logger"
+)
+
+var log = logger.Logger(Watcher{})
+
+// checkInterval is how often pending files are checked for stability.
+var checkInterval = time.Second
+
+// retryWait is how long a batch that failed to ingest stays untouched.
+var retryWait = time.Minute
+
+const (
+	GroupFile   = "file"
+	GroupFolder = "folder"
+)
+
+// extensions are the file types that are ingested, everything else in a
+// watched folder is ignored.
+var extensions = []string{".png", ".jpg", ".jpeg", ".tif", ".tiff", ".pdf"}
+
+// temporarySuffixes are used by browsers, editors and copy tools for files
+// that are still being written.
+var temporarySuffixes = []string{".part", ".partial", ".tmp", ".crdownload", ".swp", ".filepart"}
+
+type WatchFolderOptions struct {
+	Dir string `yaml:"dir"`
+	// Group is "file" (default) to make a bundle of every file, or "folder"
+	// to make one bundle of every sub-folder. Files directly in Dir are
+	// always ingested one by one.
+	Group string `yaml:"group"`
+	// StableFor is how long size and modification time of a file must not
+	// change before it is ingested, 5s by default.
+	StableFor time.Duration `yaml:"stablefor"`
+	// ProcessedDir receives ingested files. They are deleted if it is empty.
+	ProcessedDir string `yaml:"processeddir"`
+	// Profile is recorded as the scan profile of the bundles.
+	Profile string   `yaml:"profile"`
+	Tags    []string `yaml:"tags"`
+}
+
+func (o WatchFolderOptions) Validate() error {
+	if o.Dir == "" {
+		return errors.New("watch folder needs a dir")
+	}
+	switch o.Group {
+	case "", GroupFile, GroupFolder:
+	default:
+		return fmt.Errorf("unknown watch folder group %q", o.Group)
+	}
+	if o.StableFor < 0 {
+		return errors.New("stable duration must not be negative")
+	}
+	return nil
+}
+
+func (o WatchFolderOptions) stableFor() time.Duration {
+	if o.StableFor == 0 {
+		return 5 * time.Second
+	}
+	return o.StableFor
+}
+
+type fileState struct {
+	size    int64
+	modTime time.Time
+	// since is when the file was last seen changing.
+	since time.Time
+	// rejected files are not ingested again until they change.
+	rejected bool
+}
+
+// Watcher ingests files that are dropped into a folder, once they stopped
+// changing.
+type Watcher struct {
+	options  WatchFolderOptions
+	ingest   IngestFunc
+	dir      string
+	notify   *fsnotify.Watcher
+	files    map[string]*fileState
+	failed   map[string]time.Time
+	stop     chan struct{}
+	wgClosed sync.WaitGroup
+}
+
+func NewWatcher(opts WatchFolderOptions, ingest IngestFunc) *Watcher {
+	return &Watcher{
+		options: opts,
+		ingest:  ingest,
+		files:   make(map[string]*fileState),
+		failed:  make(map[string]time.Time),
+	}
+}
+
+func (w *Watcher) Start() error {
+	dir, err := filepath.Abs(w.options.Dir)
+	if err != nil {
+		return err
+	}
+	w.dir = dir
+
+	err = os.MkdirAll(w.dir, 0755)
+	if err != nil {
+		return err
+	}
+
+	w.notify, err = fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+
+	err = w.rescan()
+	if err != nil {
+		w.notify.Close()
+		return err
+	}
+
+	w.stop = make(chan struct{})
+	w.wgClosed.Add(1)
+	go w.run()
+	return nil
+}
+
+func (w *Watcher) Stop() {
+	if w.stop == nil {
+		return
+	}
+	close(w.stop)
+	w.wgClosed.Wait()
+	w.notify.Close()
+	w.stop = nil
+}
+
+// Source names the watched folder in bundle manifests.
+func (w *Watcher) Source() string {
+	return "watch:" + w.options.Dir
+}
+
+func (w *Watcher) run() {
+	defer w.wgClosed.Done()
+
+	ticker := time.NewTicker(checkInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-w.stop:
+			return
+		case event, ok := <-w.notify.Events:
+			if !ok {
+				return
+			}
+			w.handleEvent(event)
+		case err, ok := <-w.notify.Errors:
+			if !ok {
+				return
+			}
+			// events may have been lost, look at everything again
+			log.WithError(err).WithField("dir", w.dir).Warn("Watch folder error, rescanning")
+			w.rescan()
+		case <-ticker.C:
+			w.ingestStable(time.Now())
+		}
+	}
+}
+
+func (w *Watcher) handleEvent(event fsnotify.Event) {
+	if w.isIgnored(event.Name) {
+		return
+	}
+
+	info, err := os.Stat(event.Name)
+	if err != nil {
+		delete(w.files, event.Name)
+		return
+	}
+
+	if info.IsDir() {
+		if filepath.Dir(event.Name) == w.dir {
+			w.watchDir(event.Name)
+		}
+		return
+	}
+
+	w.observe(event.Name, info, time.Now())
+}
+
+// rescan watches the folder and its sub-folders and picks up all files in
+// them. Deeper folders are not watched.
+func (w *Watcher) rescan() error {
+	err := w.watchDir(w.dir)
+	if err != nil {
+		return err
+	}
+
+	entries, err := os.ReadDir(w.dir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		entryPath := filepath.Join(w.dir, entry.Name())
+		if entry.IsDir() && !w.isIgnored(entryPath) {
+			w.watchDir(entryPath)
+		}
+	}
+	return nil
+}
+
+func (w *Watcher) watchDir(dir string) error {
+	err := w.notify.Add(dir)
+	if err != nil {
+		log.WithError(err).WithField("dir", dir).Warn("Failed to watch folder")
+		return err
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		filePath := filepath.Join(dir, entry.Name())
+		if entry.IsDir() || w.isIgnored(filePath) {
+			continue
+		}
+		info, err := entry.Info()
+		if err == nil {
+			w.observe(filePath, info, time.Now())
+		}
+	}
+	return nil
+}
+
+func (w *Watcher) observe(filePath string, info os.FileInfo, now time.Time) {
+	state, ok := w.files[filePath]
+	if ok && state.size == info.Size() && state.modTime.Equal(info.ModTime()) {
+		return
+	}
+	w.files[filePath] = &fileState{size: info.Size(), modTime: info.ModTime(), since: now}
+}
+
+func (w *Watcher) isIgnored(filePath string) bool {
+	name := filepath.Base(filePath)
+	if strings.HasPrefix(name, ".") || strings.HasPrefix(name, "~") {
+		return true
+	}
+	for _, suffix := range temporarySuffixes {
+		if strings.HasSuffix(strings.ToLower(name), suffix) {
+			return true
+		}
+	}
+	if w.options.ProcessedDir != "" {
+		processedDir, err := filepath.Abs(w.options.ProcessedDir)
+		if err == nil && (filePath == processedDir || strings.HasPrefix(filePath, processedDir+string(filepath.Separator))) {
+			return true
+		}
+	}
+	return false
+}
+
+// ingestStable ingests all batches whose files did not change for the
+// configured duration.
+func (w *Watcher) ingestStable(now time.Time) {
+	batches := make(map[string][]string)
+	for filePath := range w.files {
+		info, err := os.Stat(filePath)
+		if err != nil {
+			delete(w.files, filePath)
+			continue
+		}
+		w.observe(filePath, info, now)
+		state := w.files[filePath]
+		if state.rejected {
+			continue
+		}
+
+		key := w.batchKey(filePath)
+		if now.Sub(state.since) < w.options.stableFor() {
+			// a folder is only ingested once all of its files are stable
+			batches[key] = nil
+			continue
+		}
+		if existing, ok := batches[key]; ok && existing == nil {
+			continue
+		}
+		batches[key] = append(batches[key], filePath)
+	}
+
+	for key, files := range batches {
+		if len(files) == 0 || now.Before(w.failed[key]) {
+			continue
+		}
+
+		slices.Sort(files)
+		err := w.ingestBatch(key, files)
+		if errors.Is(err, ErrUnsupportedFile) {
+			log.WithError(err).WithField("batch", key).Error("Failed to ingest, keeping the files until they change")
+			for _, filePath := range files {
+				w.files[filePath].rejected = true
+			}
+			delete(w.failed, key)
+			continue
+		}
+		if err != nil {
+			log.WithError(err).WithField("batch", key).Error("Failed to ingest, retrying later")
+			w.failed[key] = now.Add(retryWait)
+			continue
+		}
+		delete(w.failed, key)
+	}
+}
+
+// batchKey is the path of the file itself or of the sub-folder it is grouped
+// by.
+func (w *Watcher) batchKey(filePath string) string {
+	dir := filepath.Dir(filePath)
+	if w.options.Group == GroupFolder && dir != w.dir {
+		return dir
+	}
+	return filePath
+}
+
+func (w *Watcher) ingestBatch(key string, files []string) error {
+	var accepted []string
+	for _, filePath := range files {
+		if slices.Contains(extensions, strings.ToLower(filepath.Ext(filePath))) {
+			accepted = append(accepted, filePath)
+		}
+	}
+
+	if len(accepted) == 0 {
+		for _, filePath := range files {
+			delete(w.files, filePath)
+		}
+		log.WithField("batch", key).Warn("Ignoring files of unsupported type")
+		return nil
+	}
+
+	batch := Batch{
+		Source:  w.Source(),
+		Profile: w.options.Profile,
+		Title:   strings.TrimSuffix(filepath.Base(key), filepath.Ext(key)),
+		Tags:    w.options.Tags,
+	}
+	for _, filePath := range accepted {
+		batch.Files = append(batch.Files, PathFile(filepath.Base(filePath), filePath))
+	}
+
+	err := w.ingest(batch)
+	if err != nil {
+		return err
+	}
+
+	log.WithField("batch", key).WithField("files", len(accepted)).Info("Ingested")
+	for _, filePath := range files {
+		delete(w.files, filePath)
+	}
+	return w.finish(key, accepted)
+}
+
+// finish removes ingested files from the watched folder, moving them to the
+// processed folder if one is configured.
+func (w *Watcher) finish(key string, files []string) error {
+	for _, filePath := range files {
+		var err error
+		if w.options.ProcessedDir == "" {
+			err = os.Remove(filePath)
+		} else {
+			err = w.moveProcessed(filePath)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if key != files[0] {
+		// the folder is left if it still contains ignored files
+		os.Remove(key)
+	}
+	return nil
+}
+
+func (w *Watcher) moveProcessed(filePath string) error {
+	relPath, err := filepath.Rel(w.dir, filePath)
+	if err != nil {
+		return err
+	}
+
+	target := filepath.Join(w.options.ProcessedDir, relPath)
+	if _, err := os.Stat(target); err == nil {
+		ext := filepath.Ext(target)
+		target = fmt.Sprintf("%s-%d%s", strings.TrimSuffix(target, ext), time.Now().UnixNano(), ext)
+	}
+
+	err = os.MkdirAll(filepath.Dir(target), 0755)
+	if err != nil {
+		return err
+	}
+	return os.Rename(filePath, target)
+}
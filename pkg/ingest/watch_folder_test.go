@@ -0,0 +1,222 @@
+package ingest
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testIngester struct {
+	mutex   sync.Mutex
+	batches []Batch
+	// contents of the files by name, they are read while the batch is
+	// ingested like the server does
+	contents map[string]string
+	err      error
+	attempts int
+}
+
+func (i *testIngester) ingest(batch Batch) error {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	i.attempts++
+	if i.err != nil {
+		return i.err
+	}
+	if i.contents == nil {
+		i.contents = make(map[string]string)
+	}
+	for _, file := range batch.Files {
+		r, err := file.Open()
+		if err != nil {
+			return err
+		}
+		data, err := io.ReadAll(r)
+		r.Close()
+		if err != nil {
+			return err
+		}
+		i.contents[file.Name] = string(data)
+	}
+	i.batches = append(i.batches, batch)
+	return nil
+}
+
+func (i *testIngester) content(name string) string {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	return i.contents[name]
+}
+
+func fileNames(files []File) []string {
+	var names []string
+	for _, file := range files {
+		names = append(names, file.Name)
+	}
+	return names
+}
+
+func (i *testIngester) received() []Batch {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	return append([]Batch(nil), i.batches...)
+}
+
+func startTestWatcher(t *testing.T, opts WatchFolderOptions) *testIngester {
+	oldCheckInterval := checkInterval
+	checkInterval = 10 * time.Millisecond
+	t.Cleanup(func() { checkInterval = oldCheckInterval })
+
+	ingester := &testIngester{}
+	watcher := NewWatcher(opts, ingester.ingest)
+	assert.NoError(t, watcher.Start())
+	t.Cleanup(watcher.Stop)
+	return ingester
+}
+
+func TestWatcherIngestsStableFiles(t *testing.T) {
+	dir := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "existing.pdf"), []byte("pdf"), 0644))
+
+	ingester := startTestWatcher(t, WatchFolderOptions{Dir: dir, StableFor: 50 * time.Millisecond, Profile: "receipts", Tags: []string{"phone"}})
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "new.jpg"), []byte("jpg"), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "download.pdf.part"), []byte("pdf"), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, ".hidden.png"), []byte("png"), 0644))
+
+	assert.Eventually(t, func() bool {
+		return len(ingester.received()) == 2
+	}, 2*time.Second, 10*time.Millisecond)
+
+	batches := ingester.received()
+	titles := []string{batches[0].Title, batches[1].Title}
+	assert.ElementsMatch(t, []string{"existing", "new"}, titles)
+	assert.Len(t, batches[0].Files, 1)
+	assert.Equal(t, "watch:"+dir, batches[0].Source)
+	assert.Equal(t, "receipts", batches[0].Profile)
+	assert.Equal(t, []string{"phone"}, batches[0].Tags)
+
+	assert.Eventually(t, func() bool {
+		_, err := os.Stat(filepath.Join(dir, "new.jpg"))
+		return os.IsNotExist(err)
+	}, 2*time.Second, 10*time.Millisecond)
+	assert.FileExists(t, filepath.Join(dir, "download.pdf.part"))
+	assert.FileExists(t, filepath.Join(dir, ".hidden.png"))
+}
+
+func TestWatcherWaitsForGrowingFiles(t *testing.T) {
+	dir := t.TempDir()
+	ingester := startTestWatcher(t, WatchFolderOptions{Dir: dir, StableFor: 200 * time.Millisecond})
+
+	filePath := filepath.Join(dir, "scan.png")
+	f, err := os.Create(filePath)
+	assert.NoError(t, err)
+	for i := 0; i < 5; i++ {
+		f.Write([]byte("data"))
+		time.Sleep(60 * time.Millisecond)
+		assert.Empty(t, ingester.received())
+	}
+	f.Close()
+
+	assert.Eventually(t, func() bool {
+		return len(ingester.received()) == 1
+	}, 2*time.Second, 10*time.Millisecond)
+}
+
+func TestWatcherGroupsFolders(t *testing.T) {
+	dir := t.TempDir()
+	processedDir := filepath.Join(dir, "processed")
+	ingester := startTestWatcher(t, WatchFolderOptions{Dir: dir, Group: GroupFolder, StableFor: 50 * time.Millisecond, ProcessedDir: processedDir})
+
+	batchDir := filepath.Join(dir, "contract")
+	assert.NoError(t, os.Mkdir(batchDir, 0755))
+	// give the watcher time to watch the new folder
+	time.Sleep(20 * time.Millisecond)
+	assert.NoError(t, os.WriteFile(filepath.Join(batchDir, "page2.png"), []byte("2"), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(batchDir, "page1.png"), []byte("1"), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(batchDir, "notes.txt"), []byte("ignored"), 0644))
+
+	assert.Eventually(t, func() bool {
+		return len(ingester.received()) == 1
+	}, 2*time.Second, 10*time.Millisecond)
+
+	batch := ingester.received()[0]
+	assert.Equal(t, "contract", batch.Title)
+	assert.Equal(t, []string{"page1.png", "page2.png"}, fileNames(batch.Files))
+	assert.Equal(t, "1", ingester.content("page1.png"))
+	assert.Equal(t, "2", ingester.content("page2.png"))
+
+	assert.Eventually(t, func() bool {
+		_, err := os.Stat(filepath.Join(processedDir, "contract", "page1.png"))
+		return err == nil
+	}, 2*time.Second, 10*time.Millisecond)
+	assert.FileExists(t, filepath.Join(processedDir, "contract", "page2.png"))
+	assert.FileExists(t, filepath.Join(batchDir, "notes.txt"))
+	assert.Len(t, ingester.received(), 1)
+}
+
+func TestWatcherKeepsFilesOnError(t *testing.T) {
+	oldRetryWait := retryWait
+	retryWait = 50 * time.Millisecond
+	t.Cleanup(func() { retryWait = oldRetryWait })
+
+	dir := t.TempDir()
+	ingester := startTestWatcher(t, WatchFolderOptions{Dir: dir, StableFor: 20 * time.Millisecond})
+	ingester.mutex.Lock()
+	ingester.err = errors.New("queue full")
+	ingester.mutex.Unlock()
+
+	filePath := filepath.Join(dir, "invoice.pdf")
+	assert.NoError(t, os.WriteFile(filePath, []byte("pdf"), 0644))
+	time.Sleep(200 * time.Millisecond)
+	assert.FileExists(t, filePath)
+
+	ingester.mutex.Lock()
+	ingester.err = nil
+	ingester.mutex.Unlock()
+
+	assert.Eventually(t, func() bool {
+		return len(ingester.received()) == 1
+	}, 2*time.Second, 10*time.Millisecond)
+}
+
+func TestWatcherKeepsUnsupportedFilesUntilTheyChange(t *testing.T) {
+	oldRetryWait := retryWait
+	retryWait = 10 * time.Millisecond
+	t.Cleanup(func() { retryWait = oldRetryWait })
+
+	dir := t.TempDir()
+	ingester := startTestWatcher(t, WatchFolderOptions{Dir: dir, StableFor: 20 * time.Millisecond})
+	ingester.mutex.Lock()
+	ingester.err = fmt.Errorf("%w: broken pdf", ErrUnsupportedFile)
+	ingester.mutex.Unlock()
+
+	filePath := filepath.Join(dir, "invoice.pdf")
+	assert.NoError(t, os.WriteFile(filePath, []byte("broken"), 0644))
+	time.Sleep(200 * time.Millisecond)
+	assert.FileExists(t, filePath)
+	ingester.mutex.Lock()
+	assert.Equal(t, 1, ingester.attempts)
+	ingester.err = nil
+	ingester.mutex.Unlock()
+
+	// a repaired file is ingested
+	assert.NoError(t, os.WriteFile(filePath, []byte("repaired pdf"), 0644))
+	assert.Eventually(t, func() bool {
+		return len(ingester.received()) == 1
+	}, 2*time.Second, 10*time.Millisecond)
+	assert.Equal(t, "repaired pdf", ingester.content("invoice.pdf"))
+}
+
+func TestWatchFolderOptionsValidate(t *testing.T) {
+	assert.NoError(t, WatchFolderOptions{Dir: "in"}.Validate())
+	assert.Error(t, WatchFolderOptions{}.Validate())
+	assert.Error(t, WatchFolderOptions{Dir: "in", Group: "day"}.Validate())
+	assert.Error(t, WatchFolderOptions{Dir: "in", StableFor: -time.Second}.Validate())
+}
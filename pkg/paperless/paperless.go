@@ -17,6 +17,7 @@ import (
 var httpClientTimeout = 1 * time.Hour
 var postDocumentUrl = "/api/documents/post_document/"
 var tagsUrl = "/api/tags/"
+var correspondentsUrl = "/api/correspondents/"
 
 type addHeaderTransport struct {
 	T       http.RoundTripper
@@ -37,8 +38,10 @@ type Paperless struct {
 }
 
 type UploadOptions struct {
-	Title               string
-	Created             *time.Time
+	Title   string
+	Created *time.Time
+	// Correspondent is the name of the correspondent, it is created if it
+	// does not exist.
 	Correspondent       *string
 	DocumentType        *string
 	StoragePath         *string
@@ -82,65 +85,52 @@ func (p *Paperless) Upload(file io.Reader, options UploadOptions) error {
 		tagIds = append(tagIds, tagId)
 	}
 
-	var multipartBuffer bytes.Buffer
-	multipartWriter := multipart.NewWriter(&multipartBuffer)
-
-	var errs []error
-	errs = append(errs, addField(multipartWriter, "title", options.Title))
+	fields := []formField{{"title", options.Title}}
 	if options.Created != nil {
-		errs = append(errs, addField(multipartWriter, "created", options.Created.Format(time.RFC3339)))
+		fields = append(fields, formField{"created", options.Created.Format(time.RFC3339)})
 	}
 	if options.Correspondent != nil {
-		errs = append(errs, addField(multipartWriter, "correspondent", *options.Correspondent))
+		correspondentId, err := p.createCorrespondentIfNotExist(*options.Correspondent)
+		if err != nil {
+			return fmt.Errorf("failed to create correspondent %s: %v", *options.Correspondent, err)
+		}
+		fields = append(fields, formField{"correspondent", strconv.Itoa(correspondentId)})
 	}
 	if options.DocumentType != nil {
-		errs = append(errs, addField(multipartWriter, "document_type", *options.DocumentType))
+		fields = append(fields, formField{"document_type", *options.DocumentType})
 	}
 	if options.StoragePath != nil {
-		errs = append(errs, addField(multipartWriter, "storage_path", *options.StoragePath))
-
+		fields = append(fields, formField{"storage_path", *options.StoragePath})
 	}
 	if options.ArchiveSerialNumber != nil {
-		errs = append(errs, addField(multipartWriter, "archive_serial_number", *options.ArchiveSerialNumber))
-	}
-	if len(options.Tags) > 0 {
-		for _, tag := range tagIds {
-			errs = append(errs, addField(multipartWriter, "tags", strconv.Itoa(tag)))
-		}
-	}
-	for _, err := range errs {
-		if err != nil {
-			return err
-		}
-	}
-
-	h := make(textproto.MIMEHeader)
-	h.Set("Content-Disposition",
-		fmt.Sprintf(`form-data; name="%s"; filename="%s"`,
-			escapeQuotes("document"), escapeQuotes(options.Title)))
-	h.Set("Content-Type", "application/pdf")
-	documentFormFile, err := multipartWriter.CreatePart(h)
-	if err != nil {
-		return err
-	}
-
-	_, err = io.Copy(documentFormFile, file)
-	if err != nil {
-		return err
-	}
-	multipartWriter.Close()
-
-	// Now that you have a form, you can submit it to your handler.
-	req, err := http.NewRequest("POST", p.baseUrl+postDocumentUrl, &multipartBuffer)
+		fields = append(fields, formField{"archive_serial_number", *options.ArchiveSerialNumber})
+	}
+	for _, tag := range tagIds {
+		fields = append(fields, formField{"tags", strconv.Itoa(tag)})
+	}
+
+	// The form is streamed into the request, so the document is never held
+	// in memory as a whole.
+	bodyReader, bodyWriter := io.Pipe()
+	multipartWriter := multipart.NewWriter(bodyWriter)
+	formWritten := make(chan struct{})
+	go func() {
+		defer close(formWritten)
+		bodyWriter.CloseWithError(writeUploadForm(multipartWriter, fields, options.Title, file))
+	}()
+	// file must not be read anymore once Upload returns.
+	defer func() {
+		bodyReader.Close()
+		<-formWritten
+	}()
+
+	req, err := http.NewRequest("POST", p.baseUrl+postDocumentUrl, bodyReader)
 	if err != nil {
 		return err
 	}
 	// Don't forget to set the content type, this will contain the boundary.
 	req.Header.Set("Content-Type", multipartWriter.FormDataContentType())
 
-	// Set the authorization header
-	// req.Header.Set("Authorization", "Token "+p.token)
-
 	// Submit the request
 	res, err := p.httpClient.Do(req)
 	if err != nil {
@@ -165,6 +155,37 @@ func (p *Paperless) Upload(file io.Reader, options UploadOptions) error {
 	return nil
 }
 
+type formField struct {
+	name  string
+	value string
+}
+
+func writeUploadForm(multipartWriter *multipart.Writer, fields []formField, title string, file io.Reader) error {
+	for _, field := range fields {
+		err := addField(multipartWriter, field.name, field.value)
+		if err != nil {
+			return err
+		}
+	}
+
+	h := make(textproto.MIMEHeader)
+	h.Set("Content-Disposition",
+		fmt.Sprintf(`form-data; name="%s"; filename="%s"`,
+			escapeQuotes("document"), escapeQuotes(title)))
+	h.Set("Content-Type", "application/pdf")
+	documentFormFile, err := multipartWriter.CreatePart(h)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(documentFormFile, file)
+	if err != nil {
+		return err
+	}
+
+	return multipartWriter.Close()
+}
+
 type tagResult struct {
 	ID   int    `json:"id"`
 	Name string `json:"name"`
@@ -312,6 +333,58 @@ func (p *Paperless) createTagIfNotExist(tag string) (int, error) {
 
 }
 
+type correspondentResult struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+type getCorrespondentsResult struct {
+	Results []correspondentResult `json:"results"`
+}
+
+func (p *Paperless) createCorrespondentIfNotExist(name string) (int, error) {
+	u := url.URL{Path: correspondentsUrl}
+	query := u.Query()
+	query.Set("name__iexact", name)
+	u.RawQuery = query.Encode()
+
+	var correspondents getCorrespondentsResult
+	err := p.apiCallParsed("GET", u, nil, &correspondents)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get correspondents: %v", err)
+	}
+	for _, correspondent := range correspondents.Results {
+		if correspondent.ID != 0 && strings.EqualFold(correspondent.Name, name) {
+			return correspondent.ID, nil
+		}
+	}
+
+	data, err := json.Marshal(map[string]string{"name": name})
+	if err != nil {
+		return 0, err
+	}
+	res, err := p.httpClient.Post(p.baseUrl+correspondentsUrl, "application/json", bytes.NewReader(data))
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusCreated {
+		body, _ := io.ReadAll(res.Body)
+		return 0, fmt.Errorf("bad status: %s, body: %s", res.Status, string(body))
+	}
+
+	var created correspondentResult
+	err = json.NewDecoder(res.Body).Decode(&created)
+	if err != nil {
+		return 0, err
+	}
+	if created.ID == 0 {
+		return 0, fmt.Errorf("correspondent not created")
+	}
+	return created.ID, nil
+}
+
 func addField(mw *multipart.Writer, fieldname, value string) error {
 	w, err := mw.CreateFormField(fieldname)
 	if err != nil {
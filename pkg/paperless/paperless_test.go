@@ -0,0 +1,55 @@
+package paperless
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUploadStreamsDocument(t *testing.T) {
+	var title, document string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, postDocumentUrl, r.URL.Path)
+		assert.Equal(t, "Token secret", r.Header.Get("Authorization"))
+
+		reader, err := r.MultipartReader()
+		assert.NoError(t, err)
+		for {
+			part, err := reader.NextPart()
+			if err == io.EOF {
+				break
+			}
+			assert.NoError(t, err)
+
+			data, _ := io.ReadAll(part)
+			switch part.FormName() {
+			case "title":
+				title = string(data)
+			case "document":
+				document = string(data)
+			}
+		}
+	}))
+	defer server.Close()
+
+	p := NewPaperless(server.URL+"/", "secret")
+	err := p.Upload(strings.NewReader("%PDF-1.4"), UploadOptions{Title: "invoice"})
+	assert.NoError(t, err)
+	assert.Equal(t, "invoice", title)
+	assert.Equal(t, "%PDF-1.4", document)
+}
+
+func TestUploadFailsOnBadStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "nope", http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	p := NewPaperless(server.URL, "secret")
+	err := p.Upload(strings.NewReader("%PDF-1.4"), UploadOptions{Title: "invoice"})
+	assert.ErrorContains(t, err, "nope")
+}
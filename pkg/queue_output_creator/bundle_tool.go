@@ -0,0 +1,174 @@
+package queueoutputcreator
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/schidstorm/scanner-tool/pkg/encryption"
+	"github.com/schidstorm/scanner-tool/pkg/filequeue"
+)
+
+// OpenBundle opens a bundle file or directory outside of a queue. The
+// returned closer releases the underlying file.
+func OpenBundle(bundlePath string, cipher *encryption.Cipher) (QueueZipFileReader, io.Closer, error) {
+	queueFile, err := filequeue.OpenBundle(bundlePath, cipher)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	reader, err := CreateZipFileReader(queueFile)
+	if err != nil {
+		queueFile.Close()
+		return nil, nil, err
+	}
+
+	return reader, queueFile, nil
+}
+
+// CopyBundle copies all files and the manifest of reader into writer.
+func CopyBundle(reader QueueZipFileReader, writer QueueZipFileWriter) error {
+	for _, fileName := range reader.FileNames() {
+		f, err := reader.GetFile(fileName)
+		if err != nil {
+			return err
+		}
+
+		rc, err := f.Open()
+		if err != nil {
+			return err
+		}
+		writer.AddFileReader(fileName, rc)
+		rc.Close()
+		if writer.Error() != nil {
+			return writer.Error()
+		}
+	}
+
+	copyManifest(reader.Manifest(), writer.Manifest())
+	return nil
+}
+
+// copyManifest copies identity, properties and history from src to dst.
+// File entries are matched by name, checksums are left to the writer.
+func copyManifest(src, dst *Manifest) {
+	dst.ID = src.ID
+	dst.CreatedAt = src.CreatedAt
+	dst.Source = src.Source
+	dst.Properties = src.Properties
+	dst.History = append([]StageRecord{}, src.History...)
+
+	for _, file := range src.Files {
+		if entry := dst.File(file.Name); entry != nil {
+			entry.DerivedFrom = file.DerivedFrom
+			entry.Properties = file.Properties
+		}
+	}
+}
+
+// ExtractBundle writes all files of the bundle and its manifest into dir.
+func ExtractBundle(reader QueueZipFileReader, dir string) error {
+	err := os.MkdirAll(dir, 0o755)
+	if err != nil {
+		return err
+	}
+
+	for _, fileName := range reader.FileNames() {
+		f, err := reader.GetFile(fileName)
+		if err != nil {
+			return err
+		}
+
+		err = extractFile(f, filepath.Join(dir, fileName))
+		if err != nil {
+			return err
+		}
+	}
+
+	data, err := reader.Manifest().Serialize()
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, manifestFileName), data, 0o644)
+}
+
+func extractFile(f BundleFile, filePath string) error {
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	out, err := os.OpenFile(filePath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(out, rc)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// PackBundle adds the files of dir to writer. If dir contains a manifest,
+// e.g. from ExtractBundle, its order and metadata are kept. Files that are
+// not in the manifest are appended in name order.
+func PackBundle(dir string, writer QueueZipFileWriter) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	var fileNames []string
+	for _, entry := range entries {
+		if !entry.IsDir() && !strings.HasPrefix(entry.Name(), ".") {
+			fileNames = append(fileNames, entry.Name())
+		}
+	}
+
+	manifest := NewManifest()
+	data, err := os.ReadFile(filepath.Join(dir, manifestFileName))
+	if err == nil {
+		manifest, err = ParseManifest(data)
+		if err != nil {
+			return err
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	var ordered []string
+	for _, file := range manifest.Files {
+		if slices.Contains(fileNames, file.Name) {
+			ordered = append(ordered, file.Name)
+		}
+	}
+	for _, fileName := range fileNames {
+		if !slices.Contains(ordered, fileName) {
+			ordered = append(ordered, fileName)
+		}
+	}
+
+	for _, fileName := range ordered {
+		err = addLocalFile(writer, filepath.Join(dir, fileName))
+		if err != nil {
+			return err
+		}
+	}
+
+	copyManifest(manifest, writer.Manifest())
+	return nil
+}
+
+func addLocalFile(writer QueueZipFileWriter, filePath string) error {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	return writer.AddFileReader(filepath.Base(filePath), file).Error()
+}
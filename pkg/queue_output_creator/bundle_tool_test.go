@@ -0,0 +1,89 @@
+package queueoutputcreator
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExtractAndPackBundle(t *testing.T) {
+	writer := CreateZipFileWriter()
+	writer.AddFile("page2.png", []byte("second"))
+	writer.AddFile("page1.png", []byte("first"))
+	writer.Manifest().File("page1.png").Tags = []string{"cover"}
+	writer.Manifest().Properties.Title = "Letter"
+	zipPath, err := writer.Finalize()
+	assert.NoError(t, err)
+	defer os.Remove(zipPath)
+
+	reader, closer, err := OpenBundle(zipPath, nil)
+	assert.NoError(t, err)
+	dir := filepath.Join(t.TempDir(), "extracted")
+	assert.NoError(t, ExtractBundle(reader, dir))
+	closer.Close()
+
+	data, err := os.ReadFile(filepath.Join(dir, "page1.png"))
+	assert.NoError(t, err)
+	assert.Equal(t, "first", string(data))
+
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "appendix.pdf"), []byte("pdf"), 0o644))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "page1.png"), []byte("fixed"), 0o644))
+
+	packed := CreateDirWriter(nil)
+	assert.NoError(t, PackBundle(dir, packed))
+	packedPath, err := packed.Finalize()
+	assert.NoError(t, err)
+	defer os.RemoveAll(packedPath)
+
+	repacked, closer, err := OpenBundle(packedPath, nil)
+	assert.NoError(t, err)
+	defer closer.Close()
+
+	manifest := repacked.Manifest()
+	assert.Equal(t, writer.Manifest().ID, manifest.ID)
+	assert.Equal(t, "Letter", manifest.Properties.Title)
+	assert.Equal(t, []string{"page2.png", "page1.png", "appendix.pdf"}, repacked.FileNames())
+	assert.Equal(t, []string{"cover"}, manifest.File("page1.png").Tags)
+	assert.Equal(t, checksum([]byte("fixed")), manifest.File("page1.png").SHA256)
+}
+
+func TestCopyBundle(t *testing.T) {
+	writer := CreateZipFileWriter()
+	writer.AddFile("document.pdf", []byte("pdf"))
+	writer.Manifest().File("document.pdf").SetMetadata("source", "mail")
+	zipPath, err := writer.Finalize()
+	assert.NoError(t, err)
+	defer os.Remove(zipPath)
+
+	reader, closer, err := OpenBundle(zipPath, nil)
+	assert.NoError(t, err)
+	defer closer.Close()
+
+	copied := CreateMemZipFileCreator()
+	assert.NoError(t, CopyBundle(reader, copied))
+	assert.Equal(t, "pdf", copied.Files()["document.pdf"].String())
+	assert.Equal(t, "mail", copied.Manifest().File("document.pdf").Extra["source"])
+
+	copied.Manifest().File("document.pdf").SetMetadata("source", "")
+	assert.Empty(t, copied.Manifest().File("document.pdf").Extra)
+}
+
+func TestMemBundleRoundTrip(t *testing.T) {
+	writer := CreateMemZipFileCreator()
+	writer.AddFile("page2.png", []byte("second"))
+	writer.AddFile("page1.png", []byte("first"))
+	writer.Manifest().File("page1.png").Title = "Cover"
+
+	reader, err := writer.Reader()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"page2.png", "page1.png"}, reader.FileNames())
+	assert.Equal(t, writer.Manifest().ID, reader.Manifest().ID)
+	assert.Equal(t, "Cover", reader.Manifest().File("page1.png").Title)
+	assert.Equal(t, checksum([]byte("first")), reader.Manifest().File("page1.png").SHA256)
+
+	writer.AddFile("page1.png", []byte("again"))
+	_, err = writer.FinalizeBytes()
+	assert.ErrorIs(t, err, os.ErrExist)
+}
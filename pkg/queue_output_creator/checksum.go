@@ -0,0 +1,68 @@
+package queueoutputcreator
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+)
+
+// ErrCorruptBundle is returned when a bundle cannot be read or its content
+// does not match the manifest.
+var ErrCorruptBundle = errors.New("corrupt bundle")
+
+// checksumWriter records the checksum and size of everything written through
+// it in the manifest entry.
+type checksumWriter struct {
+	w     io.Writer
+	hash  hash.Hash
+	entry *FileEntry
+}
+
+func newChecksumWriter(w io.Writer, entry *FileEntry) *checksumWriter {
+	return &checksumWriter{
+		w:     w,
+		hash:  sha256.New(),
+		entry: entry,
+	}
+}
+
+func (c *checksumWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.hash.Write(p[:n])
+	c.entry.Size += int64(n)
+	return n, err
+}
+
+func (c *checksumWriter) finish() {
+	c.entry.SHA256 = hex.EncodeToString(c.hash.Sum(nil))
+}
+
+func checksum(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// verifyFile checks the content read from r against the entry. Entries of
+// bundles written before checksums existed are not verified.
+func verifyFile(entry *FileEntry, r io.Reader) error {
+	if entry.SHA256 == "" {
+		return nil
+	}
+
+	h := sha256.New()
+	size, err := io.Copy(h, r)
+	if err != nil {
+		return fmt.Errorf("%w: %s: %v", ErrCorruptBundle, entry.Name, err)
+	}
+	if size != entry.Size {
+		return fmt.Errorf("%w: %s: size is %d, manifest says %d", ErrCorruptBundle, entry.Name, size, entry.Size)
+	}
+	if sum := hex.EncodeToString(h.Sum(nil)); sum != entry.SHA256 {
+		return fmt.Errorf("%w: %s: checksum is %s, manifest says %s", ErrCorruptBundle, entry.Name, sum, entry.SHA256)
+	}
+
+	return nil
+}
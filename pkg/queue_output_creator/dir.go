@@ -0,0 +1,385 @@
+package queueoutputcreator
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/schidstorm/scanner-tool/pkg/encryption"
+	"github.com/schidstorm/scanner-tool/pkg/filequeue"
+	"github.com/schidstorm/scanner-tool/pkg/workspace"
+)
+
+// DirWriter writes a bundle as a plain directory with a manifest. Finalize
+// returns the directory, which the queue moves with a single rename. With a
+// cipher every file is encrypted on its own.
+type DirWriter struct {
+	dir       string
+	cipher    *encryption.Cipher
+	manifest  *Manifest
+	current   *dirWriterFile
+	err       error
+	fileCount int
+}
+
+type dirWriterFile struct {
+	file      *os.File
+	encWriter *encryption.Writer
+	checksum  *checksumWriter
+}
+
+func (f *dirWriterFile) close() error {
+	f.checksum.finish()
+
+	var err error
+	if f.encWriter != nil {
+		err = f.encWriter.Close()
+	}
+	if closeErr := f.file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+func CreateDirWriter(cipher *encryption.Cipher) QueueZipFileWriter {
+	result := &DirWriter{
+		cipher:   cipher,
+		manifest: NewManifest(),
+	}
+
+	// the directory is moved into the queue when it is finalized
+	ws, err := workspace.New("bundle")
+	if err != nil {
+		result.err = err
+		return result
+	}
+	result.dir = ws.Dir()
+
+	return result
+}
+
+func (d *DirWriter) FileCount() int {
+	if d.err != nil {
+		return 0
+	}
+	return d.fileCount
+}
+
+func (d *DirWriter) Error() error {
+	return d.err
+}
+
+func (d *DirWriter) Manifest() *Manifest {
+	return d.manifest
+}
+
+// OpenFile starts a new file in the bundle. The returned writer is valid
+// until the next file is added.
+func (d *DirWriter) OpenFile(fileName string) io.Writer {
+	if d.err != nil {
+		return &nullWriter{}
+	}
+
+	w, err := d.createFile(fileName)
+	if err != nil {
+		d.err = err
+		return &nullWriter{}
+	}
+
+	return w
+}
+
+func (d *DirWriter) AddFile(fileName string, data []byte) QueueZipFileWriter {
+	return d.AddFileReader(fileName, bytes.NewReader(data))
+}
+
+func (d *DirWriter) AddFileReader(fileName string, r io.Reader) QueueZipFileWriter {
+	if d.err != nil {
+		return d
+	}
+
+	w, err := d.createFile(fileName)
+	if err != nil {
+		d.err = err
+		return d
+	}
+
+	_, err = io.Copy(w, r)
+	if err != nil {
+		d.err = err
+	}
+
+	return d
+}
+
+func (d *DirWriter) AttachMetadata(fileName string, metadata *Metadata) QueueZipFileWriter {
+	if d.err != nil {
+		return d
+	}
+
+	attachMetadata(d.manifest, fileName, metadata)
+	return d
+}
+
+func (d *DirWriter) createFile(fileName string) (io.Writer, error) {
+	err := d.finishFile()
+	if err != nil {
+		return nil, err
+	}
+
+	if fileName != filepath.Base(fileName) || strings.HasPrefix(fileName, ".") {
+		return nil, fmt.Errorf("invalid file name %q", fileName)
+	}
+
+	entry := d.manifest.AddFile(fileName)
+	entry.Size = 0
+	current, err := d.openFile(fileName, entry)
+	if err != nil {
+		return nil, err
+	}
+
+	d.current = current
+	d.fileCount++
+	return current.checksum, nil
+}
+
+func (d *DirWriter) openFile(fileName string, entry *FileEntry) (*dirWriterFile, error) {
+	file, err := os.OpenFile(filepath.Join(d.dir, fileName), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &dirWriterFile{file: file}
+	var target io.Writer = file
+	if d.cipher != nil {
+		result.encWriter, err = d.cipher.NewWriter(file)
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+		target = result.encWriter
+	}
+	result.checksum = newChecksumWriter(target, entry)
+
+	return result, nil
+}
+
+// finishFile closes the file written last.
+func (d *DirWriter) finishFile() error {
+	if d.current == nil {
+		return nil
+	}
+
+	err := d.current.close()
+	d.current = nil
+	return err
+}
+
+func (d *DirWriter) Finalize() (string, error) {
+	if d.err != nil {
+		d.Discard()
+		return "", d.err
+	}
+
+	err := d.finishFile()
+	if err == nil {
+		err = d.writeManifest()
+	}
+	if err != nil {
+		d.Discard()
+		return "", err
+	}
+
+	// the directory belongs to the caller now, Discard must not remove it
+	dir := d.dir
+	d.dir = ""
+	return dir, nil
+}
+
+func (d *DirWriter) Discard() {
+	if d.current != nil {
+		d.current.close()
+		d.current = nil
+	}
+	if d.dir != "" {
+		os.RemoveAll(d.dir)
+		d.dir = ""
+	}
+	if d.err == nil {
+		d.err = errDiscarded
+	}
+}
+
+func (d *DirWriter) writeManifest() error {
+	data, err := d.manifest.Serialize()
+	if err != nil {
+		return err
+	}
+
+	file, err := d.openFile(manifestFileName, &FileEntry{})
+	if err != nil {
+		return err
+	}
+
+	_, err = file.checksum.Write(data)
+	if closeErr := file.close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+type DirReader struct {
+	queueFile filequeue.DirQueueFile
+	files     map[string]*DirFile
+	manifest  *Manifest
+}
+
+// CreateDirReader reads a directory bundle and verifies its content against
+// the manifest.
+func CreateDirReader(queueFile filequeue.DirQueueFile) (QueueZipFileReader, error) {
+	entries, err := os.ReadDir(queueFile.Dir())
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrCorruptBundle, err)
+	}
+
+	var fileNames []string
+	var manifest *Manifest
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+
+		if entry.Name() == manifestFileName {
+			manifest, err = readDirManifest(queueFile)
+			if err != nil {
+				return nil, fmt.Errorf("%w: %v", ErrCorruptBundle, err)
+			}
+		} else if !strings.HasPrefix(entry.Name(), ".") {
+			fileNames = append(fileNames, entry.Name())
+		}
+	}
+
+	if manifest == nil {
+		manifest = legacyManifest(fileNames, nil)
+	}
+
+	err = reconcileManifest(manifest, fileNames)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrCorruptBundle, err)
+	}
+
+	reader := &DirReader{
+		queueFile: queueFile,
+		files:     make(map[string]*DirFile),
+		manifest:  manifest,
+	}
+	for _, fileName := range fileNames {
+		file, err := reader.verifyFile(manifest.File(fileName))
+		if err != nil {
+			return nil, err
+		}
+		reader.files[fileName] = file
+	}
+
+	return reader, nil
+}
+
+func readDirManifest(queueFile filequeue.DirQueueFile) (*Manifest, error) {
+	entry, err := queueFile.OpenEntry(manifestFileName)
+	if err != nil {
+		return nil, err
+	}
+	defer entry.Close()
+
+	data, err := io.ReadAll(entry)
+	if err != nil {
+		return nil, err
+	}
+
+	return ParseManifest(data)
+}
+
+func (d *DirReader) verifyFile(entry *FileEntry) (*DirFile, error) {
+	info, err := os.Stat(filepath.Join(d.queueFile.Dir(), entry.Name))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrCorruptBundle, err)
+	}
+
+	dirEntry, err := d.queueFile.OpenEntry(entry.Name)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: %v", ErrCorruptBundle, entry.Name, err)
+	}
+	defer dirEntry.Close()
+
+	err = verifyFile(entry, dirEntry)
+	if err != nil {
+		return nil, err
+	}
+
+	return &DirFile{
+		queueFile: d.queueFile,
+		entry:     entry,
+		info:      dirFileInfo{FileInfo: info, size: dirEntry.Size()},
+		path:      dirEntry.Path(),
+	}, nil
+}
+
+func (d *DirReader) GetFile(fileName string) (BundleFile, error) {
+	if file, exists := d.files[fileName]; exists {
+		return file, nil
+	}
+
+	return nil, os.ErrNotExist
+}
+
+func (d *DirReader) FileNames() []string {
+	return d.manifest.FileNames()
+}
+
+func (d *DirReader) Manifest() *Manifest {
+	return d.manifest
+}
+
+// DirFile is a file of a directory bundle.
+type DirFile struct {
+	queueFile filequeue.DirQueueFile
+	entry     *FileEntry
+	info      fs.FileInfo
+	path      string
+}
+
+func (f *DirFile) Open() (io.ReadCloser, error) {
+	return f.queueFile.OpenEntry(f.entry.Name)
+}
+
+func (f *DirFile) FileInfo() fs.FileInfo {
+	return f.info
+}
+
+func (f *DirFile) Metadata() map[string]string {
+	return f.entry.ToMap()
+}
+
+func (f *DirFile) Entry() *FileEntry {
+	return f.entry
+}
+
+// Path returns the path of the unencrypted file, so handlers can use it
+// without copying. It is empty if the file is encrypted.
+func (f *DirFile) Path() string {
+	return f.path
+}
+
+// dirFileInfo reports the decrypted size of a file.
+type dirFileInfo struct {
+	fs.FileInfo
+	size int64
+}
+
+func (i dirFileInfo) Size() int64 {
+	return i.size
+}
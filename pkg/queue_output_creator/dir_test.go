@@ -0,0 +1,103 @@
+package queueoutputcreator
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/schidstorm/scanner-tool/pkg/encryption"
+	"github.com/schidstorm/scanner-tool/pkg/filequeue"
+	"github.com/schidstorm/scanner-tool/pkg/workspace"
+	"github.com/stretchr/testify/assert"
+)
+
+func writeDirBundle(t *testing.T, cipher *encryption.Cipher) string {
+	writer := CreateDirWriter(cipher)
+	writer.AddFile("page2.png", []byte("second"))
+	writer.OpenFile("page1.png").Write([]byte("first"))
+	writer.Manifest().File("page1.png").Title = "Cover"
+
+	dir, err := writer.Finalize()
+	assert.NoError(t, err)
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	return dir
+}
+
+func TestDirBundleRoundTrip(t *testing.T) {
+	dir := writeDirBundle(t, nil)
+
+	reader, err := CreateZipFileReader(filequeue.OpenDirBundle(dir, nil))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"page2.png", "page1.png"}, reader.FileNames())
+	assert.Equal(t, "Cover", reader.Manifest().File("page1.png").Title)
+
+	f, err := reader.GetFile("page1.png")
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join(dir, "page1.png"), f.(*DirFile).Path())
+	assert.Equal(t, int64(5), f.FileInfo().Size())
+
+	rc, err := f.Open()
+	assert.NoError(t, err)
+	data, _ := io.ReadAll(rc)
+	rc.Close()
+	assert.Equal(t, "first", string(data))
+}
+
+func TestEncryptedDirBundle(t *testing.T) {
+	cipher, err := encryption.NewCipher(bytes.Repeat([]byte{5}, 32))
+	assert.NoError(t, err)
+	dir := writeDirBundle(t, cipher)
+
+	raw, err := os.ReadFile(filepath.Join(dir, "page1.png"))
+	assert.NoError(t, err)
+	assert.NotContains(t, string(raw), "first")
+
+	_, err = CreateZipFileReader(filequeue.OpenDirBundle(dir, nil))
+	assert.Error(t, err)
+
+	reader, err := CreateZipFileReader(filequeue.OpenDirBundle(dir, cipher))
+	assert.NoError(t, err)
+	f, err := reader.GetFile("page1.png")
+	assert.NoError(t, err)
+	assert.Empty(t, f.(*DirFile).Path())
+	assert.Equal(t, int64(5), f.FileInfo().Size())
+
+	rc, err := f.Open()
+	assert.NoError(t, err)
+	data, _ := io.ReadAll(rc)
+	rc.Close()
+	assert.Equal(t, "first", string(data))
+}
+
+func TestCorruptDirBundle(t *testing.T) {
+	dir := writeDirBundle(t, nil)
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "page2.png"), []byte("secund"), 0o600))
+
+	_, err := CreateZipFileReader(filequeue.OpenDirBundle(dir, nil))
+	assert.ErrorIs(t, err, ErrCorruptBundle)
+
+	assert.NoError(t, os.Remove(filepath.Join(dir, "page2.png")))
+	_, err = CreateZipFileReader(filequeue.OpenDirBundle(dir, nil))
+	assert.ErrorIs(t, err, ErrCorruptBundle)
+}
+
+func TestDiscardRemovesTemporaryFiles(t *testing.T) {
+	oldRoot := workspace.Root()
+	workspace.SetRoot(t.TempDir())
+	t.Cleanup(func() { workspace.SetRoot(oldRoot) })
+
+	for _, writer := range []QueueZipFileWriter{CreateZipFileWriter(), CreateDirWriter(nil)} {
+		writer.OpenFile("page1.png").Write([]byte("first"))
+		writer.Discard()
+		_, err := writer.Finalize()
+		assert.Error(t, err)
+	}
+
+	entries, err := os.ReadDir(workspace.Root())
+	assert.NoError(t, err)
+	for _, entry := range entries {
+		assert.Equal(t, ".lock", filepath.Ext(entry.Name()))
+	}
+}
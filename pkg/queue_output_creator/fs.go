@@ -3,31 +3,58 @@ package queueoutputcreator
 import (
 	"archive/zip"
 	"bytes"
+	"fmt"
 	"io"
 	"os"
 	"strings"
+	"time"
 
+	"github.com/schidstorm/scanner-tool/pkg/encryption"
 	"github.com/schidstorm/scanner-tool/pkg/filequeue"
+	"github.com/schidstorm/scanner-tool/pkg/workspace"
 )
 
 type FsZipFileWriter struct {
 	file      *os.File
+	encWriter *encryption.Writer
 	zipWriter *zip.Writer
+	manifest  *Manifest
+	current   *checksumWriter
 	err       error
 	fileCount int
 }
 
 func CreateZipFileWriter() QueueZipFileWriter {
-	result := &FsZipFileWriter{}
+	return CreateEncryptedZipFileWriter(nil)
+}
+
+// CreateEncryptedZipFileWriter writes the temporary zip file encrypted with
+// cipher, so unencrypted scans never touch the disk. A nil cipher writes a
+// plain zip file.
+func CreateEncryptedZipFileWriter(cipher *encryption.Cipher) QueueZipFileWriter {
+	result := &FsZipFileWriter{
+		manifest: NewManifest(),
+	}
 
-	resultZipFile, err := os.CreateTemp("", "scanner-tool-*.zip")
+	resultZipFile, err := workspace.CreateTemp("bundle", ".zip")
 	if err != nil {
 		result.err = err
 		return result
 	}
 	result.file = resultZipFile
 
-	zipWriter := zip.NewWriter(resultZipFile)
+	var zipTarget io.Writer = resultZipFile
+	if cipher != nil {
+		encWriter, err := cipher.NewWriter(resultZipFile)
+		if err != nil {
+			result.err = err
+			return result
+		}
+		result.encWriter = encWriter
+		zipTarget = encWriter
+	}
+
+	zipWriter := zip.NewWriter(zipTarget)
 	result.zipWriter = zipWriter
 
 	return result
@@ -44,118 +71,275 @@ func (z *FsZipFileWriter) Error() error {
 	return z.err
 }
 
+func (z *FsZipFileWriter) Manifest() *Manifest {
+	return z.manifest
+}
+
+// OpenFile starts a new file in the bundle. The returned writer is valid
+// until the next file is added.
 func (z *FsZipFileWriter) OpenFile(fileName string) io.Writer {
 	if z.err != nil {
 		return &nullWriter{}
 	}
 
-	file, err := z.zipWriter.Create(fileName)
+	file, err := z.createFile(fileName)
 	if err != nil {
 		z.err = err
 		return &nullWriter{}
 	}
 
-	z.fileCount++
 	return file
 }
 
 func (z *FsZipFileWriter) AddFile(fileName string, data []byte) QueueZipFileWriter {
+	return z.AddFileReader(fileName, bytes.NewReader(data))
+}
+
+// AddFileReader streams r into the bundle without buffering it.
+func (z *FsZipFileWriter) AddFileReader(fileName string, r io.Reader) QueueZipFileWriter {
 	if z.err != nil {
 		return z
 	}
 
-	file, err := z.zipWriter.Create(fileName)
+	file, err := z.createFile(fileName)
 	if err != nil {
 		z.err = err
 		return z
 	}
 
-	_, err = file.Write(data)
+	_, err = io.Copy(file, r)
 	if err != nil {
 		z.err = err
 	}
 
+	return z
+}
+
+func (z *FsZipFileWriter) createFile(fileName string) (io.Writer, error) {
+	z.finishFile()
+	file, err := z.zipWriter.CreateHeader(&zip.FileHeader{
+		Name:     fileName,
+		Method:   compressionMethod(fileName),
+		Modified: time.Now(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	entry := z.manifest.AddFile(fileName)
+	entry.Size = 0
+	z.current = newChecksumWriter(file, entry)
 	z.fileCount++
+	return z.current, nil
+}
 
-	return z
+// finishFile records the checksum of the file written last.
+func (z *FsZipFileWriter) finishFile() {
+	if z.current != nil {
+		z.current.finish()
+		z.current = nil
+	}
 }
 
-func (z *FsZipFileWriter) AddFileReader(fileName string, r io.Reader) QueueZipFileWriter {
-	b := bytes.NewBuffer(nil)
-	io.Copy(b, r)
-	return z.AddFile(fileName, b.Bytes())
+// compressionMethod stores images uncompressed. They are compressed already
+// and deflating them only costs CPU.
+func compressionMethod(fileName string) uint16 {
+	if kindForFileName(fileName) == KindPage {
+		return zip.Store
+	}
+	return zip.Deflate
 }
 
 func (z *FsZipFileWriter) Finalize() (string, error) {
 	if z.err != nil {
+		z.Discard()
 		return "", z.err
 	}
 
-	if z.zipWriter != nil {
-		z.zipWriter.Close()
+	filePath := z.file.Name()
+	file := z.file
+	// the file belongs to the caller now, Discard must not remove it
+	z.file = nil
+	z.finishFile()
+	err := z.writeManifest()
+	if err == nil {
+		err = z.zipWriter.Close()
+	}
+	if z.encWriter != nil && err == nil {
+		err = z.encWriter.Close()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(filePath)
+		return "", err
 	}
 
-	filePath := z.file.Name()
+	return filePath, nil
+}
+
+func (z *FsZipFileWriter) Discard() {
 	if z.file != nil {
 		z.file.Close()
+		os.Remove(z.file.Name())
+		z.file = nil
 	}
+	if z.err == nil {
+		z.err = errDiscarded
+	}
+}
 
-	return filePath, nil
+func (z *FsZipFileWriter) writeManifest() error {
+	data, err := z.manifest.Serialize()
+	if err != nil {
+		return err
+	}
+
+	file, err := z.zipWriter.Create(manifestFileName)
+	if err != nil {
+		return err
+	}
+
+	_, err = file.Write(data)
+	return err
 }
 
+// AttachMetadata sets the flat metadata keys on the manifest entry of
+// fileName.
 func (z *FsZipFileWriter) AttachMetadata(fileName string, metadata *Metadata) QueueZipFileWriter {
 	if z.err != nil {
 		return z
 	}
 
+	attachMetadata(z.manifest, fileName, metadata)
+	return z
+}
+
+func attachMetadata(manifest *Manifest, fileName string, metadata *Metadata) {
 	if metadata == nil || metadata.IsEmpty() {
-		return z
+		return
 	}
 
-	return z.AddFile(".metadata."+fileName, metadata.Serialize())
+	file := manifest.AddFile(fileName)
+	for key, value := range metadata.ToMap() {
+		file.SetMetadata(key, value)
+	}
 }
 
 type FsZipFileReader struct {
 	zipReader *zip.Reader
 	files     map[string]*zip.File
-	metadata  map[string]*Metadata
+	manifest  *Manifest
 }
 
+// CreateZipFileReader reads a bundle from the queue. Directory bundles are
+// read with a directory reader.
 func CreateZipFileReader(queueFile filequeue.QueueFile) (QueueZipFileReader, error) {
+	if dirFile, ok := queueFile.(filequeue.DirQueueFile); ok {
+		return CreateDirReader(dirFile)
+	}
+
 	fileSize, err := queueFile.Size()
 	if err != nil {
 		return nil, err
 	}
 	zipReader, err := zip.NewReader(queueFile, fileSize)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("%w: %v", ErrCorruptBundle, err)
 	}
 
 	files := make(map[string]*zip.File)
-	metadata := make(map[string]*Metadata)
+	var fileNames []string
+	var manifest *Manifest
+	legacyMetadata := make(map[string]*Metadata)
 	for _, file := range zipReader.File {
 		if file.FileInfo().IsDir() {
 			continue
 		}
 
-		if strings.HasPrefix(file.Name, ".metadata.") {
+		if file.Name == manifestFileName {
+			zfContent, err := readZipFile(file)
+			if err != nil {
+				return nil, fmt.Errorf("%w: %v", ErrCorruptBundle, err)
+			}
+			manifest, err = ParseManifest(zfContent)
+			if err != nil {
+				return nil, fmt.Errorf("%w: %v", ErrCorruptBundle, err)
+			}
+		} else if strings.HasPrefix(file.Name, legacyMetadataPrefix) {
 			zfContent, err := readZipFile(file)
 			if err != nil {
-				return nil, err
+				return nil, fmt.Errorf("%w: %v", ErrCorruptBundle, err)
 			}
-			metadata[file.Name] = DeserializeMetadata(zfContent)
+			legacyMetadata[strings.TrimPrefix(file.Name, legacyMetadataPrefix)] = DeserializeMetadata(zfContent)
 		} else {
 			files[file.Name] = file
+			fileNames = append(fileNames, file.Name)
+		}
+	}
+
+	if manifest == nil {
+		manifest = legacyManifest(fileNames, legacyMetadata)
+	}
+
+	err = reconcileManifest(manifest, fileNames)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrCorruptBundle, err)
+	}
+
+	for _, fileName := range fileNames {
+		err = verifyZipFile(manifest.File(fileName), files[fileName])
+		if err != nil {
+			return nil, err
 		}
 	}
 
 	return &FsZipFileReader{
 		zipReader: zipReader,
 		files:     files,
-		metadata:  metadata,
+		manifest:  manifest,
 	}, nil
 }
 
+// reconcileManifest makes sure manifest and bundle content agree. Files that
+// were added to the bundle by hand get a manifest entry.
+func reconcileManifest(manifest *Manifest, fileNames []string) error {
+	present := make(map[string]bool)
+	for _, fileName := range fileNames {
+		present[fileName] = true
+		manifest.AddFile(fileName)
+	}
+
+	for _, file := range manifest.Files {
+		if !present[file.Name] {
+			return fmt.Errorf("manifest lists missing file %s", file.Name)
+		}
+	}
+
+	return nil
+}
+
+// verifyZipFile reads the whole file, so the zip CRC is checked as well as
+// the manifest checksum.
+func verifyZipFile(entry *FileEntry, zf *zip.File) error {
+	rc, err := zf.Open()
+	if err != nil {
+		return fmt.Errorf("%w: %s: %v", ErrCorruptBundle, zf.Name, err)
+	}
+	defer rc.Close()
+
+	if entry.SHA256 == "" {
+		_, err = io.Copy(io.Discard, rc)
+		if err != nil {
+			return fmt.Errorf("%w: %s: %v", ErrCorruptBundle, zf.Name, err)
+		}
+		return nil
+	}
+
+	return verifyFile(entry, rc)
+}
+
 func readZipFile(zf *zip.File) ([]byte, error) {
 	rc, err := zf.Open()
 	if err != nil {
@@ -171,28 +355,22 @@ func readZipFile(zf *zip.File) ([]byte, error) {
 	return data, nil
 }
 
-func (z *FsZipFileReader) GetFile(fileName string) (*ZipFile, error) {
-	metadata := z.metadata[".metadata."+fileName]
-	if metadata == nil {
-		metadata = &Metadata{}
-	}
-
+func (z *FsZipFileReader) GetFile(fileName string) (BundleFile, error) {
 	if file, exists := z.files[fileName]; exists {
 		return &ZipFile{
-			File:     file,
-			metadata: z.metadata[".metadata."+fileName],
+			File:  file,
+			entry: z.manifest.File(fileName),
 		}, nil
 	}
 
 	return nil, os.ErrNotExist
 }
 
-func (z *FsZipFileReader) FileNames() []string {
-
-	fileNames := make([]string, 0, len(z.files))
-	for fileName := range z.files {
-		fileNames = append(fileNames, fileName)
-	}
+func (z *FsZipFileReader) Manifest() *Manifest {
+	return z.manifest
+}
 
-	return fileNames
+// FileNames returns the bundle files in manifest order.
+func (z *FsZipFileReader) FileNames() []string {
+	return z.manifest.FileNames()
 }
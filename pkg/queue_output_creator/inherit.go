@@ -0,0 +1,190 @@
+package queueoutputcreator
+
+import (
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+)
+
+// ConflictPolicy decides what happens when files that are combined into one
+// carry different values for the same scalar property.
+type ConflictPolicy string
+
+const (
+	// ConflictFirst keeps the value of the first file in bundle order.
+	ConflictFirst ConflictPolicy = "first"
+	// ConflictDrop leaves the property empty.
+	ConflictDrop ConflictPolicy = "drop"
+)
+
+// Conflict describes a property that had different values in the sources.
+type Conflict struct {
+	File     string
+	Property string
+	Values   []string
+}
+
+func (c Conflict) String() string {
+	return fmt.Sprintf("%s: %s has conflicting values %q", c.File, c.Property, c.Values)
+}
+
+// InheritMetadata carries the metadata of the input bundle over to the output
+// bundle of a stage. Values set by the stage itself always win.
+//
+// Bundle source and properties are copied. Every output file inherits the
+// properties of the input files it was derived from: the files listed in its
+// DerivedFrom, otherwise the input file with the same name without extension,
+// otherwise all input files, as stages like merge combine everything they
+// got. When several files are combined, tags are united and scalar
+// properties that disagree are resolved by policy.
+func InheritMetadata(input, output *Manifest, policy ConflictPolicy) []Conflict {
+	if output.Source == (Source{}) {
+		output.Source = input.Source
+	}
+
+	var conflicts []Conflict
+	conflicts = append(conflicts, mergeProperties("bundle", &output.Properties, []*Properties{&input.Properties}, policy)...)
+	return append(conflicts, InheritFileMetadata(input, output, policy)...)
+}
+
+// InheritFileMetadata is InheritMetadata without the bundle source and
+// properties, for stages that already inherited them and may have changed
+// them, e.g. removed tags.
+func InheritFileMetadata(input, output *Manifest, policy ConflictPolicy) []Conflict {
+	var conflicts []Conflict
+	for _, file := range output.Files {
+		sources := derivedFrom(input, file)
+		if len(file.DerivedFrom) == 0 {
+			for _, source := range sources {
+				file.DerivedFrom = append(file.DerivedFrom, source.Name)
+			}
+		}
+
+		properties := make([]*Properties, 0, len(sources))
+		for _, source := range sources {
+			properties = append(properties, &source.Properties)
+		}
+		conflicts = append(conflicts, mergeProperties(file.Name, &file.Properties, properties, policy)...)
+	}
+
+	return conflicts
+}
+
+func derivedFrom(input *Manifest, file *FileEntry) []*FileEntry {
+	var sources []*FileEntry
+	if len(file.DerivedFrom) > 0 {
+		for _, name := range file.DerivedFrom {
+			if source := input.File(name); source != nil {
+				sources = append(sources, source)
+			}
+		}
+		return sources
+	}
+
+	if source := input.File(file.Name); source != nil {
+		return []*FileEntry{source}
+	}
+
+	stem := fileStem(file.Name)
+	for _, source := range input.Files {
+		if fileStem(source.Name) == stem {
+			sources = append(sources, source)
+		}
+	}
+	if len(sources) == 1 {
+		return sources
+	}
+
+	return input.Files
+}
+
+func fileStem(fileName string) string {
+	return strings.TrimSuffix(fileName, path.Ext(fileName))
+}
+
+// mergeProperties fills the unset properties of target from sources.
+func mergeProperties(owner string, target *Properties, sources []*Properties, policy ConflictPolicy) []Conflict {
+	var conflicts []Conflict
+	mergeScalar := func(property string, value *string, get func(*Properties) string) {
+		if *value != "" {
+			return
+		}
+
+		var values []string
+		for _, source := range sources {
+			if v := get(source); v != "" && !slices.Contains(values, v) {
+				values = append(values, v)
+			}
+		}
+
+		switch {
+		case len(values) == 1:
+			*value = values[0]
+		case len(values) > 1:
+			conflicts = append(conflicts, Conflict{File: owner, Property: property, Values: values})
+			if policy != ConflictDrop {
+				*value = values[0]
+			}
+		}
+	}
+
+	mergeScalar("title", &target.Title, func(p *Properties) string { return p.Title })
+	mergeScalar("correspondent", &target.Correspondent, func(p *Properties) string { return p.Correspondent })
+	mergeScalar("document_type", &target.DocumentType, func(p *Properties) string { return p.DocumentType })
+
+	for _, source := range sources {
+		for _, tag := range source.Tags {
+			if !slices.ContainsFunc(target.Tags, func(t string) bool { return strings.EqualFold(t, tag) }) {
+				target.Tags = append(target.Tags, tag)
+			}
+		}
+	}
+
+	var extraKeys []string
+	for _, source := range sources {
+		for key := range source.Extra {
+			if !slices.Contains(extraKeys, key) {
+				extraKeys = append(extraKeys, key)
+			}
+		}
+	}
+	slices.Sort(extraKeys)
+	for _, key := range extraKeys {
+		value := target.Extra[key]
+		mergeScalar(key, &value, func(p *Properties) string { return p.Extra[key] })
+		if value != "" {
+			if target.Extra == nil {
+				target.Extra = make(map[string]string)
+			}
+			target.Extra[key] = value
+		}
+	}
+
+	if target.OCR == nil {
+		target.OCR = mergeOCR(sources)
+	}
+
+	return conflicts
+}
+
+// mergeOCR averages the confidence of all sources that went through OCR.
+func mergeOCR(sources []*Properties) *OCRInfo {
+	var result *OCRInfo
+	count := 0
+	for _, source := range sources {
+		if source.OCR == nil {
+			continue
+		}
+		if result == nil {
+			result = &OCRInfo{Language: source.OCR.Language}
+		}
+		result.Confidence += source.OCR.Confidence
+		count++
+	}
+
+	if result != nil {
+		result.Confidence /= float64(count)
+	}
+	return result
+}
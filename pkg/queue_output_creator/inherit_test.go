@@ -0,0 +1,89 @@
+package queueoutputcreator
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testInputManifest() *Manifest {
+	input := NewManifest()
+	input.Source.Device = "scanner"
+	input.Properties.Correspondent = "ACME"
+
+	page1 := input.AddFile("page1.png")
+	page1.Title = "Invoice"
+	page1.Tags = []string{"invoice"}
+	page1.OCR = &OCRInfo{Language: "deu", Confidence: 90}
+
+	page2 := input.AddFile("page2.png")
+	page2.Title = "Terms"
+	page2.Tags = []string{"Invoice", "terms"}
+	page2.Extra = map[string]string{"cover": "yes"}
+	page2.OCR = &OCRInfo{Language: "deu", Confidence: 70}
+
+	return input
+}
+
+func TestInheritMetadataPerFile(t *testing.T) {
+	input := testInputManifest()
+	output := NewManifest()
+	output.AddFile("page1.pdf")
+	output.AddFile("page2.pdf").Title = "Own title"
+
+	conflicts := InheritMetadata(input, output, ConflictFirst)
+	assert.Empty(t, conflicts)
+
+	assert.Equal(t, "scanner", output.Source.Device)
+	assert.Equal(t, "ACME", output.Properties.Correspondent)
+
+	page1 := output.File("page1.pdf")
+	assert.Equal(t, []string{"page1.png"}, page1.DerivedFrom)
+	assert.Equal(t, "Invoice", page1.Title)
+	assert.Equal(t, []string{"invoice"}, page1.Tags)
+
+	page2 := output.File("page2.pdf")
+	assert.Equal(t, "Own title", page2.Title)
+	assert.Equal(t, "yes", page2.Extra["cover"])
+}
+
+func TestInheritFileMetadataKeepsBundleProperties(t *testing.T) {
+	output := NewManifest()
+	output.Properties.Correspondent = "Other"
+	output.AddFile("page1.pdf")
+
+	InheritFileMetadata(testInputManifest(), output, ConflictFirst)
+	assert.Equal(t, "Other", output.Properties.Correspondent)
+	assert.Empty(t, output.Source.Device)
+	assert.Equal(t, []string{"invoice"}, output.File("page1.pdf").Tags)
+}
+
+func TestInheritMetadataOnMerge(t *testing.T) {
+	output := NewManifest()
+	output.AddFile("out.pdf")
+
+	conflicts := InheritMetadata(testInputManifest(), output, ConflictFirst)
+	assert.Len(t, conflicts, 1)
+	assert.Equal(t, "title", conflicts[0].Property)
+
+	merged := output.File("out.pdf")
+	assert.Equal(t, []string{"page1.png", "page2.png"}, merged.DerivedFrom)
+	assert.Equal(t, "Invoice", merged.Title)
+	assert.Equal(t, []string{"invoice", "terms"}, merged.Tags)
+	assert.Equal(t, "yes", merged.Extra["cover"])
+	assert.Equal(t, &OCRInfo{Language: "deu", Confidence: 80}, merged.OCR)
+
+	output = NewManifest()
+	output.AddFile("out.pdf")
+	InheritMetadata(testInputManifest(), output, ConflictDrop)
+	assert.Empty(t, output.File("out.pdf").Title)
+}
+
+func TestInheritMetadataExplicitSources(t *testing.T) {
+	output := NewManifest()
+	output.AddFile("out.pdf").DerivedFrom = []string{"page2.png"}
+
+	conflicts := InheritMetadata(testInputManifest(), output, ConflictFirst)
+	assert.Empty(t, conflicts)
+	assert.Equal(t, "Terms", output.File("out.pdf").Title)
+}
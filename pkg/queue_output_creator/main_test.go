@@ -0,0 +1,21 @@
+package queueoutputcreator
+
+import (
+	"os"
+	"testing"
+
+	"github.com/schidstorm/scanner-tool/pkg/workspace"
+)
+
+// TestMain keeps the workspaces of all tests out of the real work dir.
+func TestMain(m *testing.M) {
+	root, err := os.MkdirTemp("", "scanner-tool-test-")
+	if err != nil {
+		panic(err)
+	}
+	workspace.SetRoot(root)
+
+	code := m.Run()
+	os.RemoveAll(root)
+	os.Exit(code)
+}
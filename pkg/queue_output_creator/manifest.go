@@ -0,0 +1,334 @@
+package queueoutputcreator
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+)
+
+// ManifestVersion is the manifest schema version written by this build.
+// Manifests with a higher version are rejected.
+const ManifestVersion = 1
+
+const manifestFileName = ".manifest.json"
+const legacyMetadataPrefix = ".metadata."
+
+type FileKind string
+
+const (
+	KindPage     FileKind = "page"
+	KindDocument FileKind = "document"
+)
+
+// Manifest describes a bundle: its files in order, where it came from,
+// document properties and the stages it went through. The order of Files is
+// the order of the pages in the final document; readers hand files to
+// handlers in this order.
+type Manifest struct {
+	Version    int           `json:"version"`
+	ID         string        `json:"id"`
+	CreatedAt  time.Time     `json:"createdAt"`
+	Source     Source        `json:"source"`
+	Properties Properties    `json:"properties"`
+	Files      []*FileEntry  `json:"files"`
+	History    []StageRecord `json:"history,omitempty"`
+}
+
+type Source struct {
+	Device  string `json:"device,omitempty"`
+	Profile string `json:"profile,omitempty"`
+}
+
+type OCRInfo struct {
+	Language string `json:"language,omitempty"`
+	// Confidence is the mean word confidence in percent.
+	Confidence float64 `json:"confidence,omitempty"`
+}
+
+// Properties are document properties that apply to the whole bundle or to a
+// single file.
+type Properties struct {
+	Title         string            `json:"title,omitempty"`
+	Tags          []string          `json:"tags,omitempty"`
+	Correspondent string            `json:"correspondent,omitempty"`
+	DocumentType  string            `json:"documentType,omitempty"`
+	OCR           *OCRInfo          `json:"ocr,omitempty"`
+	Extra         map[string]string `json:"extra,omitempty"`
+}
+
+type FileEntry struct {
+	Name string   `json:"name"`
+	Kind FileKind `json:"kind"`
+	// Page is the 1-based page number of page files.
+	Page int `json:"page,omitempty"`
+	// DerivedFrom names the files of the previous stage this file was
+	// created from.
+	DerivedFrom []string `json:"derivedFrom,omitempty"`
+	// SHA256 is the hex encoded checksum of the file content, verified
+	// when the bundle is read.
+	SHA256 string `json:"sha256,omitempty"`
+	Size   int64  `json:"size"`
+	Properties
+}
+
+type StageRecord struct {
+	Stage      string    `json:"stage"`
+	StartedAt  time.Time `json:"startedAt"`
+	FinishedAt time.Time `json:"finishedAt"`
+}
+
+func NewManifest() *Manifest {
+	return &Manifest{
+		Version:   ManifestVersion,
+		ID:        newBundleID(),
+		CreatedAt: time.Now().UTC(),
+	}
+}
+
+func newBundleID() string {
+	id := make([]byte, 8)
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+func ParseManifest(data []byte) (*Manifest, error) {
+	var m Manifest
+	err := json.Unmarshal(data, &m)
+	if err != nil {
+		return nil, fmt.Errorf("invalid manifest: %w", err)
+	}
+
+	err = m.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	return &m, nil
+}
+
+func (m *Manifest) Serialize() ([]byte, error) {
+	err := m.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	return json.MarshalIndent(m, "", "  ")
+}
+
+func (m *Manifest) Validate() error {
+	if m.Version < 1 || m.Version > ManifestVersion {
+		return fmt.Errorf("unsupported manifest version %d", m.Version)
+	}
+	if m.ID == "" {
+		return errors.New("manifest has no id")
+	}
+
+	var errs []error
+	errs = append(errs, m.Properties.validate("bundle"))
+
+	seen := make(map[string]bool)
+	lastPage := 0
+	for _, file := range m.Files {
+		if file.Name == "" || strings.HasPrefix(file.Name, ".") || strings.Contains(file.Name, "/") {
+			errs = append(errs, fmt.Errorf("invalid file name %q", file.Name))
+		}
+		if seen[file.Name] {
+			errs = append(errs, fmt.Errorf("duplicate file %s", file.Name))
+		}
+		seen[file.Name] = true
+
+		switch file.Kind {
+		case KindPage:
+			if file.Page < 1 {
+				errs = append(errs, fmt.Errorf("page %s has no page number", file.Name))
+			} else if file.Page <= lastPage {
+				errs = append(errs, fmt.Errorf("page %s is out of order", file.Name))
+			}
+			lastPage = file.Page
+		case KindDocument:
+		default:
+			errs = append(errs, fmt.Errorf("file %s has unknown kind %q", file.Name, file.Kind))
+		}
+
+		if file.SHA256 != "" && !isSHA256(file.SHA256) {
+			errs = append(errs, fmt.Errorf("file %s has invalid checksum %q", file.Name, file.SHA256))
+		}
+
+		errs = append(errs, file.Properties.validate(file.Name))
+	}
+
+	for _, record := range m.History {
+		if record.Stage == "" {
+			errs = append(errs, errors.New("history record without stage"))
+		}
+		if record.FinishedAt.Before(record.StartedAt) {
+			errs = append(errs, fmt.Errorf("stage %s finished before it started", record.Stage))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func isSHA256(sum string) bool {
+	decoded, err := hex.DecodeString(sum)
+	return err == nil && len(decoded) == 32
+}
+
+func (p *Properties) validate(owner string) error {
+	if p.OCR != nil && (p.OCR.Confidence < 0 || p.OCR.Confidence > 100) {
+		return fmt.Errorf("%s: ocr confidence %f out of range", owner, p.OCR.Confidence)
+	}
+	for _, tag := range p.Tags {
+		if strings.TrimSpace(tag) == "" {
+			return fmt.Errorf("%s: empty tag", owner)
+		}
+	}
+	return nil
+}
+
+// File returns the entry for fileName or nil.
+func (m *Manifest) File(fileName string) *FileEntry {
+	for _, file := range m.Files {
+		if file.Name == fileName {
+			return file
+		}
+	}
+	return nil
+}
+
+// AddFile returns the entry for fileName, appending a new one if needed.
+// Images become pages numbered in insertion order, everything else becomes a
+// document.
+func (m *Manifest) AddFile(fileName string) *FileEntry {
+	if file := m.File(fileName); file != nil {
+		return file
+	}
+
+	file := &FileEntry{Name: fileName, Kind: kindForFileName(fileName)}
+	if file.Kind == KindPage {
+		file.Page = len(m.Pages()) + 1
+	}
+	m.Files = append(m.Files, file)
+
+	return file
+}
+
+// FileNames returns the file names in bundle order.
+func (m *Manifest) FileNames() []string {
+	fileNames := make([]string, 0, len(m.Files))
+	for _, file := range m.Files {
+		fileNames = append(fileNames, file.Name)
+	}
+	return fileNames
+}
+
+func kindForFileName(fileName string) FileKind {
+	switch strings.ToLower(path.Ext(fileName)) {
+	case ".png", ".jpg", ".jpeg", ".tif", ".tiff", ".pnm", ".bmp":
+		return KindPage
+	default:
+		return KindDocument
+	}
+}
+
+func (m *Manifest) Pages() []*FileEntry {
+	return m.filesOfKind(KindPage)
+}
+
+func (m *Manifest) Documents() []*FileEntry {
+	return m.filesOfKind(KindDocument)
+}
+
+func (m *Manifest) filesOfKind(kind FileKind) []*FileEntry {
+	var files []*FileEntry
+	for _, file := range m.Files {
+		if file.Kind == kind {
+			files = append(files, file)
+		}
+	}
+	return files
+}
+
+func (m *Manifest) RecordStage(stage string, startedAt, finishedAt time.Time) {
+	m.History = append(m.History, StageRecord{
+		Stage:      stage,
+		StartedAt:  startedAt.UTC(),
+		FinishedAt: finishedAt.UTC(),
+	})
+}
+
+// SetMetadata maps a flat metadata key onto the typed properties. Unknown
+// keys end up in Extra, an empty value removes them.
+func (p *Properties) SetMetadata(key, value string) {
+	switch key {
+	case "title":
+		p.Title = value
+	case "tags":
+		p.Tags = splitTags(value)
+	case "correspondent":
+		p.Correspondent = value
+	case "document_type":
+		p.DocumentType = value
+	default:
+		if value == "" {
+			delete(p.Extra, key)
+			return
+		}
+		if p.Extra == nil {
+			p.Extra = make(map[string]string)
+		}
+		p.Extra[key] = value
+	}
+}
+
+// ToMap is the flat representation used by the old metadata sidecars.
+func (p *Properties) ToMap() map[string]string {
+	result := make(map[string]string)
+	for key, value := range p.Extra {
+		result[key] = value
+	}
+	if p.Title != "" {
+		result["title"] = p.Title
+	}
+	if len(p.Tags) > 0 {
+		result["tags"] = strings.Join(p.Tags, ",")
+	}
+	if p.Correspondent != "" {
+		result["correspondent"] = p.Correspondent
+	}
+	if p.DocumentType != "" {
+		result["document_type"] = p.DocumentType
+	}
+	return result
+}
+
+func splitTags(value string) []string {
+	var tags []string
+	for _, tag := range strings.Split(value, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// legacyManifest builds a manifest for bundles written before manifests
+// existed, from the file list and the .metadata.<file> sidecars.
+func legacyManifest(fileNames []string, metadata map[string]*Metadata) *Manifest {
+	m := NewManifest()
+	for _, fileName := range fileNames {
+		file := m.AddFile(fileName)
+		if md, ok := metadata[fileName]; ok {
+			for key, value := range md.ToMap() {
+				file.SetMetadata(key, value)
+			}
+		}
+	}
+	return m
+}
@@ -0,0 +1,219 @@
+package queueoutputcreator
+
+import (
+	"archive/zip"
+	"bytes"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/schidstorm/scanner-tool/pkg/filequeue"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestManifestRoundTrip(t *testing.T) {
+	writer := CreateZipFileWriter()
+	writer.AddFile("page1.png", []byte("one"))
+	writer.AddFile("page2.png", []byte("two"))
+	writer.AddFile("document.pdf", []byte("pdf"))
+	writer.Manifest().File("document.pdf").Tags = []string{"invoice", "2024"}
+	writer.Manifest().Source.Device = "scanner"
+	start := time.Now()
+	writer.Manifest().RecordStage("ScanHandler", start, start.Add(time.Second))
+
+	filePath, err := writer.Finalize()
+	assert.NoError(t, err)
+	defer os.Remove(filePath)
+
+	data, err := os.ReadFile(filePath)
+	assert.NoError(t, err)
+
+	reader, err := CreateZipFileReader(&filequeue.MemQueryFile{Data: data})
+	assert.NoError(t, err)
+
+	manifest := reader.Manifest()
+	assert.Equal(t, writer.Manifest().ID, manifest.ID)
+	assert.Equal(t, "scanner", manifest.Source.Device)
+	assert.Len(t, manifest.History, 1)
+	assert.Len(t, manifest.Pages(), 2)
+	assert.Equal(t, 2, manifest.File("page2.png").Page)
+	assert.Equal(t, KindDocument, manifest.File("document.pdf").Kind)
+
+	f, err := reader.GetFile("document.pdf")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"invoice", "2024"}, f.Entry().Tags)
+	assert.Equal(t, "invoice,2024", f.Metadata()["tags"])
+	assert.NotContains(t, reader.FileNames(), manifestFileName)
+}
+
+func TestManifestValidate(t *testing.T) {
+	valid := func() *Manifest {
+		m := NewManifest()
+		m.AddFile("page.png")
+		return m
+	}
+
+	assert.NoError(t, valid().Validate())
+
+	m := valid()
+	m.Version = ManifestVersion + 1
+	assert.Error(t, m.Validate())
+
+	m = valid()
+	m.ID = ""
+	assert.Error(t, m.Validate())
+
+	m = valid()
+	m.Files = append(m.Files, &FileEntry{Name: "page.png", Kind: KindDocument})
+	assert.Error(t, m.Validate())
+
+	m = valid()
+	m.Files[0].Page = 0
+	assert.Error(t, m.Validate())
+
+	m = valid()
+	m.AddFile("page2.png").Page = 1
+	assert.Error(t, m.Validate())
+
+	m = valid()
+	m.Files[0].Kind = "unknown"
+	assert.Error(t, m.Validate())
+
+	m = valid()
+	m.Files[0].OCR = &OCRInfo{Confidence: 101}
+	assert.Error(t, m.Validate())
+
+	m = valid()
+	m.Properties.Tags = []string{" "}
+	assert.Error(t, m.Validate())
+
+	_, err := ParseManifest([]byte(`{"version": 1}`))
+	assert.Error(t, err)
+}
+
+func TestManifestFromLegacyMetadata(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	zipWriter := zip.NewWriter(buf)
+	w, _ := zipWriter.Create("document.pdf")
+	w.Write([]byte("pdf"))
+	w, _ = zipWriter.Create(legacyMetadataPrefix + "document.pdf")
+	w.Write([]byte(`{"tags":"a, b","source":"mail"}`))
+	assert.NoError(t, zipWriter.Close())
+
+	reader, err := CreateZipFileReader(&filequeue.MemQueryFile{Data: buf.Bytes()})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"document.pdf"}, reader.FileNames())
+
+	entry := reader.Manifest().File("document.pdf")
+	assert.Equal(t, []string{"a", "b"}, entry.Tags)
+	assert.Equal(t, "mail", entry.Extra["source"])
+}
+
+func TestManifestListsMissingFile(t *testing.T) {
+	m := NewManifest()
+	m.AddFile("missing.pdf")
+	data, err := m.Serialize()
+	assert.NoError(t, err)
+
+	buf := bytes.NewBuffer(nil)
+	zipWriter := zip.NewWriter(buf)
+	w, _ := zipWriter.Create(manifestFileName)
+	w.Write(data)
+	assert.NoError(t, zipWriter.Close())
+
+	_, err = CreateZipFileReader(&filequeue.MemQueryFile{Data: buf.Bytes()})
+	assert.Error(t, err)
+}
+
+func TestBundleKeepsFileOrder(t *testing.T) {
+	fileNames := []string{"page10.png", "page2.png", "b.pdf", "page1.png", "a.pdf"}
+
+	writer := CreateZipFileWriter()
+	for _, fileName := range fileNames {
+		writer.AddFile(fileName, []byte(fileName))
+	}
+
+	filePath, err := writer.Finalize()
+	assert.NoError(t, err)
+	defer os.Remove(filePath)
+
+	data, err := os.ReadFile(filePath)
+	assert.NoError(t, err)
+
+	for i := 0; i < 10; i++ {
+		reader, err := CreateZipFileReader(&filequeue.MemQueryFile{Data: data})
+		assert.NoError(t, err)
+		assert.Equal(t, fileNames, reader.FileNames())
+	}
+
+	reader, _ := CreateZipFileReader(&filequeue.MemQueryFile{Data: data})
+	assert.Equal(t, 3, reader.Manifest().File("page1.png").Page)
+}
+
+func TestImagesAreStoredUncompressed(t *testing.T) {
+	writer := CreateZipFileWriter()
+	writer.AddFileReader("page1.png", bytes.NewReader(bytes.Repeat([]byte("a"), 1024)))
+	writer.AddFileReader("document.pdf", bytes.NewReader(bytes.Repeat([]byte("a"), 1024)))
+
+	filePath, err := writer.Finalize()
+	assert.NoError(t, err)
+	defer os.Remove(filePath)
+
+	zipReader, err := zip.OpenReader(filePath)
+	assert.NoError(t, err)
+	defer zipReader.Close()
+
+	methods := make(map[string]uint16)
+	for _, file := range zipReader.File {
+		methods[file.Name] = file.Method
+	}
+	assert.Equal(t, zip.Store, methods["page1.png"])
+	assert.Equal(t, zip.Deflate, methods["document.pdf"])
+}
+
+func TestBundleChecksums(t *testing.T) {
+	writer := CreateZipFileWriter()
+	writer.AddFile("page1.png", []byte("page one"))
+	writer.OpenFile("page2.png").Write([]byte("page two"))
+	filePath, err := writer.Finalize()
+	assert.NoError(t, err)
+	defer os.Remove(filePath)
+
+	data, err := os.ReadFile(filePath)
+	assert.NoError(t, err)
+
+	reader, err := CreateZipFileReader(&filequeue.MemQueryFile{Data: data})
+	assert.NoError(t, err)
+	entry := reader.Manifest().File("page2.png")
+	assert.Equal(t, checksum([]byte("page two")), entry.SHA256)
+	assert.Equal(t, int64(8), entry.Size)
+
+	// page content is stored uncompressed, so it can be flipped in place
+	corrupted := bytes.Replace(data, []byte("page one"), []byte("page 0ne"), 1)
+	_, err = CreateZipFileReader(&filequeue.MemQueryFile{Data: corrupted})
+	assert.ErrorIs(t, err, ErrCorruptBundle)
+
+	_, err = CreateZipFileReader(&filequeue.MemQueryFile{Data: data[:len(data)/2]})
+	assert.ErrorIs(t, err, ErrCorruptBundle)
+}
+
+func TestBundleChecksumMismatch(t *testing.T) {
+	m := NewManifest()
+	m.AddFile("page.png")
+	m.Files[0].SHA256 = checksum([]byte("other"))
+	m.Files[0].Size = 4
+	manifestData, err := m.Serialize()
+	assert.NoError(t, err)
+
+	buf := bytes.NewBuffer(nil)
+	zipWriter := zip.NewWriter(buf)
+	w, _ := zipWriter.Create("page.png")
+	w.Write([]byte("page"))
+	w, _ = zipWriter.Create(manifestFileName)
+	w.Write(manifestData)
+	assert.NoError(t, zipWriter.Close())
+
+	_, err = CreateZipFileReader(&filequeue.MemQueryFile{Data: buf.Bytes()})
+	assert.ErrorIs(t, err, ErrCorruptBundle)
+	assert.ErrorContains(t, err, "checksum")
+}
@@ -1,20 +1,25 @@
 package queueoutputcreator
 
 import (
+	"archive/zip"
 	"bytes"
 	"errors"
 	"io"
 	"os"
+
+	"github.com/schidstorm/scanner-tool/pkg/filequeue"
 )
 
 type MemZipFileCreator struct {
-	files map[string]*bytes.Buffer
-	err   error
+	files    map[string]*bytes.Buffer
+	manifest *Manifest
+	err      error
 }
 
 func CreateMemZipFileCreator() *MemZipFileCreator {
 	return &MemZipFileCreator{
-		files: make(map[string]*bytes.Buffer),
+		files:    make(map[string]*bytes.Buffer),
+		manifest: NewManifest(),
 	}
 }
 
@@ -22,6 +27,11 @@ func (m MemZipFileCreator) Files() map[string]*bytes.Buffer {
 	return m.files
 }
 
+// FileNames returns the added files in insertion order.
+func (m *MemZipFileCreator) FileNames() []string {
+	return m.manifest.FileNames()
+}
+
 func (m *MemZipFileCreator) FileCount() int {
 	if m.err != nil {
 		return 0
@@ -33,6 +43,15 @@ func (m *MemZipFileCreator) Error() error {
 	return m.err
 }
 
+func (m *MemZipFileCreator) Manifest() *Manifest {
+	for fileName, buf := range m.files {
+		entry := m.manifest.AddFile(fileName)
+		entry.SHA256 = checksum(buf.Bytes())
+		entry.Size = int64(buf.Len())
+	}
+	return m.manifest
+}
+
 func (m *MemZipFileCreator) OpenFile(fileName string) io.Writer {
 	if m.err != nil {
 		return &nullWriter{}
@@ -44,6 +63,7 @@ func (m *MemZipFileCreator) OpenFile(fileName string) io.Writer {
 	}
 
 	m.files[fileName] = bytes.NewBuffer(nil)
+	m.manifest.AddFile(fileName)
 
 	return m.files[fileName]
 }
@@ -59,6 +79,7 @@ func (m *MemZipFileCreator) AddFile(fileName string, data []byte) QueueZipFileWr
 	}
 
 	m.files[fileName] = bytes.NewBuffer(data)
+	m.manifest.AddFile(fileName)
 	return m
 }
 func (m *MemZipFileCreator) AddFileReader(fileName string, r io.Reader) QueueZipFileWriter {
@@ -70,18 +91,78 @@ func (m *MemZipFileCreator) AddFileReader(fileName string, r io.Reader) QueueZip
 	io.Copy(b, r)
 	return m.AddFile(fileName, b.Bytes())
 }
+
+// Finalize is not supported, there is no file. Use FinalizeBytes or Reader.
 func (m *MemZipFileCreator) Finalize() (string, error) {
-	return "", errors.New("memZipFileCreator does not support Finalize")
+	return "", errors.New("memZipFileCreator does not support Finalize, use FinalizeBytes")
 }
 
-func (z *MemZipFileCreator) AttachMetadata(fileName string, metadata *Metadata) QueueZipFileWriter {
-	if z.err != nil {
-		return z
+func (m *MemZipFileCreator) Discard() {
+	m.files = make(map[string]*bytes.Buffer)
+	if m.err == nil {
+		m.err = errDiscarded
+	}
+}
+
+// FinalizeBytes returns the bundle as zip data, ready for Queue.Enqueue.
+func (m *MemZipFileCreator) FinalizeBytes() ([]byte, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+
+	buf := bytes.NewBuffer(nil)
+	zipWriter := zip.NewWriter(buf)
+	manifest := m.Manifest()
+	for _, fileName := range manifest.FileNames() {
+		file, err := zipWriter.CreateHeader(&zip.FileHeader{
+			Name:   fileName,
+			Method: compressionMethod(fileName),
+		})
+		if err != nil {
+			return nil, err
+		}
+		_, err = file.Write(m.files[fileName].Bytes())
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	data, err := manifest.Serialize()
+	if err != nil {
+		return nil, err
+	}
+	file, err := zipWriter.Create(manifestFileName)
+	if err != nil {
+		return nil, err
+	}
+	_, err = file.Write(data)
+	if err != nil {
+		return nil, err
+	}
+
+	err = zipWriter.Close()
+	if err != nil {
+		return nil, err
 	}
 
-	if metadata == nil || metadata.IsEmpty() {
+	return buf.Bytes(), nil
+}
+
+// Reader finalizes the bundle and opens it for reading.
+func (m *MemZipFileCreator) Reader() (QueueZipFileReader, error) {
+	data, err := m.FinalizeBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	return CreateZipFileReader(&filequeue.MemQueryFile{Data: data})
+}
+
+func (z *MemZipFileCreator) AttachMetadata(fileName string, metadata *Metadata) QueueZipFileWriter {
+	if z.err != nil {
 		return z
 	}
 
-	return z.AddFile(".metadata."+fileName, metadata.Serialize())
+	attachMetadata(z.manifest, fileName, metadata)
+	return z
 }
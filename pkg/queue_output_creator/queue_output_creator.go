@@ -1,20 +1,40 @@
 package queueoutputcreator
 
 import (
+	"errors"
 	"io"
+	"io/fs"
 )
 
+var errDiscarded = errors.New("bundle was discarded")
+
 type QueueZipFileWriter interface {
 	FileCount() int
 	OpenFile(fileName string) io.Writer
 	AddFile(fileName string, data []byte) QueueZipFileWriter
 	AddFileReader(fileName string, r io.Reader) QueueZipFileWriter
 	AttachMetadata(fileName string, metadata *Metadata) QueueZipFileWriter
+	// Manifest is written into the bundle on Finalize. Entries for added
+	// files are created automatically.
+	Manifest() *Manifest
 	Finalize() (string, error)
+	// Discard removes the temporary files of a bundle that is not
+	// finalized, e.g. because the stage failed. The writer cannot be used
+	// afterwards.
+	Discard()
 	Error() error
 }
 
 type QueueZipFileReader interface {
-	GetFile(fileName string) (*ZipFile, error)
+	GetFile(fileName string) (BundleFile, error)
 	FileNames() []string
+	Manifest() *Manifest
+}
+
+// BundleFile is a single file of a bundle.
+type BundleFile interface {
+	Open() (io.ReadCloser, error)
+	FileInfo() fs.FileInfo
+	Metadata() map[string]string
+	Entry() *FileEntry
 }
@@ -7,8 +7,8 @@ import (
 )
 
 type ZipFile struct {
-	File     *zip.File
-	metadata *Metadata
+	File  *zip.File
+	entry *FileEntry
 }
 
 func (z *ZipFile) Open() (io.ReadCloser, error) {
@@ -24,8 +24,16 @@ func (z *ZipFile) FileInfo() fs.FileInfo {
 }
 
 func (z *ZipFile) Metadata() map[string]string {
-	if z.metadata == nil {
+	if z.entry == nil {
 		return make(map[string]string)
 	}
-	return z.metadata.ToMap()
+	return z.entry.ToMap()
+}
+
+// Entry returns the typed manifest entry of the file.
+func (z *ZipFile) Entry() *FileEntry {
+	if z.entry == nil {
+		return &FileEntry{Name: z.File.Name, Kind: kindForFileName(z.File.Name)}
+	}
+	return z.entry
 }
@@ -0,0 +1,9 @@
+//go:build !sane
+
+package scan
+
+// Without the sane build tag scanners run scanimage, which needs no libsane
+// headers at build time.
+func newDeviceScanner(opts Options, selector DeviceSelector) Scanner {
+	return NewDeviceScanner(opts, selector)
+}
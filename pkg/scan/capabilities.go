@@ -0,0 +1,176 @@
+package scan
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// DeviceOption is an option a device reports in `scanimage -A`.
+type DeviceOption struct {
+	Name string
+	// Values are the allowed values of a list option.
+	Values []string
+	// IsRange is set for options that accept any number in Min..Max.
+	IsRange  bool
+	Min, Max float64
+	Unit     string
+	IsBool   bool
+	Inactive bool
+	// ReadOnly options are sensors, like the buttons of the device.
+	ReadOnly bool
+	// Value is the current value.
+	Value string
+}
+
+// Capabilities are the options of one device, keyed by the option name as
+// it is passed to scanimage, e.g. "--resolution" or "-x".
+type Capabilities map[string]DeviceOption
+
+var optionLinePattern = regexp.MustCompile(`^\s+(-{1,2}[\w-]+)(\[=\(yes\|no\)\])?\s*(.*?)((?:\s*\[[^\]]*\])*)$`)
+var bracketPattern = regexp.MustCompile(`\[([^\]]*)\]`)
+var rangePattern = regexp.MustCompile(`^(-?[\d.]+)\.\.(-?[\d.]+)([a-z%]*)`)
+var unitPattern = regexp.MustCompile(`^(-?[\d.]+)([a-z%]*)$`)
+
+// DeviceCapabilities asks scanimage for the options of device.
+func DeviceCapabilities(device string) (Capabilities, error) {
+	output, err := execCommand("scanimage", "--all-options", "--device-name", device)
+	if err != nil {
+		return nil, err
+	}
+
+	return parseCapabilities(output), nil
+}
+
+func parseCapabilities(output string) Capabilities {
+	caps := make(Capabilities)
+	for _, line := range strings.Split(output, "\n") {
+		match := optionLinePattern.FindStringSubmatch(line)
+		if match == nil {
+			continue
+		}
+
+		option := DeviceOption{
+			Name:   match[1],
+			IsBool: match[2] != "",
+		}
+		for i, bracket := range bracketPattern.FindAllStringSubmatch(match[4], -1) {
+			switch bracket[1] {
+			case "inactive":
+				option.Inactive = true
+			case "read-only":
+				option.ReadOnly = true
+			case "hardware", "auto":
+			default:
+				if i == 0 {
+					option.Value = bracket[1]
+				}
+			}
+		}
+
+		constraint := match[3]
+		if rangeMatch := rangePattern.FindStringSubmatch(constraint); rangeMatch != nil {
+			option.IsRange = true
+			option.Min, _ = strconv.ParseFloat(rangeMatch[1], 64)
+			option.Max, _ = strconv.ParseFloat(rangeMatch[2], 64)
+			option.Unit = rangeMatch[3]
+		} else if constraint != "" {
+			for _, value := range strings.Split(constraint, "|") {
+				if unitMatch := unitPattern.FindStringSubmatch(value); unitMatch != nil {
+					value = unitMatch[1]
+					option.Unit = unitMatch[2]
+				}
+				option.Values = append(option.Values, value)
+			}
+		}
+
+		caps[option.Name] = option
+	}
+
+	return caps
+}
+
+// Accepts checks value against the constraint of the option.
+func (o DeviceOption) Accepts(value string) error {
+	if o.Inactive {
+		return fmt.Errorf("option %s is inactive", o.Name)
+	}
+	if o.ReadOnly {
+		return fmt.Errorf("option %s is read-only", o.Name)
+	}
+
+	switch {
+	case o.IsBool:
+		if value != "yes" && value != "no" {
+			return fmt.Errorf("option %s expects yes or no, got %q", o.Name, value)
+		}
+	case o.IsRange:
+		number, err := strconv.ParseFloat(strings.TrimSuffix(value, o.Unit), 64)
+		if err != nil {
+			return fmt.Errorf("option %s expects a number, got %q", o.Name, value)
+		}
+		if number < o.Min || number > o.Max {
+			return fmt.Errorf("option %s must be in %g..%g%s, got %s", o.Name, o.Min, o.Max, o.Unit, value)
+		}
+	case len(o.Values) > 0:
+		if !slices.Contains(o.Values, strings.TrimSuffix(value, o.Unit)) {
+			return fmt.Errorf("option %s must be one of %s, got %q", o.Name, strings.Join(o.Values, "|"), value)
+		}
+	}
+	return nil
+}
+
+// findValue returns the first allowed value of a list option that contains
+// one of the keywords, ignoring case.
+func (o DeviceOption) findValue(keywords ...string) (string, bool) {
+	for _, keyword := range keywords {
+		for _, value := range o.Values {
+			if containsAny(value, keyword) {
+				return value, true
+			}
+		}
+	}
+	return "", false
+}
+
+func containsAny(value string, keywords ...string) bool {
+	value = strings.ToLower(value)
+	for _, keyword := range keywords {
+		if strings.Contains(value, keyword) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkArg validates a raw scanimage argument like "--swdeskew=yes". Values
+// passed as separate arguments are not checked.
+func (c Capabilities) checkArg(arg string) error {
+	if !strings.HasPrefix(arg, "-") {
+		return nil
+	}
+
+	name, value, hasValue := strings.Cut(arg, "=")
+	option, ok := c[name]
+	if !ok {
+		return fmt.Errorf("device has no option %s", name)
+	}
+	if hasValue {
+		return option.Accepts(value)
+	}
+	return nil
+}
+
+// Sensors returns the state of the read-only switches of the device, like
+// its buttons, keyed by option name without dashes.
+func (c Capabilities) Sensors() map[string]bool {
+	sensors := make(map[string]bool)
+	for name, option := range c {
+		if option.IsBool && option.ReadOnly && !option.Inactive {
+			sensors[strings.TrimLeft(name, "-")] = option.Value == "yes"
+		}
+	}
+	return sensors
+}
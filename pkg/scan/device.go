@@ -0,0 +1,216 @@
+package scan
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var sysfsUsbDevices = "/sys/bus/usb/devices"
+
+// deviceListFormat makes scanimage print one tab separated line per device.
+const deviceListFormat = "%d\t%v\t%m\t%t%n"
+
+var ErrDeviceNotFound = errors.New("device not found")
+
+const (
+	DriverSane      = "sane"
+	DriverEscl      = "escl"
+	DriverSimulated = "simulated"
+)
+
+type Device struct {
+	Name   string
+	Vendor string
+	Model  string
+	Type   string
+	// Serial is the USB serial number if it could be determined.
+	Serial string
+}
+
+// DeviceSelector picks a scanner. All fields that are set must match.
+type DeviceSelector struct {
+	// Name is the exact SANE device name, e.g. "epson2:libusb:001:004".
+	// It changes when the device is plugged into another port. eSCL devices
+	// are named "escl:" and their url.
+	Name string `yaml:"name"`
+	// Model is a regular expression matched against the model name.
+	Model  string `yaml:"model"`
+	Vendor string `yaml:"vendor"`
+	// Serial is the USB serial number of the device.
+	Serial string `yaml:"serial"`
+	// Driver is "sane" (default) for local scanners, "escl" for network
+	// scanners or "simulated" for development and tests.
+	Driver string `yaml:"driver"`
+}
+
+func (s DeviceSelector) Validate() error {
+	switch s.Driver {
+	case "", DriverSane, DriverEscl, DriverSimulated:
+	default:
+		return fmt.Errorf("unknown scanner driver %q", s.Driver)
+	}
+
+	if s.Name == "" && s.Model == "" && s.Vendor == "" && s.Serial == "" && s.Driver != DriverEscl && s.Driver != DriverSimulated {
+		return errors.New("device selector is empty")
+	}
+
+	_, err := regexp.Compile(s.Model)
+	if err != nil {
+		return fmt.Errorf("invalid model pattern: %w", err)
+	}
+	return nil
+}
+
+func (s DeviceSelector) Matches(device Device) bool {
+	if s.Name != "" && s.Name != device.Name {
+		return false
+	}
+	if s.Vendor != "" && !strings.EqualFold(s.Vendor, device.Vendor) {
+		return false
+	}
+	if s.Model != "" {
+		matched, err := regexp.MatchString(s.Model, device.Model)
+		if err != nil || !matched {
+			return false
+		}
+	}
+	if s.Serial != "" && s.Serial != device.Serial && !nameContainsSerial(device.Name, s.Serial) {
+		return false
+	}
+	return true
+}
+
+func (s DeviceSelector) String() string {
+	var parts []string
+	for _, part := range []struct{ key, value string }{
+		{"name", s.Name},
+		{"vendor", s.Vendor},
+		{"model", s.Model},
+		{"serial", s.Serial},
+	} {
+		if part.value != "" {
+			parts = append(parts, part.key+"="+part.value)
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// nameContainsSerial handles backends like epsonscan2 that put the serial
+// number into the device name.
+func nameContainsSerial(deviceName, serial string) bool {
+	for _, part := range strings.Split(deviceName, ":") {
+		if part == serial {
+			return true
+		}
+	}
+	return false
+}
+
+func findDevice(selector DeviceSelector) (Device, error) {
+	devices, err := ListDevices()
+	if err != nil {
+		return Device{}, err
+	}
+
+	for _, device := range devices {
+		if selector.Matches(device) {
+			return device, nil
+		}
+	}
+
+	return Device{}, fmt.Errorf("%w: %s", ErrDeviceNotFound, selector)
+}
+
+// ListDevices returns all scanners SANE can see.
+func ListDevices() ([]Device, error) {
+	output, err := execCommand("scanimage", "--formatted-device-list", deviceListFormat)
+	if err != nil {
+		return nil, err
+	}
+
+	return parseDeviceList(output), nil
+}
+
+func parseDeviceList(output string) []Device {
+	var devices []Device
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Split(line, "\t")
+		if len(fields) < 4 || fields[0] == "" {
+			continue
+		}
+
+		device := Device{
+			Name:   fields[0],
+			Vendor: fields[1],
+			Model:  fields[2],
+			Type:   fields[3],
+		}
+		device.Serial = usbSerial(device.Name)
+		devices = append(devices, device)
+	}
+
+	return devices
+}
+
+// usbSerial looks up the serial number of devices that are addressed by USB
+// bus and device number, like "epson2:libusb:001:004".
+func usbSerial(deviceName string) string {
+	parts := strings.Split(deviceName, ":")
+	for i := 0; i+2 < len(parts); i++ {
+		if parts[i] != "libusb" {
+			continue
+		}
+
+		bus, err := strconv.Atoi(parts[i+1])
+		if err != nil {
+			return ""
+		}
+		dev, err := strconv.Atoi(parts[i+2])
+		if err != nil {
+			return ""
+		}
+		return sysfsSerial(bus, dev)
+	}
+
+	return ""
+}
+
+func sysfsSerial(bus, dev int) string {
+	entries, err := os.ReadDir(sysfsUsbDevices)
+	if err != nil {
+		return ""
+	}
+
+	for _, entry := range entries {
+		dir := filepath.Join(sysfsUsbDevices, entry.Name())
+		if readSysfsInt(filepath.Join(dir, "busnum")) != bus || readSysfsInt(filepath.Join(dir, "devnum")) != dev {
+			continue
+		}
+
+		serial, err := os.ReadFile(filepath.Join(dir, "serial"))
+		if err != nil {
+			return ""
+		}
+		return strings.TrimSpace(string(serial))
+	}
+
+	return ""
+}
+
+func readSysfsInt(filePath string) int {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return -1
+	}
+
+	value, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		return -1
+	}
+	return value
+}
@@ -0,0 +1,52 @@
+package scan
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func fakeUsbDevice(t *testing.T, root, name, bus, dev, serial string) {
+	dir := filepath.Join(root, name)
+	assert.NoError(t, os.MkdirAll(dir, 0o755))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "busnum"), []byte(bus+"\n"), 0o644))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "devnum"), []byte(dev+"\n"), 0o644))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "serial"), []byte(serial+"\n"), 0o644))
+}
+
+func TestParseDeviceList(t *testing.T) {
+	oldSysfs := sysfsUsbDevices
+	sysfsUsbDevices = t.TempDir()
+	t.Cleanup(func() { sysfsUsbDevices = oldSysfs })
+	fakeUsbDevice(t, sysfsUsbDevices, "1-1", "1", "4", "X4Y9012")
+	fakeUsbDevice(t, sysfsUsbDevices, "1-2", "1", "5", "OTHER")
+
+	devices := parseDeviceList("epson2:libusb:001:004\tEpson\tDS-530\tsheetfed scanner\n" +
+		"epsonscan2:DS-C490:584251413030303218:esci2:usb:ES0264:401\tEPSON\tDS-C490\tsheetfed scanner\n" +
+		"\n")
+
+	assert.Equal(t, []Device{
+		{Name: "epson2:libusb:001:004", Vendor: "Epson", Model: "DS-530", Type: "sheetfed scanner", Serial: "X4Y9012"},
+		{Name: "epsonscan2:DS-C490:584251413030303218:esci2:usb:ES0264:401", Vendor: "EPSON", Model: "DS-C490", Type: "sheetfed scanner"},
+	}, devices)
+}
+
+func TestDeviceSelectorMatches(t *testing.T) {
+	usb := Device{Name: "epson2:libusb:001:004", Vendor: "Epson", Model: "DS-530", Serial: "X4Y9012"}
+	epsonscan := Device{Name: "epsonscan2:DS-C490:584251413030303218:esci2:usb:ES0264:401", Vendor: "EPSON", Model: "DS-C490"}
+
+	assert.True(t, DeviceSelector{Name: "epson2:libusb:001:004"}.Matches(usb))
+	assert.False(t, DeviceSelector{Name: "epson2:libusb:001"}.Matches(usb))
+	assert.True(t, DeviceSelector{Model: "^DS-5"}.Matches(usb))
+	assert.False(t, DeviceSelector{Model: "^DS-5"}.Matches(epsonscan))
+	assert.True(t, DeviceSelector{Vendor: "epson", Model: "C490"}.Matches(epsonscan))
+	assert.True(t, DeviceSelector{Serial: "X4Y9012"}.Matches(usb))
+	assert.True(t, DeviceSelector{Serial: "584251413030303218"}.Matches(epsonscan))
+	assert.False(t, DeviceSelector{Serial: "X4Y9012", Vendor: "Canon"}.Matches(usb))
+
+	assert.Error(t, DeviceSelector{}.Validate())
+	assert.Error(t, DeviceSelector{Model: "("}.Validate())
+	assert.NoError(t, DeviceSelector{Serial: "X4Y9012"}.Validate())
+}
@@ -0,0 +1,504 @@
+package scan
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const esclDevicePrefix = "escl:"
+
+// esclUnitsPerMm converts millimeters into the 1/300 inch units of eSCL.
+const esclUnitsPerMm = 300 / 25.4
+
+// esclBusyRetries limits how often a busy device is asked for the next page.
+var esclBusyRetries = 30
+var esclBusyWait = time.Second
+
+var esclClient = &http.Client{Timeout: 2 * time.Minute}
+
+type EsclOptions struct {
+	// Urls are eSCL endpoints, e.g. "http://192.168.1.20/eSCL".
+	Urls []string `yaml:"urls"`
+	// Discover finds eSCL devices on the local network via mDNS.
+	Discover bool `yaml:"discover"`
+}
+
+type esclInputCaps struct {
+	MinWidth  int `xml:"MinWidth"`
+	MaxWidth  int `xml:"MaxWidth"`
+	MinHeight int `xml:"MinHeight"`
+	MaxHeight int `xml:"MaxHeight"`
+	Profiles  []struct {
+		ColorModes      []string `xml:"ColorModes>ColorMode"`
+		DocumentFormats []string `xml:"DocumentFormats>DocumentFormat"`
+		Resolutions     []struct {
+			X int `xml:"XResolution"`
+			Y int `xml:"YResolution"`
+		} `xml:"SupportedResolutions>DiscreteResolutions>DiscreteResolution"`
+	} `xml:"SettingProfiles>SettingProfile"`
+}
+
+type esclRange struct {
+	Min int `xml:"Min"`
+	Max int `xml:"Max"`
+}
+
+// esclCapabilities is the part of ScannerCapabilities the driver uses.
+type esclCapabilities struct {
+	MakeAndModel string         `xml:"MakeAndModel"`
+	Manufacturer string         `xml:"Manufacturer"`
+	SerialNumber string         `xml:"SerialNumber"`
+	Platen       *esclInputCaps `xml:"Platen>PlatenInputCaps"`
+	AdfSimplex   *esclInputCaps `xml:"Adf>AdfSimplexInputCaps"`
+	AdfDuplex    *esclInputCaps `xml:"Adf>AdfDuplexInputCaps"`
+	Brightness   *esclRange     `xml:"BrightnessSupport"`
+	Contrast     *esclRange     `xml:"ContrastSupport"`
+}
+
+type esclStatus struct {
+	State    string `xml:"State"`
+	AdfState string `xml:"AdfState"`
+}
+
+type esclScanRegion struct {
+	Height  int    `xml:"pwg:Height"`
+	Units   string `xml:"pwg:ContentRegionUnits"`
+	Width   int    `xml:"pwg:Width"`
+	XOffset int    `xml:"pwg:XOffset"`
+	YOffset int    `xml:"pwg:YOffset"`
+}
+
+// esclScanSettings is marshalled with the namespace prefixes devices expect.
+type esclScanSettings struct {
+	XMLName        xml.Name         `xml:"scan:ScanSettings"`
+	ScanNs         string           `xml:"xmlns:scan,attr"`
+	PwgNs          string           `xml:"xmlns:pwg,attr"`
+	Version        string           `xml:"pwg:Version"`
+	ScanRegions    []esclScanRegion `xml:"pwg:ScanRegions>pwg:ScanRegion"`
+	InputSource    string           `xml:"pwg:InputSource"`
+	Duplex         *bool            `xml:"scan:Duplex,omitempty"`
+	ColorMode      string           `xml:"scan:ColorMode,omitempty"`
+	XResolution    int              `xml:"scan:XResolution"`
+	YResolution    int              `xml:"scan:YResolution"`
+	DocumentFormat string           `xml:"pwg:DocumentFormat"`
+	Brightness     *int             `xml:"scan:Brightness,omitempty"`
+	Contrast       *int             `xml:"scan:Contrast,omitempty"`
+}
+
+// EsclScanner drives network scanners that speak eSCL, also known as
+// AirScan.
+type EsclScanner struct {
+	mutex    sync.Mutex
+	options  Options
+	selector DeviceSelector
+	baseUrl  string
+	caps     *esclCapabilities
+}
+
+func NewEsclScanner(opts Options, selector DeviceSelector) *EsclScanner {
+	return &EsclScanner{
+		options:  opts,
+		selector: selector,
+	}
+}
+
+func (s *EsclScanner) Device() string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.baseUrl != "" {
+		return esclDevicePrefix + s.baseUrl
+	}
+	return s.selector.String()
+}
+
+// ListEsclDevices returns the configured and discovered eSCL devices that
+// answer.
+func ListEsclDevices(opts EsclOptions) []Device {
+	urls := slices.Clone(opts.Urls)
+	if opts.Discover {
+		discovered, err := discoverEscl()
+		if err != nil {
+			logrus.WithError(err).Warn("Failed to discover eSCL devices")
+		}
+		urls = append(urls, discovered...)
+	}
+
+	var devices []Device
+	for _, baseUrl := range urls {
+		baseUrl = strings.TrimSuffix(baseUrl, "/")
+		caps, err := getEsclCapabilities(baseUrl)
+		if err != nil {
+			logrus.WithError(err).WithField("url", baseUrl).Debug("eSCL device does not answer")
+			continue
+		}
+
+		devices = append(devices, caps.device(baseUrl))
+	}
+	return devices
+}
+
+func (c *esclCapabilities) device(baseUrl string) Device {
+	vendor := c.Manufacturer
+	if vendor == "" {
+		vendor, _, _ = strings.Cut(c.MakeAndModel, " ")
+	}
+
+	return Device{
+		Name:   esclDevicePrefix + baseUrl,
+		Vendor: vendor,
+		Model:  c.MakeAndModel,
+		Type:   "escl",
+		Serial: c.SerialNumber,
+	}
+}
+
+func (s *EsclScanner) detect() error {
+	if s.baseUrl != "" {
+		return nil
+	}
+
+	for _, device := range ListEsclDevices(s.options.Escl) {
+		if !s.selector.Matches(device) {
+			continue
+		}
+
+		baseUrl := strings.TrimPrefix(device.Name, esclDevicePrefix)
+		caps, err := getEsclCapabilities(baseUrl)
+		if err != nil {
+			return err
+		}
+
+		logrus.WithField("device", device.Name).WithField("model", device.Model).Info("Detected eSCL device")
+		s.baseUrl = baseUrl
+		s.caps = caps
+		return nil
+	}
+
+	return fmt.Errorf("%w: %s", ErrDeviceNotFound, s.selector)
+}
+
+func (s *EsclScanner) Scan(dir string) ([]string, error) {
+	return s.ScanWith(dir, s.options.Settings)
+}
+
+// ScanWith scans with settings instead of the configured settings.
+func (s *EsclScanner) ScanWith(dir string, settings Settings) ([]string, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	err := s.detect()
+	if err != nil {
+		return nil, err
+	}
+
+	jobSettings, err := settings.esclSettings(s.caps)
+	if err != nil {
+		return nil, fmt.Errorf("settings for %s: %w", s.baseUrl, err)
+	}
+
+	imagePaths, err := s.scan(dir, jobSettings)
+	if err != nil {
+		for _, imagePath := range imagePaths {
+			os.Remove(imagePath)
+		}
+	}
+	if errors.Is(err, ErrDeviceAbsent) {
+		// the address may change, find the device again on the next scan
+		logrus.WithField("url", s.baseUrl).Debug("Device failed, detecting it again on the next scan")
+		s.baseUrl = ""
+	}
+	if err != nil {
+		return nil, err
+	}
+	return imagePaths, nil
+}
+
+func (s *EsclScanner) scan(dir string, settings *esclScanSettings) ([]string, error) {
+	status, err := getEsclStatus(s.baseUrl)
+	if err != nil {
+		return nil, err
+	}
+	if settings.InputSource == "Feeder" {
+		if err := status.adfError(); err != nil {
+			return nil, err
+		}
+	}
+
+	jobUrl, err := postEsclJob(s.baseUrl, settings)
+	if err != nil {
+		return nil, err
+	}
+
+	var imagePaths []string
+	for page := 1; ; page++ {
+		imagePath, err := nextEsclDocument(jobUrl, filepath.Join(dir, fmt.Sprintf("scan-%03d", page)))
+		if errors.Is(err, errNoMorePages) {
+			return imagePaths, nil
+		}
+		if err != nil {
+			cancelEsclJob(jobUrl)
+			if status, statusErr := getEsclStatus(s.baseUrl); statusErr == nil && status.adfError() != nil {
+				err = status.adfError()
+			}
+			return imagePaths, err
+		}
+		imagePaths = append(imagePaths, imagePath)
+	}
+}
+
+func (s esclStatus) adfError() error {
+	switch s.AdfState {
+	case "ScannerAdfEmpty":
+		return ErrNoDocs
+	case "ScannerAdfJam", "ScannerAdfMispick":
+		return ErrJammed
+	case "ScannerAdfMultipickDetected":
+		return ErrDoubleFeed
+	case "ScannerAdfHatchOpen", "ScannerAdfDoorOpen":
+		return ErrCoverOpen
+	}
+	return nil
+}
+
+// esclSettings translates the settings into an eSCL job and checks them
+// against the capabilities of the device.
+func (s Settings) esclSettings(caps *esclCapabilities) (*esclScanSettings, error) {
+	s = s.withDefaults()
+	err := s.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	settings := &esclScanSettings{
+		ScanNs:      "http://schemas.hp.com/imaging/escl/2011/05/03",
+		PwgNs:       "http://www.pwg.org/schemas/2010/12/sm",
+		Version:     "2.0",
+		XResolution: s.Resolution,
+		YResolution: s.Resolution,
+	}
+
+	var input *esclInputCaps
+	switch s.Source {
+	case SourceFlatbed:
+		input = caps.Platen
+		settings.InputSource = "Platen"
+	case SourceADF:
+		input = caps.AdfSimplex
+		settings.InputSource = "Feeder"
+		if caps.AdfDuplex != nil {
+			settings.Duplex = new(bool)
+		}
+	case SourceDuplex:
+		input = caps.AdfDuplex
+		settings.InputSource = "Feeder"
+		duplex := true
+		settings.Duplex = &duplex
+	}
+	if input == nil || len(input.Profiles) == 0 {
+		return nil, fmt.Errorf("device does not support scan source %s", s.Source)
+	}
+	profile := input.Profiles[0]
+
+	resolutionOk := false
+	for _, resolution := range profile.Resolutions {
+		resolutionOk = resolutionOk || resolution.X == s.Resolution && resolution.Y == s.Resolution
+	}
+	if !resolutionOk {
+		return nil, fmt.Errorf("device does not support a resolution of %ddpi", s.Resolution)
+	}
+
+	if s.Mode != "" {
+		modes := map[string]string{ModeColor: "RGB24", ModeGray: "Grayscale8", ModeLineart: "BlackAndWhite1"}
+		settings.ColorMode = modes[s.Mode]
+		if !slices.Contains(profile.ColorModes, settings.ColorMode) {
+			return nil, fmt.Errorf("device does not support scan mode %s", s.Mode)
+		}
+	}
+
+	switch {
+	case slices.Contains(profile.DocumentFormats, "image/png"):
+		settings.DocumentFormat = "image/png"
+	case slices.Contains(profile.DocumentFormats, "image/jpeg"):
+		settings.DocumentFormat = "image/jpeg"
+	default:
+		return nil, errors.New("device delivers neither png nor jpeg")
+	}
+
+	region := esclScanRegion{Units: "escl:ThreeHundredthsOfInches", Width: input.MaxWidth, Height: input.MaxHeight}
+	if s.PaperSize != "" {
+		size := PaperSizes[s.PaperSize]
+		region.Width = int(size[0]*esclUnitsPerMm + 0.5)
+		region.Height = int(size[1]*esclUnitsPerMm + 0.5)
+		if region.Width > input.MaxWidth || region.Height > input.MaxHeight {
+			return nil, fmt.Errorf("paper size %s is larger than the scan area", s.PaperSize)
+		}
+	}
+	settings.ScanRegions = []esclScanRegion{region}
+
+	if s.Brightness != nil {
+		if caps.Brightness == nil || *s.Brightness < caps.Brightness.Min || *s.Brightness > caps.Brightness.Max {
+			return nil, fmt.Errorf("device does not support a brightness of %d", *s.Brightness)
+		}
+		settings.Brightness = s.Brightness
+	}
+	if s.Contrast != nil {
+		if caps.Contrast == nil || *s.Contrast < caps.Contrast.Min || *s.Contrast > caps.Contrast.Max {
+			return nil, fmt.Errorf("device does not support a contrast of %d", *s.Contrast)
+		}
+		settings.Contrast = s.Contrast
+	}
+
+	return settings, nil
+}
+
+func getEsclCapabilities(baseUrl string) (*esclCapabilities, error) {
+	caps := &esclCapabilities{}
+	return caps, getEsclXml(baseUrl+"/ScannerCapabilities", caps)
+}
+
+func getEsclStatus(baseUrl string) (*esclStatus, error) {
+	status := &esclStatus{}
+	return status, getEsclXml(baseUrl+"/ScannerStatus", status)
+}
+
+func getEsclXml(url string, v any) error {
+	resp, err := esclClient.Get(url)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrDeviceAbsent, err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return fmt.Errorf("%w: GET %s: %s", ErrPermissionDenied, url, resp.Status)
+	default:
+		return fmt.Errorf("GET %s: %s", url, resp.Status)
+	}
+	return xml.NewDecoder(resp.Body).Decode(v)
+}
+
+func postEsclJob(baseUrl string, settings *esclScanSettings) (string, error) {
+	body, err := xml.Marshal(settings)
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := esclClient.Post(baseUrl+"/ScanJobs", "text/xml", bytes.NewReader(append([]byte(xml.Header), body...)))
+	if err != nil {
+		return "", fmt.Errorf("%w: %w", ErrDeviceAbsent, err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusCreated:
+	case http.StatusServiceUnavailable, http.StatusConflict:
+		return "", ErrDeviceBusy
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return "", fmt.Errorf("%w: create scan job: %s", ErrPermissionDenied, resp.Status)
+	default:
+		return "", fmt.Errorf("create scan job: %s", resp.Status)
+	}
+
+	location, err := resp.Location()
+	if err != nil {
+		return "", fmt.Errorf("create scan job: %w", err)
+	}
+	return strings.TrimSuffix(location.String(), "/"), nil
+}
+
+var errNoMorePages = errors.New("no more pages")
+
+// esclPageExtensions are the file extensions of the page formats a job may
+// deliver.
+var esclPageExtensions = map[string]string{
+	"image/png":  ".png",
+	"image/jpeg": ".jpg",
+}
+
+// nextEsclDocument streams the next page to filePath plus the extension of
+// the format the device sent. Pages are written as they are, not decoded.
+func nextEsclDocument(jobUrl string, filePath string) (string, error) {
+	for retry := 0; ; retry++ {
+		resp, err := esclClient.Get(jobUrl + "/NextDocument")
+		if err != nil {
+			return "", fmt.Errorf("%w: %w", ErrDeviceAbsent, err)
+		}
+
+		switch resp.StatusCode {
+		case http.StatusOK:
+			defer resp.Body.Close()
+			return writeEsclPage(resp, filePath)
+		case http.StatusNotFound:
+			resp.Body.Close()
+			return "", errNoMorePages
+		case http.StatusServiceUnavailable:
+			resp.Body.Close()
+			if retry >= esclBusyRetries {
+				return "", ErrDeviceBusy
+			}
+			time.Sleep(esclBusyWait)
+		default:
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+			return "", fmt.Errorf("get next page: %s", resp.Status)
+		}
+	}
+}
+
+func writeEsclPage(resp *http.Response, filePath string) (string, error) {
+	// some devices send no or a generic content type
+	body := bufio.NewReader(resp.Body)
+	contentType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if _, ok := esclPageExtensions[contentType]; !ok {
+		head, _ := body.Peek(512)
+		contentType, _, _ = mime.ParseMediaType(http.DetectContentType(head))
+	}
+	ext, ok := esclPageExtensions[contentType]
+	if !ok {
+		return "", fmt.Errorf("unsupported page format %q", contentType)
+	}
+
+	filePath += ext
+	f, err := os.Create(filePath)
+	if err != nil {
+		return "", err
+	}
+
+	_, err = io.Copy(f, body)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(filePath)
+		return "", err
+	}
+	return filePath, nil
+}
+
+func cancelEsclJob(jobUrl string) {
+	req, err := http.NewRequest(http.MethodDelete, jobUrl, nil)
+	if err != nil {
+		return
+	}
+
+	resp, err := esclClient.Do(req)
+	if err == nil {
+		resp.Body.Close()
+	}
+}
@@ -0,0 +1,133 @@
+package scan
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+	"slices"
+	"strings"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+var esclDiscoveryTimeout = 2 * time.Second
+
+var esclServices = map[string]string{
+	"_uscan._tcp.local.":  "http",
+	"_uscans._tcp.local.": "https",
+}
+
+var mdnsAddr = &net.UDPAddr{IP: net.IPv4(224, 0, 0, 251), Port: 5353}
+
+// discoverEscl asks the local network for eSCL scanners via mDNS and returns
+// their base urls.
+func discoverEscl() ([]string, error) {
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{})
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	query, err := esclQuery()
+	if err != nil {
+		return nil, err
+	}
+	_, err = conn.WriteToUDP(query, mdnsAddr)
+	if err != nil {
+		return nil, err
+	}
+
+	var responses [][]byte
+	conn.SetReadDeadline(time.Now().Add(esclDiscoveryTimeout))
+	for {
+		buf := make([]byte, 9000)
+		n, _, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			break
+		}
+		responses = append(responses, buf[:n])
+	}
+
+	return parseEsclResponses(responses), nil
+}
+
+func esclQuery() ([]byte, error) {
+	builder := dnsmessage.NewBuilder(nil, dnsmessage.Header{})
+	builder.EnableCompression()
+	err := builder.StartQuestions()
+	if err != nil {
+		return nil, err
+	}
+
+	for service := range esclServices {
+		err = builder.Question(dnsmessage.Question{
+			Name:  dnsmessage.MustNewName(service),
+			Type:  dnsmessage.TypePTR,
+			Class: dnsmessage.ClassINET,
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return builder.Finish()
+}
+
+type esclInstance struct {
+	scheme string
+	host   string
+	port   uint16
+	path   string
+}
+
+// parseEsclResponses collects the service instances from all mDNS answers.
+// Devices usually send PTR, SRV, TXT and address records in one response.
+func parseEsclResponses(responses [][]byte) []string {
+	instances := make(map[string]*esclInstance)
+	addresses := make(map[string]netip.Addr)
+	instance := func(name string) *esclInstance {
+		if instances[name] == nil {
+			instances[name] = &esclInstance{path: "/eSCL"}
+		}
+		return instances[name]
+	}
+
+	for _, response := range responses {
+		var msg dnsmessage.Message
+		if msg.Unpack(response) != nil {
+			continue
+		}
+
+		for _, resource := range append(msg.Answers, msg.Additionals...) {
+			name := resource.Header.Name.String()
+			switch body := resource.Body.(type) {
+			case *dnsmessage.PTRResource:
+				if scheme, ok := esclServices[name]; ok {
+					instance(body.PTR.String()).scheme = scheme
+				}
+			case *dnsmessage.SRVResource:
+				instance(name).host = body.Target.String()
+				instance(name).port = body.Port
+			case *dnsmessage.TXTResource:
+				for _, txt := range body.TXT {
+					if rs, ok := strings.CutPrefix(txt, "rs="); ok {
+						instance(name).path = "/" + strings.Trim(rs, "/")
+					}
+				}
+			case *dnsmessage.AResource:
+				addresses[name] = netip.AddrFrom4(body.A)
+			}
+		}
+	}
+
+	var urls []string
+	for _, i := range instances {
+		addr, ok := addresses[i.host]
+		if i.scheme == "" || !ok {
+			continue
+		}
+		urls = append(urls, fmt.Sprintf("%s://%s%s", i.scheme, netip.AddrPortFrom(addr, i.port), i.path))
+	}
+	slices.Sort(urls)
+	return urls
+}
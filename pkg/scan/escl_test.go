@@ -0,0 +1,317 @@
+package scan
+
+import (
+	"bytes"
+	"encoding/xml"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+const esclTestCapabilities = `<?xml version="1.0" encoding="UTF-8"?>
+<scan:ScannerCapabilities xmlns:scan="http://schemas.hp.com/imaging/escl/2011/05/03" xmlns:pwg="http://www.pwg.org/schemas/2010/12/sm">
+  <pwg:Version>2.63</pwg:Version>
+  <pwg:MakeAndModel>HP OfficeJet Pro 9010</pwg:MakeAndModel>
+  <pwg:SerialNumber>CN12345</pwg:SerialNumber>
+  <scan:Manufacturer>HP</scan:Manufacturer>
+  <scan:Platen>
+    <scan:PlatenInputCaps>
+      <scan:MinWidth>8</scan:MinWidth>
+      <scan:MaxWidth>2550</scan:MaxWidth>
+      <scan:MinHeight>8</scan:MinHeight>
+      <scan:MaxHeight>3508</scan:MaxHeight>
+      <scan:SettingProfiles>
+        <scan:SettingProfile>
+          <scan:ColorModes>
+            <scan:ColorMode>RGB24</scan:ColorMode>
+            <scan:ColorMode>Grayscale8</scan:ColorMode>
+          </scan:ColorModes>
+          <scan:DocumentFormats>
+            <pwg:DocumentFormat>application/pdf</pwg:DocumentFormat>
+            <pwg:DocumentFormat>image/jpeg</pwg:DocumentFormat>
+          </scan:DocumentFormats>
+          <scan:SupportedResolutions>
+            <scan:DiscreteResolutions>
+              <scan:DiscreteResolution><scan:XResolution>300</scan:XResolution><scan:YResolution>300</scan:YResolution></scan:DiscreteResolution>
+              <scan:DiscreteResolution><scan:XResolution>600</scan:XResolution><scan:YResolution>600</scan:YResolution></scan:DiscreteResolution>
+            </scan:DiscreteResolutions>
+          </scan:SupportedResolutions>
+        </scan:SettingProfile>
+      </scan:SettingProfiles>
+    </scan:PlatenInputCaps>
+  </scan:Platen>
+  <scan:Adf>
+    <scan:AdfSimplexInputCaps>
+      <scan:MaxWidth>2550</scan:MaxWidth>
+      <scan:MaxHeight>4200</scan:MaxHeight>
+      <scan:SettingProfiles>
+        <scan:SettingProfile>
+          <scan:ColorModes><scan:ColorMode>RGB24</scan:ColorMode></scan:ColorModes>
+          <scan:DocumentFormats><pwg:DocumentFormat>image/png</pwg:DocumentFormat></scan:DocumentFormats>
+          <scan:SupportedResolutions><scan:DiscreteResolutions>
+            <scan:DiscreteResolution><scan:XResolution>300</scan:XResolution><scan:YResolution>300</scan:YResolution></scan:DiscreteResolution>
+          </scan:DiscreteResolutions></scan:SupportedResolutions>
+        </scan:SettingProfile>
+      </scan:SettingProfiles>
+    </scan:AdfSimplexInputCaps>
+  </scan:Adf>
+  <scan:BrightnessSupport><scan:Min>0</scan:Min><scan:Max>100</scan:Max></scan:BrightnessSupport>
+</scan:ScannerCapabilities>`
+
+// esclJob is a scan job as the device parses it, by local names.
+type esclJob struct {
+	InputSource    string `xml:"InputSource"`
+	Duplex         *bool  `xml:"Duplex"`
+	XResolution    int    `xml:"XResolution"`
+	DocumentFormat string `xml:"DocumentFormat"`
+	Width          int    `xml:"ScanRegions>ScanRegion>Width"`
+	Height         int    `xml:"ScanRegions>ScanRegion>Height"`
+	Units          string `xml:"ScanRegions>ScanRegion>ContentRegionUnits"`
+}
+
+// fakeEscl is a minimal eSCL device. It delivers pages until they run out
+// or the adf state says otherwise.
+type fakeEscl struct {
+	mutex    sync.Mutex
+	adfState string
+	pages    int
+	jamAfter int
+	busy     int
+	jobs     []esclJob
+	canceled bool
+	// jpeg is sent as page instead of a png when set
+	jpeg []byte
+}
+
+func (f *fakeEscl) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /eSCL/ScannerCapabilities", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, esclTestCapabilities)
+	})
+	mux.HandleFunc("GET /eSCL/ScannerStatus", func(w http.ResponseWriter, r *http.Request) {
+		f.mutex.Lock()
+		defer f.mutex.Unlock()
+		io.WriteString(w, `<scan:ScannerStatus xmlns:scan="http://schemas.hp.com/imaging/escl/2011/05/03" xmlns:pwg="http://www.pwg.org/schemas/2010/12/sm">`+
+			`<pwg:State>Idle</pwg:State><scan:AdfState>`+f.adfState+`</scan:AdfState></scan:ScannerStatus>`)
+	})
+	mux.HandleFunc("POST /eSCL/ScanJobs", func(w http.ResponseWriter, r *http.Request) {
+		f.mutex.Lock()
+		defer f.mutex.Unlock()
+		var settings esclJob
+		if err := xml.NewDecoder(r.Body).Decode(&settings); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		f.jobs = append(f.jobs, settings)
+		w.Header().Set("Location", "/eSCL/ScanJobs/1")
+		w.WriteHeader(http.StatusCreated)
+	})
+	mux.HandleFunc("GET /eSCL/ScanJobs/1/NextDocument", func(w http.ResponseWriter, r *http.Request) {
+		f.mutex.Lock()
+		defer f.mutex.Unlock()
+		if f.busy > 0 {
+			f.busy--
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		if f.jamAfter == 0 && f.adfState == "ScannerAdfLoaded" {
+			f.adfState = "ScannerAdfJam"
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		if f.pages == 0 {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		f.pages--
+		f.jamAfter--
+		if f.jpeg != nil {
+			// devices do not always name the format
+			w.Header().Set("Content-Type", "application/octet-stream")
+			w.Write(f.jpeg)
+			return
+		}
+		img := image.NewGray(image.Rect(0, 0, 2, 2))
+		img.Set(1, 1, color.White)
+		png.Encode(w, img)
+	})
+	mux.HandleFunc("DELETE /eSCL/ScanJobs/1", func(w http.ResponseWriter, r *http.Request) {
+		f.mutex.Lock()
+		defer f.mutex.Unlock()
+		f.canceled = true
+	})
+	return mux
+}
+
+func startFakeEscl(t *testing.T, device *fakeEscl) string {
+	server := httptest.NewServer(device.handler())
+	t.Cleanup(server.Close)
+
+	oldWait := esclBusyWait
+	esclBusyWait = time.Millisecond
+	t.Cleanup(func() { esclBusyWait = oldWait })
+
+	return server.URL + "/eSCL"
+}
+
+func TestEsclScan(t *testing.T) {
+	dir := t.TempDir()
+	device := &fakeEscl{adfState: "ScannerAdfLoaded", pages: 2, jamAfter: -1, busy: 1}
+	baseUrl := startFakeEscl(t, device)
+
+	devices := ListEsclDevices(EsclOptions{Urls: []string{baseUrl, "http://127.0.0.1:1/eSCL"}})
+	assert.Equal(t, []Device{{Name: "escl:" + baseUrl, Vendor: "HP", Model: "HP OfficeJet Pro 9010", Type: "escl", Serial: "CN12345"}}, devices)
+
+	scanner := NewEsclScanner(Options{
+		Settings: Settings{Resolution: 300, Source: SourceADF, PaperSize: "a4"},
+		Escl:     EsclOptions{Urls: []string{baseUrl}},
+	}, DeviceSelector{Driver: DriverEscl, Model: "OfficeJet"})
+
+	imagePaths, err := scanner.Scan(dir)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{filepath.Join(dir, "scan-001.png"), filepath.Join(dir, "scan-002.png")}, imagePaths)
+	assert.Equal(t, "escl:"+baseUrl, scanner.Device())
+
+	data, err := os.ReadFile(filepath.Join(dir, "scan-002.png"))
+	assert.NoError(t, err)
+	img, err := png.Decode(bytes.NewReader(data))
+	assert.NoError(t, err)
+	assert.Equal(t, image.Rect(0, 0, 2, 2), img.Bounds())
+
+	assert.Len(t, device.jobs, 1)
+	job := device.jobs[0]
+	assert.Equal(t, "Feeder", job.InputSource)
+	assert.Equal(t, 300, job.XResolution)
+	assert.Equal(t, "image/png", job.DocumentFormat)
+	assert.Equal(t, 2480, job.Width)
+	assert.Equal(t, 3508, job.Height)
+	assert.Equal(t, "escl:ThreeHundredthsOfInches", job.Units)
+	assert.Nil(t, job.Duplex)
+
+	// an empty feeder starts no job
+	device.adfState = "ScannerAdfEmpty"
+	imagePaths, err = scanner.Scan(dir)
+	assert.ErrorIs(t, err, ErrNoDocs)
+	assert.Empty(t, imagePaths)
+	assert.Len(t, device.jobs, 1)
+}
+
+func TestEsclScanJam(t *testing.T) {
+	dir := t.TempDir()
+	device := &fakeEscl{adfState: "ScannerAdfLoaded", pages: 3, jamAfter: 1}
+	baseUrl := startFakeEscl(t, device)
+
+	scanner := NewEsclScanner(Options{
+		Settings: Settings{Resolution: 300, Source: SourceADF},
+		Escl:     EsclOptions{Urls: []string{baseUrl}},
+	}, DeviceSelector{Driver: DriverEscl})
+
+	_, err := scanner.Scan(dir)
+	assert.ErrorIs(t, err, ErrJammed)
+	assert.True(t, device.canceled)
+	_, err = os.Stat(filepath.Join(dir, "scan-001.png"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestEsclScanKeepsJpeg(t *testing.T) {
+	dir := t.TempDir()
+	page := &bytes.Buffer{}
+	assert.NoError(t, jpeg.Encode(page, image.NewGray(image.Rect(0, 0, 4, 4)), nil))
+	device := &fakeEscl{adfState: "ScannerAdfLoaded", pages: 1, jamAfter: -1, jpeg: page.Bytes()}
+	baseUrl := startFakeEscl(t, device)
+
+	scanner := NewEsclScanner(Options{
+		Settings: Settings{Resolution: 300, Source: SourceADF},
+		Escl:     EsclOptions{Urls: []string{baseUrl}},
+	}, DeviceSelector{Driver: DriverEscl})
+
+	imagePaths, err := scanner.Scan(dir)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{filepath.Join(dir, "scan-001.jpg")}, imagePaths)
+	data, err := os.ReadFile(imagePaths[0])
+	assert.NoError(t, err)
+	assert.Equal(t, page.Bytes(), data)
+}
+
+func TestEsclSettings(t *testing.T) {
+	intPtr := func(i int) *int { return &i }
+	var caps esclCapabilities
+	assert.NoError(t, xml.Unmarshal([]byte(esclTestCapabilities), &caps))
+
+	settings, err := Settings{Resolution: 600, Source: SourceFlatbed, Mode: ModeGray, Brightness: intPtr(60)}.esclSettings(&caps)
+	assert.NoError(t, err)
+	assert.Equal(t, "Platen", settings.InputSource)
+	assert.Equal(t, "Grayscale8", settings.ColorMode)
+	assert.Equal(t, "image/jpeg", settings.DocumentFormat)
+	assert.Equal(t, 60, *settings.Brightness)
+
+	_, err = Settings{Source: SourceDuplex}.esclSettings(&caps)
+	assert.ErrorContains(t, err, "duplex")
+	_, err = Settings{Resolution: 600, Source: SourceADF}.esclSettings(&caps)
+	assert.ErrorContains(t, err, "600dpi")
+	_, err = Settings{Resolution: 300, Source: SourceADF, Mode: ModeLineart}.esclSettings(&caps)
+	assert.ErrorContains(t, err, "lineart")
+	_, err = Settings{Resolution: 300, Source: SourceFlatbed, PaperSize: "legal"}.esclSettings(&caps)
+	assert.ErrorContains(t, err, "legal")
+	_, err = Settings{Resolution: 300, Source: SourceFlatbed, Contrast: intPtr(1)}.esclSettings(&caps)
+	assert.ErrorContains(t, err, "contrast")
+}
+
+func TestParseEsclResponses(t *testing.T) {
+	name := func(s string) dnsmessage.Name { return dnsmessage.MustNewName(s) }
+	header := func(n string, typ dnsmessage.Type) dnsmessage.ResourceHeader {
+		return dnsmessage.ResourceHeader{Name: name(n), Type: typ, Class: dnsmessage.ClassINET}
+	}
+
+	msg := dnsmessage.Message{
+		Header: dnsmessage.Header{Response: true},
+		Answers: []dnsmessage.Resource{
+			{Header: header("_uscan._tcp.local.", dnsmessage.TypePTR), Body: &dnsmessage.PTRResource{PTR: name("Office._uscan._tcp.local.")}},
+		},
+		Additionals: []dnsmessage.Resource{
+			{Header: header("Office._uscan._tcp.local.", dnsmessage.TypeSRV), Body: &dnsmessage.SRVResource{Target: name("mfp.local."), Port: 8080}},
+			{Header: header("Office._uscan._tcp.local.", dnsmessage.TypeTXT), Body: &dnsmessage.TXTResource{TXT: []string{"ty=Office MFP", "rs=eSCL2"}}},
+			{Header: header("mfp.local.", dnsmessage.TypeA), Body: &dnsmessage.AResource{A: [4]byte{192, 168, 1, 20}}},
+		},
+	}
+	response, err := msg.Pack()
+	assert.NoError(t, err)
+
+	// a printer that does not scan
+	other := dnsmessage.Message{
+		Header: dnsmessage.Header{Response: true},
+		Answers: []dnsmessage.Resource{
+			{Header: header("Printer._ipp._tcp.local.", dnsmessage.TypeSRV), Body: &dnsmessage.SRVResource{Target: name("printer.local."), Port: 631}},
+		},
+	}
+	otherResponse, err := other.Pack()
+	assert.NoError(t, err)
+
+	assert.Equal(t, []string{"http://192.168.1.20:8080/eSCL2"}, parseEsclResponses([][]byte{otherResponse, response, []byte("garbage")}))
+
+	query, err := esclQuery()
+	assert.NoError(t, err)
+	var parsed dnsmessage.Message
+	assert.NoError(t, parsed.Unpack(query))
+	assert.Len(t, parsed.Questions, 2)
+}
+
+func TestEsclAdfError(t *testing.T) {
+	assert.NoError(t, esclStatus{AdfState: "ScannerAdfLoaded"}.adfError())
+	assert.ErrorIs(t, esclStatus{AdfState: "ScannerAdfEmpty"}.adfError(), ErrNoDocs)
+	assert.ErrorIs(t, esclStatus{AdfState: "ScannerAdfMispick"}.adfError(), ErrJammed)
+	assert.ErrorIs(t, esclStatus{AdfState: "ScannerAdfMultipickDetected"}.adfError(), ErrDoubleFeed)
+	assert.ErrorIs(t, esclStatus{AdfState: "ScannerAdfHatchOpen"}.adfError(), ErrCoverOpen)
+}
@@ -0,0 +1,249 @@
+package scan
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"image"
+	"image/png"
+	"io"
+	"os"
+)
+
+type frameFormat int
+
+const (
+	frameGray frameFormat = iota
+	frameRGB
+)
+
+// frameParams describe the raw image data of one page as SANE delivers it.
+type frameParams struct {
+	Format        frameFormat
+	BytesPerLine  int
+	PixelsPerLine int
+	// Lines is -1 if the height was not known before scanning, e.g. for
+	// sheet fed scanners with paper end detection.
+	Lines int
+	Depth int
+}
+
+// pngChunkSize bounds the compressed data frameWriter buffers before it
+// writes an IDAT chunk.
+var pngChunkSize = 64 * 1024
+
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+// frameWriter encodes raw SANE image data into a PNG file line by line, so
+// a page is never held in memory as a whole. 16 bit samples are in host byte
+// order, 1 bit samples are 1 for black.
+type frameWriter struct {
+	file     *os.File
+	params   frameParams
+	channels int
+	// line collects the bytes of the current line, data arrives in chunks
+	// of any size.
+	line   []byte
+	filled int
+	row    []byte
+	idat   *pngChunkWriter
+	zlib   *zlib.Writer
+	lines  int
+}
+
+func newFrameWriter(filePath string, params frameParams) (*frameWriter, error) {
+	if params.BytesPerLine <= 0 || params.PixelsPerLine <= 0 {
+		return nil, fmt.Errorf("invalid frame with %d bytes per line", params.BytesPerLine)
+	}
+
+	channels := 1
+	if params.Format == frameRGB {
+		channels = 3
+	}
+	if params.Depth != 1 && params.Depth != 8 && params.Depth != 16 {
+		return nil, fmt.Errorf("unsupported sample depth %d", params.Depth)
+	}
+	if params.PixelsPerLine*channels*params.Depth > params.BytesPerLine*8 {
+		return nil, fmt.Errorf("frame has %d pixels but only %d bytes per line", params.PixelsPerLine, params.BytesPerLine)
+	}
+
+	file, err := os.Create(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	w := &frameWriter{
+		file:     file,
+		params:   params,
+		channels: channels,
+		line:     make([]byte, params.BytesPerLine),
+		row:      make([]byte, 1+(params.PixelsPerLine*channels*params.Depth+7)/8),
+		idat:     &pngChunkWriter{w: file},
+	}
+	w.zlib = zlib.NewWriter(w.idat)
+
+	// the height is written again when it is known
+	_, err = file.Write(pngSignature)
+	if err == nil {
+		err = writePngChunk(file, "IHDR", w.header(max(params.Lines, 1)))
+	}
+	if err != nil {
+		w.Abort()
+		return nil, err
+	}
+	return w, nil
+}
+
+func (w *frameWriter) header(lines int) []byte {
+	colorType := byte(0)
+	if w.channels == 3 {
+		colorType = 2
+	}
+
+	header := make([]byte, 13)
+	binary.BigEndian.PutUint32(header[0:], uint32(w.params.PixelsPerLine))
+	binary.BigEndian.PutUint32(header[4:], uint32(lines))
+	header[8] = byte(w.params.Depth)
+	header[9] = colorType
+	return header
+}
+
+func (w *frameWriter) Write(p []byte) (int, error) {
+	n := len(p)
+	for len(p) > 0 {
+		if w.params.Lines >= 0 && w.lines >= w.params.Lines {
+			// the frame is complete, padding is dropped
+			break
+		}
+
+		copied := copy(w.line[w.filled:], p)
+		w.filled += copied
+		p = p[copied:]
+		if w.filled < len(w.line) {
+			break
+		}
+
+		w.filled = 0
+		err := w.writeLine()
+		if err != nil {
+			return 0, err
+		}
+	}
+	return n, nil
+}
+
+// writeLine converts a SANE line into a PNG row without filtering.
+func (w *frameWriter) writeLine() error {
+	w.row[0] = 0
+	samples := w.params.PixelsPerLine * w.channels
+	switch w.params.Depth {
+	case 1:
+		for i := range w.row[1:] {
+			w.row[1+i] = ^w.line[i]
+		}
+	case 8:
+		copy(w.row[1:], w.line[:samples])
+	default:
+		for i := 0; i < samples; i++ {
+			binary.BigEndian.PutUint16(w.row[1+i*2:], binary.NativeEndian.Uint16(w.line[i*2:]))
+		}
+	}
+
+	_, err := w.zlib.Write(w.row)
+	w.lines++
+	return err
+}
+
+// Close finishes the PNG file. An incomplete last line is dropped.
+func (w *frameWriter) Close() error {
+	if w.lines == 0 {
+		w.Abort()
+		return errors.New("frame has no lines")
+	}
+
+	err := w.zlib.Close()
+	if err == nil {
+		err = w.idat.flush()
+	}
+	if err == nil {
+		err = writePngChunk(w.file, "IEND", nil)
+	}
+	if err == nil {
+		header := &bytes.Buffer{}
+		writePngChunk(header, "IHDR", w.header(w.lines))
+		_, err = w.file.WriteAt(header.Bytes(), int64(len(pngSignature)))
+	}
+	if closeErr := w.file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(w.file.Name())
+	}
+	return err
+}
+
+// Abort removes the unfinished file.
+func (w *frameWriter) Abort() {
+	w.file.Close()
+	os.Remove(w.file.Name())
+}
+
+// pngChunkWriter splits the compressed image data into IDAT chunks.
+type pngChunkWriter struct {
+	w   io.Writer
+	buf []byte
+}
+
+func (c *pngChunkWriter) Write(p []byte) (int, error) {
+	c.buf = append(c.buf, p...)
+	if len(c.buf) >= pngChunkSize {
+		return len(p), c.flush()
+	}
+	return len(p), nil
+}
+
+func (c *pngChunkWriter) flush() error {
+	if len(c.buf) == 0 {
+		return nil
+	}
+	err := writePngChunk(c.w, "IDAT", c.buf)
+	c.buf = c.buf[:0]
+	return err
+}
+
+func writePngChunk(w io.Writer, chunkType string, data []byte) error {
+	header := make([]byte, 8)
+	binary.BigEndian.PutUint32(header, uint32(len(data)))
+	copy(header[4:], chunkType)
+
+	crc := crc32.NewIEEE()
+	crc.Write(header[4:])
+	crc.Write(data)
+	footer := binary.BigEndian.AppendUint32(nil, crc.Sum32())
+
+	for _, part := range [][]byte{header, data, footer} {
+		if _, err := w.Write(part); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writePng(filePath string, img image.Image) error {
+	f, err := os.Create(filePath)
+	if err != nil {
+		return err
+	}
+
+	err = png.Encode(f, img)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(filePath)
+	}
+	return err
+}
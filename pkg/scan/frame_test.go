@@ -0,0 +1,104 @@
+package scan
+
+import (
+	"encoding/binary"
+	"image"
+	"image/color"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// encodeFrame feeds data in chunks of 3 bytes, lines arrive split like from
+// sane_read.
+func encodeFrame(t *testing.T, params frameParams, data []byte) (image.Image, error) {
+	filePath := filepath.Join(t.TempDir(), "scan-001.png")
+	w, err := newFrameWriter(filePath, params)
+	if err != nil {
+		return nil, err
+	}
+
+	for len(data) > 0 {
+		chunk := data[:min(3, len(data))]
+		data = data[len(chunk):]
+		_, err = w.Write(chunk)
+		assert.NoError(t, err)
+	}
+	err = w.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	return readImage(filePath)
+}
+
+func TestFrameWriter(t *testing.T) {
+	// two lines of 3 gray pixels, padded to 4 bytes per line
+	img, err := encodeFrame(t, frameParams{Format: frameGray, BytesPerLine: 4, PixelsPerLine: 3, Lines: -1, Depth: 8},
+		[]byte{0, 128, 255, 0, 10, 20, 30, 0})
+	assert.NoError(t, err)
+	assert.IsType(t, &image.Gray{}, img)
+	assert.Equal(t, image.Rect(0, 0, 3, 2), img.Bounds())
+	assert.Equal(t, color.Gray{Y: 128}, img.At(1, 0))
+	assert.Equal(t, color.Gray{Y: 30}, img.At(2, 1))
+
+	// lineart, 1 is black
+	img, err = encodeFrame(t, frameParams{Format: frameGray, BytesPerLine: 1, PixelsPerLine: 8, Lines: 1, Depth: 1}, []byte{0b10100000})
+	assert.NoError(t, err)
+	assert.Equal(t, color.Gray{Y: 0}, img.At(0, 0))
+	assert.Equal(t, color.Gray{Y: 255}, img.At(1, 0))
+	assert.Equal(t, color.Gray{Y: 0}, img.At(2, 0))
+
+	img, err = encodeFrame(t, frameParams{Format: frameRGB, BytesPerLine: 6, PixelsPerLine: 2, Lines: 1, Depth: 8}, []byte{255, 0, 0, 0, 0, 255})
+	assert.NoError(t, err)
+	assert.Equal(t, color.RGBA{R: 255, A: 255}, img.At(0, 0))
+	assert.Equal(t, color.RGBA{B: 255, A: 255}, img.At(1, 0))
+
+	data := make([]byte, 2)
+	binary.NativeEndian.PutUint16(data, 0x1234)
+	img, err = encodeFrame(t, frameParams{Format: frameGray, BytesPerLine: 2, PixelsPerLine: 1, Lines: 1, Depth: 16}, data)
+	assert.NoError(t, err)
+	assert.Equal(t, color.Gray16{Y: 0x1234}, img.At(0, 0))
+
+	// incomplete last line is dropped
+	img, err = encodeFrame(t, frameParams{Format: frameGray, BytesPerLine: 2, PixelsPerLine: 2, Lines: -1, Depth: 8}, []byte{1, 2, 3})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, img.Bounds().Dy())
+
+	// lines beyond the announced height are dropped
+	img, err = encodeFrame(t, frameParams{Format: frameGray, BytesPerLine: 1, PixelsPerLine: 1, Lines: 2, Depth: 8}, []byte{1, 2, 3})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, img.Bounds().Dy())
+
+	_, err = encodeFrame(t, frameParams{Format: frameRGB, BytesPerLine: 2, PixelsPerLine: 2, Lines: 1, Depth: 8}, []byte{1, 2})
+	assert.Error(t, err)
+	_, err = encodeFrame(t, frameParams{Format: frameGray, BytesPerLine: 2, PixelsPerLine: 2, Lines: 1, Depth: 4}, []byte{1, 2})
+	assert.Error(t, err)
+}
+
+func TestFrameWriterSplitsChunks(t *testing.T) {
+	oldChunkSize := pngChunkSize
+	pngChunkSize = 16
+	t.Cleanup(func() { pngChunkSize = oldChunkSize })
+
+	// noise does not compress, so the data spans many chunks
+	data := make([]byte, 64*64)
+	for i := range data {
+		data[i] = byte(i * 7919 % 251)
+	}
+	img, err := encodeFrame(t, frameParams{Format: frameGray, BytesPerLine: 64, PixelsPerLine: 64, Lines: -1, Depth: 8}, data)
+	assert.NoError(t, err)
+	assert.Equal(t, image.Rect(0, 0, 64, 64), img.Bounds())
+	assert.Equal(t, color.Gray{Y: data[64*10+5]}, img.At(5, 10))
+}
+
+func TestFrameWriterRemovesEmptyFrame(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "scan-001.png")
+	w, err := newFrameWriter(filePath, frameParams{Format: frameGray, BytesPerLine: 1, PixelsPerLine: 1, Lines: -1, Depth: 8})
+	assert.NoError(t, err)
+	assert.Error(t, w.Close())
+	_, err = os.Stat(filePath)
+	assert.True(t, os.IsNotExist(err))
+}
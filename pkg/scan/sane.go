@@ -3,42 +3,145 @@ package scan
 import (
 	"bytes"
 	"errors"
+	"fmt"
 	"os/exec"
+	"path/filepath"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/sirupsen/logrus"
 )
 
-var productName = "DS-C490"
+// sensorRetryWait is how long button polling pauses after the device was not
+// found, e.g. because it is turned off.
+var sensorRetryWait = 30 * time.Second
+
+// defaultDevice is used if no devices are configured.
+var defaultDevice = DeviceSelector{Model: "DS-C490"}
 
 type Options struct {
+	// SaneOptions are passed to scanimage as they are, e.g.
+	// "--swdeskew=yes", for device options that Settings do not cover.
 	SaneOptions []string `yaml:"saneOptions"`
+	Settings    Settings `yaml:"settings"`
+	// Devices are the scanners to use, each one is scanned independently.
+	Devices []DeviceSelector `yaml:"devices"`
+	// Triggers decide when a scan runs.
+	Triggers TriggerOptions `yaml:"triggers"`
+	// Escl lists the network scanners for devices with the escl driver.
+	Escl EsclOptions `yaml:"escl"`
+	// Simulated configures the devices with the simulated driver.
+	Simulated SimulatedOptions `yaml:"simulated"`
+}
+
+func (o Options) Validate() error {
+	err := errors.Join(o.Settings.Validate(), o.Triggers.Validate(), o.Simulated.Validate())
+	if err != nil {
+		return err
+	}
+
+	for _, selector := range o.Devices {
+		if err := selector.Validate(); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 type SaneScanner struct {
+	// mutex keeps sensor reads and scans from using the device at once.
+	mutex        sync.Mutex
 	options      Options
+	selector     DeviceSelector
 	activeDevice string
+	deviceArgs   []string
+	// sensorRetryAt pauses sensor reads after the device was not found.
+	sensorRetryAt time.Time
 }
 
+// NewScanner returns a scanner for the first configured device.
 func NewScanner(opts Options) *SaneScanner {
-	s := &SaneScanner{
-		options: opts,
+	selector := defaultDevice
+	if len(opts.Devices) > 0 {
+		selector = opts.Devices[0]
 	}
 
-	return s
+	return NewDeviceScanner(opts, selector)
 }
 
-func (s *SaneScanner) Scan() ([]string, error) {
-	if s.activeDevice == "" {
-		device, err := detectDeviceByProductName(productName)
+// NewScanners returns one scanner per configured device. They use libsane
+// if built with the sane tag, scanimage otherwise.
+func NewScanners(opts Options) []Scanner {
+	if len(opts.Devices) == 0 {
+		return []Scanner{newDeviceScanner(opts, defaultDevice)}
+	}
+
+	scanners := make([]Scanner, len(opts.Devices))
+	for i, selector := range opts.Devices {
+		switch selector.Driver {
+		case DriverEscl:
+			scanners[i] = NewEsclScanner(opts, selector)
+		case DriverSimulated:
+			scanners[i] = NewSimulatedScanner(opts, selector)
+		default:
+			scanners[i] = newDeviceScanner(opts, selector)
+		}
+	}
+	return scanners
+}
+
+func NewDeviceScanner(opts Options, selector DeviceSelector) *SaneScanner {
+	return &SaneScanner{
+		options:  opts,
+		selector: selector,
+	}
+}
+
+// Device returns the SANE name of the detected device, or the selector if
+// the device was not detected yet.
+func (s *SaneScanner) Device() string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.activeDevice != "" {
+		return s.activeDevice
+	}
+	return s.selector.String()
+}
+
+func (s *SaneScanner) Scan(dir string) ([]string, error) {
+	return s.ScanWith(dir, s.options.Settings)
+}
+
+// ScanWith scans with settings instead of the configured settings.
+func (s *SaneScanner) ScanWith(dir string, settings Settings) ([]string, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	err := s.detect()
+	if err != nil {
+		return nil, err
+	}
+
+	deviceArgs := s.deviceArgs
+	if settings != s.options.Settings {
+		deviceArgs, err = s.argsForDevice(s.activeDevice, settings)
 		if err != nil {
 			return nil, err
 		}
-
-		s.activeDevice = device
 	}
 
-	scannedImages, err := s.execScanimage()
+	scannedImages, err := s.execScanimage(dir, deviceArgs, settings)
+	err = deviceIOError(err, func() error {
+		s.activeDevice = ""
+		return s.detect()
+	})
+	if condition := Classify(err); condition == ConditionDeviceAbsent || condition == ConditionFailed {
+		// the device name changes when the scanner is re-plugged
+		logrus.WithField("device", s.activeDevice).Debug("Device failed, detecting it again on the next scan")
+		s.activeDevice = ""
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -46,81 +149,126 @@ func (s *SaneScanner) Scan() ([]string, error) {
 	return scannedImages, nil
 }
 
-func (s *SaneScanner) execScanimage() ([]string, error) {
-	command := "scanimage"
-	args := []string{"--format", "png", "--resolution", "600dpi", "--duplex=yes", "--batch=scan-%03d.png", "--batch-print", "--device-name", s.activeDevice}
+// ReadSensors reads the named buttons of the device. scanimage cannot read
+// single options, so every read lists all of them. A device that is missing
+// is looked for again after sensorRetryWait, not on every poll.
+func (s *SaneScanner) ReadSensors(names []string) (map[string]bool, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
 
-	cmd := exec.Command(command, args...)
-	imageFilesBuffer := &bytes.Buffer{}
-	cmd.Stdout = imageFilesBuffer
-	stdErrBuffer := &bytes.Buffer{}
-	cmd.Stderr = stdErrBuffer
-	err := cmd.Run()
-	stderr := stdErrBuffer.String()
+	if time.Now().Before(s.sensorRetryAt) {
+		return nil, fmt.Errorf("%w: waiting before reading buttons again", ErrDeviceAbsent)
+	}
+
+	err := s.detect()
+	if err != nil {
+		s.sensorRetryAt = time.Now().Add(sensorRetryWait)
+		return nil, err
+	}
+
+	output, err := execCommandQuiet("scanimage", "--all-options", "--device-name", s.activeDevice)
 	if err != nil {
-		if strings.Contains(stderr, "Error during device I/O") {
-			// device is turned off
-			return nil, nil
+		s.activeDevice = ""
+		s.sensorRetryAt = time.Now().Add(sensorRetryWait)
+		return nil, err
+	}
+
+	all := parseCapabilities(output).Sensors()
+	sensors := make(map[string]bool, len(names))
+	for _, name := range names {
+		if pressed, ok := all[name]; ok {
+			sensors[name] = pressed
 		}
-		return nil, errors.Join(err, errors.New(stderr))
 	}
+	return sensors, nil
+}
 
-	var result []string
-	for _, imagePath := range strings.Split(imageFilesBuffer.String(), "\n") {
-		if imagePath == "" {
-			continue
+func (s *SaneScanner) detect() error {
+	if s.activeDevice == "" {
+		logrus.WithField("selector", s.selector.String()).Debug("Detecting device")
+		device, err := findDevice(s.selector)
+		if err != nil {
+			return err
 		}
 
-		result = append(result, strings.TrimSpace(imagePath))
-	}
+		logrus.WithField("device", device.Name).WithField("serial", device.Serial).Info("Detected device")
+		deviceArgs, err := s.argsForDevice(device.Name, s.options.Settings)
+		if err != nil {
+			return err
+		}
 
-	return result, nil
+		s.activeDevice = device.Name
+		s.deviceArgs = deviceArgs
+		s.sensorRetryAt = time.Time{}
+	}
+	return nil
 }
 
-// scanimage --format png --resolution 1200 --duplex=yes --batch --batch-print --device-name epsonscan2:DS-C490:584251413030303218:esci2:usb:ES0264:401
+// argsForDevice translates the settings and checks them against the
+// capabilities of the device.
+func (s *SaneScanner) argsForDevice(device string, settings Settings) ([]string, error) {
+	caps, err := DeviceCapabilities(device)
+	if err != nil {
+		return nil, err
+	}
 
-func detectDeviceByProductName(productName string) (string, error) {
-	logrus.WithField("productName", productName).Info("Detecting device by product name")
-	devices, err := detectDevices()
+	args, err := settings.Args(caps)
 	if err != nil {
-		return "", err
+		return nil, fmt.Errorf("settings for %s: %w", device, err)
 	}
 
-	for _, device := range devices {
-		if strings.Contains(device, productName) {
-			return device, nil
+	for _, arg := range s.options.SaneOptions {
+		err = caps.checkArg(arg)
+		if err != nil {
+			return nil, fmt.Errorf("sane options for %s: %w", device, err)
 		}
 	}
 
-	return "", errors.New("device not found")
+	return append(args, s.options.SaneOptions...), nil
 }
 
-func detectDevices() ([]string, error) {
-	logrus.Info("Detecting devices")
-	// scanimage -L -d epson2
-	deviceListOutput, err := execCommand("scanimage", "-L")
+func (s *SaneScanner) execScanimage(dir string, deviceArgs []string, settings Settings) ([]string, error) {
+	command := "scanimage"
+	args := []string{"--format", "png", "--batch=scan-%03d.png", "--batch-print", "--device-name", s.activeDevice}
+	args = append(args, deviceArgs...)
+	if settings.singlePage() {
+		args = append(args, "--batch-count=1")
+	}
+
+	cmd := exec.Command(command, args...)
+	// the batch pattern is relative, a % in dir would be taken for a format
+	cmd.Dir = dir
+	imageFilesBuffer := &bytes.Buffer{}
+	cmd.Stdout = imageFilesBuffer
+	stdErrBuffer := &bytes.Buffer{}
+	cmd.Stderr = stdErrBuffer
+	err := cmd.Run()
+	stderr := stdErrBuffer.String()
 	if err != nil {
-		logrus.WithError(err).Error("Failed to detect devices")
+		return nil, scanimageError(err, stderr)
 	}
 
-	var devices []string
-	for _, line := range strings.Split(deviceListOutput, "\n") {
-		if strings.HasPrefix(line, "device") {
-			deviceName := strings.Split(line, " ")[1]
-			deviceName = removeAllTicks(deviceName)
-			devices = append(devices, deviceName)
+	var result []string
+	for _, imagePath := range strings.Split(imageFilesBuffer.String(), "\n") {
+		if imagePath == "" {
+			continue
 		}
-	}
 
-	return devices, nil
-}
+		result = append(result, filepath.Join(dir, strings.TrimSpace(imagePath)))
+	}
 
-func removeAllTicks(s string) string {
-	return strings.ReplaceAll(strings.ReplaceAll(s, "'", ""), "`", "")
+	return result, nil
 }
 
 func execCommand(command string, args ...string) (string, error) {
 	logrus.WithField("command", command).WithField("args", args).Info("Executing command")
+	return execCommandQuiet(command, args...)
+}
+
+// execCommandQuiet is for commands that run periodically, e.g. to poll
+// buttons.
+func execCommandQuiet(command string, args ...string) (string, error) {
+	logrus.WithField("command", command).WithField("args", args).Debug("Executing command")
 	cmd := exec.Command(command, args...)
 	outputBuffer := &bytes.Buffer{}
 	cmd.Stdout = outputBuffer
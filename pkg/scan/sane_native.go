@@ -0,0 +1,629 @@
+//go:build sane
+
+package scan
+
+/*
+#cgo LDFLAGS: -lsane
+#include <stdlib.h>
+#include <string.h>
+#include <sane/sane.h>
+*/
+import "C"
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unsafe"
+
+	"github.com/sirupsen/logrus"
+)
+
+var saneInitOnce sync.Once
+var saneInitErr error
+
+// saneReadBufferSize is the chunk size of sane_read.
+var saneReadBufferSize = 64 * 1024
+
+// geometryOptions map the SANE names of the scan area options to the short
+// names scanimage uses for them.
+var geometryOptions = map[string]string{
+	"tl-x": "-l",
+	"tl-y": "-t",
+	"br-x": "-x",
+	"br-y": "-y",
+}
+
+func saneInit() error {
+	saneInitOnce.Do(func() {
+		var version C.SANE_Int
+		saneInitErr = statusError(C.sane_init(&version, nil))
+	})
+	return saneInitErr
+}
+
+func statusError(status C.SANE_Status) error {
+	switch status {
+	case C.SANE_STATUS_GOOD:
+		return nil
+	case C.SANE_STATUS_NO_DOCS:
+		return ErrNoDocs
+	case C.SANE_STATUS_JAMMED:
+		return ErrJammed
+	case C.SANE_STATUS_COVER_OPEN:
+		return ErrCoverOpen
+	case C.SANE_STATUS_DEVICE_BUSY:
+		return ErrDeviceBusy
+	case C.SANE_STATUS_IO_ERROR:
+		return errDeviceIO
+	case C.SANE_STATUS_ACCESS_DENIED:
+		return ErrPermissionDenied
+	default:
+		return fmt.Errorf("sane: %s", C.GoString(C.sane_strstatus(status)))
+	}
+}
+
+// nativeListDevices returns all devices libsane can see.
+func nativeListDevices() ([]Device, error) {
+	err := saneInit()
+	if err != nil {
+		return nil, err
+	}
+
+	var list **C.SANE_Device
+	err = statusError(C.sane_get_devices(&list, C.SANE_FALSE))
+	if err != nil {
+		return nil, err
+	}
+
+	var devices []Device
+	for _, d := range unsafe.Slice(list, countNullTerminated(unsafe.Pointer(list))) {
+		device := Device{
+			Name:   C.GoString(d.name),
+			Vendor: C.GoString(d.vendor),
+			Model:  C.GoString(d.model),
+			Type:   C.GoString(d._type),
+		}
+		device.Serial = usbSerial(device.Name)
+		devices = append(devices, device)
+	}
+	return devices, nil
+}
+
+func countNullTerminated(list unsafe.Pointer) int {
+	if list == nil {
+		return 0
+	}
+
+	count := 0
+	for _, p := range unsafe.Slice((*unsafe.Pointer)(list), 1<<20) {
+		if p == nil {
+			break
+		}
+		count++
+	}
+	return count
+}
+
+type nativeDevice struct {
+	name   string
+	handle C.SANE_Handle
+	// options maps option names to their index.
+	options map[string]C.SANE_Int
+}
+
+func openNativeDevice(name string) (*nativeDevice, error) {
+	err := saneInit()
+	if err != nil {
+		return nil, err
+	}
+
+	cName := C.CString(name)
+	defer C.free(unsafe.Pointer(cName))
+
+	d := &nativeDevice{name: name, options: make(map[string]C.SANE_Int)}
+	err = statusError(C.sane_open(cName, &d.handle))
+	if err != nil {
+		return nil, fmt.Errorf("open %s: %w", name, err)
+	}
+
+	d.loadOptions()
+	return d, nil
+}
+
+func (d *nativeDevice) Close() {
+	C.sane_close(d.handle)
+}
+
+func (d *nativeDevice) loadOptions() {
+	d.options = make(map[string]C.SANE_Int)
+	for i := C.SANE_Int(1); ; i++ {
+		desc := C.sane_get_option_descriptor(d.handle, i)
+		if desc == nil {
+			return
+		}
+		if desc.name != nil && desc._type != C.SANE_TYPE_GROUP {
+			d.options[C.GoString(desc.name)] = i
+		}
+	}
+}
+
+// Capabilities describes the options of the device the same way scanimage
+// lists them, so settings are validated alike for both backends.
+func (d *nativeDevice) Capabilities() Capabilities {
+	caps := make(Capabilities)
+	for name, index := range d.options {
+		desc := C.sane_get_option_descriptor(d.handle, index)
+		if desc == nil || desc.cap&C.SANE_CAP_SOFT_SELECT == 0 {
+			continue
+		}
+
+		option := DeviceOption{
+			Name:     scanimageName(name),
+			IsBool:   desc._type == C.SANE_TYPE_BOOL,
+			Inactive: desc.cap&C.SANE_CAP_INACTIVE != 0,
+			Unit:     unitName(desc.unit),
+		}
+
+		fixed := desc._type == C.SANE_TYPE_FIXED
+		constraint := unsafe.Pointer(&desc.constraint)
+		switch desc.constraint_type {
+		case C.SANE_CONSTRAINT_RANGE:
+			r := *(**C.SANE_Range)(constraint)
+			option.IsRange = true
+			option.Min = wordValue(r.min, fixed)
+			option.Max = wordValue(r.max, fixed)
+		case C.SANE_CONSTRAINT_WORD_LIST:
+			words := *(**C.SANE_Word)(constraint)
+			list := unsafe.Slice(words, int(*words)+1)[1:]
+			for _, word := range list {
+				option.Values = append(option.Values, strconv.FormatFloat(wordValue(word, fixed), 'f', -1, 64))
+			}
+		case C.SANE_CONSTRAINT_STRING_LIST:
+			strs := *(***C.SANE_Char)(constraint)
+			for _, s := range unsafe.Slice(strs, countNullTerminated(unsafe.Pointer(strs))) {
+				option.Values = append(option.Values, C.GoString(s))
+			}
+		}
+
+		caps[option.Name] = option
+	}
+	return caps
+}
+
+func scanimageName(name string) string {
+	if short, ok := geometryOptions[name]; ok {
+		return short
+	}
+	return "--" + name
+}
+
+func saneName(name string) string {
+	for long, short := range geometryOptions {
+		if short == name {
+			return long
+		}
+	}
+	return strings.TrimLeft(name, "-")
+}
+
+func unitName(unit C.SANE_Unit) string {
+	switch unit {
+	case C.SANE_UNIT_DPI:
+		return "dpi"
+	case C.SANE_UNIT_MM:
+		return "mm"
+	case C.SANE_UNIT_PERCENT:
+		return "%"
+	case C.SANE_UNIT_MICROSECOND:
+		return "us"
+	default:
+		return ""
+	}
+}
+
+func wordValue(word C.SANE_Word, fixed bool) float64 {
+	if fixed {
+		return float64(word) / float64(1<<C.SANE_FIXED_SCALE_SHIFT)
+	}
+	return float64(word)
+}
+
+// GetOption reads the current value of an option, e.g. a button sensor.
+func (d *nativeDevice) GetOption(name string) (string, error) {
+	index, desc, err := d.descriptor(name)
+	if err != nil {
+		return "", err
+	}
+
+	buf := C.malloc(C.size_t(desc.size))
+	defer C.free(buf)
+	err = statusError(C.sane_control_option(d.handle, index, C.SANE_ACTION_GET_VALUE, buf, nil))
+	if err != nil {
+		return "", fmt.Errorf("get option %s: %w", name, err)
+	}
+
+	switch desc._type {
+	case C.SANE_TYPE_BOOL:
+		if *(*C.SANE_Word)(buf) == C.SANE_TRUE {
+			return "yes", nil
+		}
+		return "no", nil
+	case C.SANE_TYPE_INT, C.SANE_TYPE_FIXED:
+		return strconv.FormatFloat(wordValue(*(*C.SANE_Word)(buf), desc._type == C.SANE_TYPE_FIXED), 'f', -1, 64), nil
+	case C.SANE_TYPE_STRING:
+		return C.GoString((*C.char)(buf)), nil
+	default:
+		return "", fmt.Errorf("option %s has no value", name)
+	}
+}
+
+// Sensors reads the named options that report hardware state, like buttons.
+func (d *nativeDevice) Sensors(names []string) (map[string]bool, error) {
+	sensors := make(map[string]bool)
+	for _, name := range names {
+		index, ok := d.options[name]
+		if !ok {
+			continue
+		}
+		desc := C.sane_get_option_descriptor(d.handle, index)
+		if desc == nil || desc._type != C.SANE_TYPE_BOOL || desc.cap&C.SANE_CAP_SOFT_SELECT != 0 ||
+			desc.cap&C.SANE_CAP_SOFT_DETECT == 0 || desc.cap&C.SANE_CAP_INACTIVE != 0 {
+			continue
+		}
+
+		value, err := d.GetOption(name)
+		if err != nil {
+			return nil, err
+		}
+		sensors[name] = value == "yes"
+	}
+	return sensors, nil
+}
+
+// SetOption sets an option given in scanimage syntax, e.g. "--mode" and
+// "Color" or "-x" and "210".
+func (d *nativeDevice) SetOption(name, value string) error {
+	index, desc, err := d.descriptor(saneName(name))
+	if err != nil {
+		return err
+	}
+
+	var buf unsafe.Pointer
+	switch desc._type {
+	case C.SANE_TYPE_BOOL:
+		word := C.SANE_Word(C.SANE_FALSE)
+		if value == "yes" {
+			word = C.SANE_TRUE
+		}
+		buf = C.malloc(C.size_t(unsafe.Sizeof(word)))
+		*(*C.SANE_Word)(buf) = word
+	case C.SANE_TYPE_INT, C.SANE_TYPE_FIXED:
+		number, err := strconv.ParseFloat(strings.TrimRight(value, "abcdefghijklmnopqrstuvwxyz%"), 64)
+		if err != nil {
+			return fmt.Errorf("option %s expects a number, got %q", name, value)
+		}
+		word := C.SANE_Word(number)
+		if desc._type == C.SANE_TYPE_FIXED {
+			word = C.SANE_Word(number * float64(1<<C.SANE_FIXED_SCALE_SHIFT))
+		}
+		buf = C.malloc(C.size_t(unsafe.Sizeof(word)))
+		*(*C.SANE_Word)(buf) = word
+	case C.SANE_TYPE_STRING:
+		buf = C.malloc(C.size_t(desc.size))
+		C.memset(buf, 0, C.size_t(desc.size))
+		cValue := C.CString(value)
+		C.strncpy((*C.char)(buf), cValue, C.size_t(desc.size-1))
+		C.free(unsafe.Pointer(cValue))
+	default:
+		return fmt.Errorf("option %s has no value", name)
+	}
+	defer C.free(buf)
+
+	var info C.SANE_Int
+	err = statusError(C.sane_control_option(d.handle, index, C.SANE_ACTION_SET_VALUE, buf, &info))
+	if err != nil {
+		return fmt.Errorf("set option %s: %w", name, err)
+	}
+	if info&C.SANE_INFO_RELOAD_OPTIONS != 0 {
+		d.loadOptions()
+	}
+	return nil
+}
+
+func (d *nativeDevice) descriptor(name string) (C.SANE_Int, *C.SANE_Option_Descriptor, error) {
+	index, ok := d.options[name]
+	if !ok {
+		return 0, nil, fmt.Errorf("device has no option %s", name)
+	}
+
+	desc := C.sane_get_option_descriptor(d.handle, index)
+	if desc == nil {
+		return 0, nil, fmt.Errorf("device has no option %s", name)
+	}
+	return index, desc, nil
+}
+
+// applyArgs sets options from scanimage style arguments as produced by
+// Settings.Args or configured in SaneOptions.
+func (d *nativeDevice) applyArgs(args []string) error {
+	for i := 0; i < len(args); i++ {
+		name, value, hasValue := strings.Cut(args[i], "=")
+		if !hasValue {
+			if i+1 < len(args) && !strings.HasPrefix(args[i+1], "-") {
+				i++
+				value = args[i]
+			} else {
+				value = "yes"
+			}
+		}
+
+		err := d.SetOption(name, value)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ReadPage starts a scan and streams one page into a PNG file. ErrNoDocs is
+// returned once the feeder is empty.
+func (d *nativeDevice) ReadPage(filePath string) error {
+	err := statusError(C.sane_start(d.handle))
+	if err != nil {
+		return err
+	}
+
+	var params C.SANE_Parameters
+	err = statusError(C.sane_get_parameters(d.handle, &params))
+	if err != nil {
+		return err
+	}
+
+	frame := frameParams{
+		BytesPerLine:  int(params.bytes_per_line),
+		PixelsPerLine: int(params.pixels_per_line),
+		Lines:         int(params.lines),
+		Depth:         int(params.depth),
+	}
+	switch params.format {
+	case C.SANE_FRAME_GRAY:
+		frame.Format = frameGray
+	case C.SANE_FRAME_RGB:
+		frame.Format = frameRGB
+	default:
+		return errors.New("three pass scanners are not supported")
+	}
+
+	w, err := newFrameWriter(filePath, frame)
+	if err != nil {
+		return err
+	}
+
+	buf := C.malloc(C.size_t(saneReadBufferSize))
+	defer C.free(buf)
+	for {
+		var length C.SANE_Int
+		status := C.sane_read(d.handle, (*C.SANE_Byte)(buf), C.SANE_Int(saneReadBufferSize), &length)
+		if status == C.SANE_STATUS_EOF {
+			break
+		}
+		if err := statusError(status); err != nil {
+			w.Abort()
+			return err
+		}
+		// the encoder copies what it keeps, buf is reused
+		if _, err := w.Write(unsafe.Slice((*byte)(buf), int(length))); err != nil {
+			w.Abort()
+			return err
+		}
+	}
+
+	return w.Close()
+}
+
+// Cancel ends a batch, it must be called after the last page.
+func (d *nativeDevice) Cancel() {
+	C.sane_cancel(d.handle)
+}
+
+// NativeScanner talks to libsane directly instead of running scanimage.
+type NativeScanner struct {
+	// mutex keeps sensor reads and scans from using the device at once.
+	mutex    sync.Mutex
+	options  Options
+	selector DeviceSelector
+	device   *nativeDevice
+	// settings were last applied to device.
+	settings Settings
+	// sensorRetryAt pauses sensor reads after the device was not found.
+	sensorRetryAt time.Time
+}
+
+func NewNativeScanner(opts Options, selector DeviceSelector) *NativeScanner {
+	return &NativeScanner{
+		options:  opts,
+		selector: selector,
+	}
+}
+
+func (s *NativeScanner) Device() string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.device != nil {
+		return s.device.name
+	}
+	return s.selector.String()
+}
+
+func (s *NativeScanner) open() error {
+	devices, err := nativeListDevices()
+	if err != nil {
+		return err
+	}
+
+	var found *Device
+	for _, device := range devices {
+		if s.selector.Matches(device) {
+			found = &device
+			break
+		}
+	}
+	if found == nil {
+		return fmt.Errorf("%w: %s", ErrDeviceNotFound, s.selector)
+	}
+
+	logrus.WithField("device", found.Name).WithField("serial", found.Serial).Info("Detected device")
+	device, err := openNativeDevice(found.Name)
+	if err != nil {
+		return err
+	}
+
+	err = s.applySettings(device, s.options.Settings)
+	if err != nil {
+		device.Close()
+		return err
+	}
+
+	s.device = device
+	return nil
+}
+
+func (s *NativeScanner) applySettings(device *nativeDevice, settings Settings) error {
+	caps := device.Capabilities()
+	args, err := settings.Args(caps)
+	if err == nil {
+		for _, arg := range s.options.SaneOptions {
+			if err = caps.checkArg(arg); err != nil {
+				break
+			}
+		}
+	}
+	if err == nil {
+		err = device.applyArgs(append(args, s.options.SaneOptions...))
+	}
+	if err != nil {
+		return fmt.Errorf("settings for %s: %w", device.name, err)
+	}
+
+	s.settings = settings
+	return nil
+}
+
+func (s *NativeScanner) Scan(dir string) ([]string, error) {
+	return s.ScanWith(dir, s.options.Settings)
+}
+
+// ScanWith scans with settings instead of the configured settings. They stay
+// applied to the device until other settings are requested.
+func (s *NativeScanner) ScanWith(dir string, settings Settings) ([]string, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.device == nil {
+		err := s.open()
+		if err != nil {
+			return nil, err
+		}
+	}
+	if settings != s.settings {
+		err := s.applySettings(s.device, settings)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	imagePaths, err := s.scanPages(dir, settings)
+	s.device.Cancel()
+	err = deviceIOError(err, func() error {
+		s.closeDevice()
+		return s.open()
+	})
+	if errors.Is(err, ErrNoDocs) && len(imagePaths) > 0 {
+		// the feeder ran empty, that ends every batch
+		return imagePaths, nil
+	}
+	if err != nil {
+		for _, imagePath := range imagePaths {
+			os.Remove(imagePath)
+		}
+	}
+	if errors.Is(err, ErrDeviceAbsent) {
+		// the device name changes when the scanner is re-plugged
+		logrus.WithField("device", s.device.name).Debug("Device failed, detecting it again on the next scan")
+		s.closeDevice()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return imagePaths, nil
+}
+
+func (s *NativeScanner) scanPages(dir string, settings Settings) ([]string, error) {
+	var imagePaths []string
+	for page := 1; ; page++ {
+		imagePath := filepath.Join(dir, fmt.Sprintf("scan-%03d.png", page))
+		err := s.device.ReadPage(imagePath)
+		if err != nil {
+			return imagePaths, err
+		}
+		imagePaths = append(imagePaths, imagePath)
+
+		if settings.singlePage() {
+			return imagePaths, nil
+		}
+	}
+}
+
+// ReadSensors reads the named buttons of the device. A device that is missing
+// is looked for again after sensorRetryWait, not on every poll.
+func (s *NativeScanner) ReadSensors(names []string) (map[string]bool, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.device == nil {
+		if time.Now().Before(s.sensorRetryAt) {
+			return nil, fmt.Errorf("%w: waiting before reading buttons again", ErrDeviceAbsent)
+		}
+		err := s.open()
+		if err != nil {
+			s.sensorRetryAt = time.Now().Add(sensorRetryWait)
+			return nil, err
+		}
+	}
+
+	sensors, err := s.device.Sensors(names)
+	if errors.Is(err, errDeviceIO) {
+		err = fmt.Errorf("%w: %v", ErrDeviceAbsent, err)
+	}
+	if errors.Is(err, ErrDeviceAbsent) {
+		s.closeDevice()
+	}
+	return sensors, err
+}
+
+func (s *NativeScanner) Close() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.closeDevice()
+	return nil
+}
+
+func (s *NativeScanner) closeDevice() {
+	if s.device != nil {
+		s.device.Close()
+		s.device = nil
+	}
+}
+
+func newDeviceScanner(opts Options, selector DeviceSelector) Scanner {
+	return NewNativeScanner(opts, selector)
+}
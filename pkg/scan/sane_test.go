@@ -0,0 +1,76 @@
+package scan
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeScanimage puts a scanimage script first in PATH. It lists the epson2
+// device unless the file "offline" exists and logs its calls to "calls".
+func fakeScanimage(t *testing.T) string {
+	dir := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "options"), []byte(epson2Options), 0644))
+	script := `#!/bin/sh
+dir=$(dirname "$0")
+echo "$*" >> "$dir/calls"
+case "$1" in
+--formatted-device-list)
+	[ -e "$dir/offline" ] || printf 'epson2:libusb:001:004\tEpson\tXP-4100\tflatbed scanner\n'
+	;;
+--all-options)
+	cat "$dir/options"
+	;;
+esac
+`
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "scanimage"), []byte(script), 0755))
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	return dir
+}
+
+func scanimageCalls(t *testing.T, dir string) []string {
+	data, err := os.ReadFile(filepath.Join(dir, "calls"))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	assert.NoError(t, err)
+	return strings.Split(strings.TrimSpace(string(data)), "\n")
+}
+
+func TestSaneScannerReadSensors(t *testing.T) {
+	dir := fakeScanimage(t)
+	scanner := NewDeviceScanner(Options{Settings: Settings{Source: SourceFlatbed}}, DeviceSelector{Model: "XP-4100"})
+
+	sensors, err := scanner.ReadSensors([]string{"scan", "copy"})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]bool{"scan": true}, sensors)
+
+	// once detected, a read lists the options only
+	calls := len(scanimageCalls(t, dir))
+	_, err = scanner.ReadSensors([]string{"scan"})
+	assert.NoError(t, err)
+	assert.Equal(t, calls+1, len(scanimageCalls(t, dir)))
+}
+
+func TestSaneScannerPausesSensorsWhileAbsent(t *testing.T) {
+	dir := fakeScanimage(t)
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "offline"), nil, 0644))
+	scanner := NewDeviceScanner(Options{Settings: Settings{Source: SourceFlatbed}}, DeviceSelector{Model: "XP-4100"})
+
+	_, err := scanner.ReadSensors([]string{"scan"})
+	assert.ErrorIs(t, err, ErrDeviceNotFound)
+	_, err = scanner.ReadSensors([]string{"scan"})
+	assert.ErrorIs(t, err, ErrDeviceAbsent)
+	assert.Len(t, scanimageCalls(t, dir), 1)
+
+	// the device is looked for again after the pause
+	assert.NoError(t, os.Remove(filepath.Join(dir, "offline")))
+	scanner.sensorRetryAt = time.Now()
+	sensors, err := scanner.ReadSensors([]string{"scan"})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]bool{"scan": true}, sensors)
+}
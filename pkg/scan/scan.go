@@ -1,5 +1,14 @@
 package scan
 
 type Scanner interface {
-	Scan() ([]string, error)
+	// Scan writes the scanned pages into dir and returns their paths.
+	Scan(dir string) ([]string, error)
+	// Device identifies the scanner, it is recorded as the bundle source.
+	Device() string
+}
+
+// SettingsScanner is implemented by scanners that can scan with other
+// settings than the configured ones, e.g. those of a scan profile.
+type SettingsScanner interface {
+	ScanWith(dir string, settings Settings) ([]string, error)
 }
@@ -0,0 +1,215 @@
+package scan
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+const (
+	ModeColor   = "color"
+	ModeGray    = "gray"
+	ModeLineart = "lineart"
+
+	SourceADF     = "adf"
+	SourceDuplex  = "duplex"
+	SourceFlatbed = "flatbed"
+)
+
+// PaperSizes are the supported paper sizes, width and height in mm.
+var PaperSizes = map[string][2]float64{
+	"a3":     {297, 420},
+	"a4":     {210, 297},
+	"a5":     {148, 210},
+	"letter": {215.9, 279.4},
+	"legal":  {215.9, 355.6},
+}
+
+// DefaultSettings apply to all settings that are not configured.
+var DefaultSettings = Settings{
+	Resolution: 600,
+	Source:     SourceDuplex,
+}
+
+// Settings are device independent scan settings. They are translated into
+// the options of the device when scanning.
+type Settings struct {
+	// Resolution in dpi.
+	Resolution int `yaml:"resolution"`
+	// Mode is color, gray or lineart. The device default is used if empty.
+	Mode string `yaml:"mode"`
+	// Source is adf (front side only), duplex or flatbed.
+	Source string `yaml:"source"`
+	// PaperSize is one of PaperSizes. The whole scan area is used if empty.
+	PaperSize  string `yaml:"papersize"`
+	Brightness *int   `yaml:"brightness"`
+	Contrast   *int   `yaml:"contrast"`
+}
+
+func (s Settings) withDefaults() Settings {
+	if s.Resolution == 0 {
+		s.Resolution = DefaultSettings.Resolution
+	}
+	if s.Source == "" {
+		s.Source = DefaultSettings.Source
+	}
+	return s
+}
+
+// singlePage is set for sources that cannot tell when the batch is done.
+func (s Settings) singlePage() bool {
+	return s.withDefaults().Source == SourceFlatbed
+}
+
+// Validate checks the settings without looking at a device.
+func (s Settings) Validate() error {
+	if s.Resolution < 0 {
+		return fmt.Errorf("invalid resolution %d", s.Resolution)
+	}
+
+	switch s.Mode {
+	case "", ModeColor, ModeGray, ModeLineart:
+	default:
+		return fmt.Errorf("unknown scan mode %q", s.Mode)
+	}
+
+	switch s.Source {
+	case "", SourceADF, SourceDuplex, SourceFlatbed:
+	default:
+		return fmt.Errorf("unknown scan source %q", s.Source)
+	}
+
+	if _, ok := PaperSizes[s.PaperSize]; s.PaperSize != "" && !ok {
+		return fmt.Errorf("unknown paper size %q", s.PaperSize)
+	}
+	return nil
+}
+
+// Args translates the settings into scanimage arguments for a device with
+// the given capabilities.
+func (s Settings) Args(caps Capabilities) ([]string, error) {
+	s = s.withDefaults()
+	err := s.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	var args []string
+	addArg := func(name, value string) error {
+		option, ok := caps[name]
+		if !ok {
+			return fmt.Errorf("device has no option %s", name)
+		}
+		if err := option.Accepts(value); err != nil {
+			return err
+		}
+
+		if len(name) == 2 {
+			args = append(args, name, value)
+		} else {
+			args = append(args, name+"="+value)
+		}
+		return nil
+	}
+
+	err = addArg("--resolution", strconv.Itoa(s.Resolution))
+	if err != nil {
+		return nil, err
+	}
+
+	if s.Mode != "" {
+		mode, err := modeValue(caps, s.Mode)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, "--mode="+mode)
+	}
+
+	sourceArgs, err := sourceArgs(caps, s.Source)
+	if err != nil {
+		return nil, err
+	}
+	args = append(args, sourceArgs...)
+
+	if s.PaperSize != "" {
+		size := PaperSizes[s.PaperSize]
+		err = errors.Join(
+			addArg("-x", strconv.FormatFloat(size[0], 'f', -1, 64)),
+			addArg("-y", strconv.FormatFloat(size[1], 'f', -1, 64)),
+		)
+		if err != nil {
+			return nil, fmt.Errorf("paper size %s: %w", s.PaperSize, err)
+		}
+	}
+
+	if s.Brightness != nil {
+		err = addArg("--brightness", strconv.Itoa(*s.Brightness))
+		if err != nil {
+			return nil, err
+		}
+	}
+	if s.Contrast != nil {
+		err = addArg("--contrast", strconv.Itoa(*s.Contrast))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return args, nil
+}
+
+func modeValue(caps Capabilities, mode string) (string, error) {
+	keywords := map[string][]string{
+		ModeColor:   {"color", "colour"},
+		ModeGray:    {"gray", "grey"},
+		ModeLineart: {"lineart", "binary", "monochrome"},
+	}
+
+	value, ok := caps["--mode"].findValue(keywords[mode]...)
+	if !ok {
+		return "", fmt.Errorf("device does not support scan mode %s", mode)
+	}
+	return value, nil
+}
+
+// sourceArgs selects the document source. Some backends offer duplex as a
+// source, others as a separate --duplex switch.
+func sourceArgs(caps Capabilities, source string) ([]string, error) {
+	option, hasSource := caps["--source"]
+	_, hasDuplex := caps["--duplex"]
+
+	switch source {
+	case SourceFlatbed:
+		if value, ok := option.findValue("flatbed"); ok {
+			return []string{"--source=" + value}, nil
+		}
+	case SourceDuplex:
+		if value, ok := option.findValue("duplex"); ok {
+			return []string{"--source=" + value}, nil
+		}
+		if hasDuplex {
+			args := []string{"--duplex=yes"}
+			if value, ok := option.findValue("adf", "feeder"); ok {
+				args = append([]string{"--source=" + value}, args...)
+			}
+			return args, nil
+		}
+	case SourceADF:
+		var args []string
+		for _, value := range option.Values {
+			if containsAny(value, "adf", "feeder") && !containsAny(value, "duplex", "back") {
+				args = append(args, "--source="+value)
+				break
+			}
+		}
+		if hasDuplex {
+			args = append(args, "--duplex=no")
+		}
+		// sheet fed scanners may have no source option at all
+		if len(args) > 0 || !hasSource {
+			return args, nil
+		}
+	}
+
+	return nil, fmt.Errorf("device does not support scan source %s", source)
+}
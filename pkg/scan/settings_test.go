@@ -0,0 +1,110 @@
+package scan
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const epson2Options = `All options specific to device ` + "`" + `epson2:libusb:001:004':
+  Scan Mode:
+    --mode Lineart|Gray|Color [Lineart]
+        Selects the scan mode (e.g., lineart, monochrome, or color).
+    --resolution 75|300|600|1200dpi [75]
+        Sets the resolution of the scanned image.
+    --source Flatbed|Automatic Document Feeder [Flatbed]
+        Selects the scan source.
+  Enhancement:
+    --brightness -4..3 [0]
+        Selects the brightness.
+    --swdeskew[=(yes|no)] [inactive]
+        Software deskew.
+  Geometry:
+    -l 0..215.9mm [0]
+        Top-left x position of scan area.
+    -x 0..215.9mm [215.9]
+        Width of scan-area.
+    -y 0..297.18mm [297.18]
+        Height of scan-area.
+  Sensors:
+    --scan[=(yes|no)] [yes] [read-only]
+        Scan button
+    --email[=(yes|no)] [no] [read-only]
+        Email button
+`
+
+const epsonscan2Options = `All options specific to device ` + "`" + `epsonscan2:DS-C490:584251413030303218:esci2:usb:ES0264:401':
+    --source ADF [ADF]
+    --mode Color|Grayscale|Monochrome [Color]
+    --resolution 50..1200 (in steps of 1) [200]
+    --duplex[=(yes|no)] [no]
+    --brightness -100..100 (in steps of 1) [0]
+    --contrast -100..100 (in steps of 1) [0]
+`
+
+func TestParseCapabilities(t *testing.T) {
+	caps := parseCapabilities(epson2Options)
+
+	assert.Equal(t, []string{"Lineart", "Gray", "Color"}, caps["--mode"].Values)
+	assert.Equal(t, []string{"75", "300", "600", "1200"}, caps["--resolution"].Values)
+	assert.Equal(t, "dpi", caps["--resolution"].Unit)
+	assert.Equal(t, []string{"Flatbed", "Automatic Document Feeder"}, caps["--source"].Values)
+	assert.Equal(t, DeviceOption{Name: "--brightness", IsRange: true, Min: -4, Max: 3, Value: "0"}, caps["--brightness"])
+	assert.Equal(t, DeviceOption{Name: "-x", IsRange: true, Max: 215.9, Unit: "mm", Value: "215.9"}, caps["-x"])
+	assert.True(t, caps["--swdeskew"].IsBool)
+	assert.True(t, caps["--swdeskew"].Inactive)
+	assert.Equal(t, DeviceOption{Name: "--scan", IsBool: true, ReadOnly: true, Value: "yes"}, caps["--scan"])
+	assert.Error(t, caps["--scan"].Accepts("no"))
+
+	caps = parseCapabilities(epsonscan2Options)
+	assert.Equal(t, DeviceOption{Name: "--resolution", IsRange: true, Min: 50, Max: 1200, Value: "200"}, caps["--resolution"])
+	assert.True(t, caps["--duplex"].IsBool)
+}
+
+func TestSettingsArgs(t *testing.T) {
+	intPtr := func(i int) *int { return &i }
+	epson2 := parseCapabilities(epson2Options)
+	epsonscan2 := parseCapabilities(epsonscan2Options)
+
+	args, err := Settings{}.Args(epsonscan2)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"--resolution=600", "--source=ADF", "--duplex=yes"}, args)
+
+	args, err = Settings{Resolution: 300, Mode: ModeGray, Source: SourceFlatbed, PaperSize: "a4", Brightness: intPtr(-2)}.Args(epson2)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"--resolution=300", "--mode=Gray", "--source=Flatbed", "-x", "210", "-y", "297", "--brightness=-2"}, args)
+
+	args, err = Settings{Mode: ModeLineart, Source: SourceADF, Contrast: intPtr(20)}.Args(epsonscan2)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"--resolution=600", "--mode=Monochrome", "--source=ADF", "--duplex=no", "--contrast=20"}, args)
+
+	args, err = Settings{Source: SourceADF}.Args(epson2)
+	assert.NoError(t, err)
+	assert.Contains(t, args, "--source=Automatic Document Feeder")
+
+	_, err = Settings{Resolution: 400, Source: SourceFlatbed}.Args(epson2)
+	assert.ErrorContains(t, err, "--resolution")
+	_, err = Settings{}.Args(epson2)
+	assert.ErrorContains(t, err, "duplex")
+	_, err = Settings{Source: SourceFlatbed}.Args(epsonscan2)
+	assert.ErrorContains(t, err, "flatbed")
+	_, err = Settings{Source: SourceFlatbed, PaperSize: "a3"}.Args(epson2)
+	assert.ErrorContains(t, err, "a3")
+	_, err = Settings{Brightness: intPtr(5)}.Args(epsonscan2)
+	assert.NoError(t, err)
+	_, err = Settings{Source: SourceFlatbed, Contrast: intPtr(5)}.Args(epson2)
+	assert.ErrorContains(t, err, "--contrast")
+	assert.Error(t, Settings{Mode: "sepia"}.Validate())
+	assert.Error(t, Settings{PaperSize: "a10"}.Validate())
+}
+
+func TestCheckSaneOptions(t *testing.T) {
+	caps := parseCapabilities(epsonscan2Options)
+
+	assert.NoError(t, caps.checkArg("--duplex=yes"))
+	assert.NoError(t, caps.checkArg("--contrast"))
+	assert.NoError(t, caps.checkArg("10"))
+	assert.Error(t, caps.checkArg("--duplex=maybe"))
+	assert.Error(t, caps.checkArg("--contrast=200"))
+	assert.Error(t, caps.checkArg("--swdeskew=yes"))
+}
@@ -0,0 +1,277 @@
+package scan
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	_ "image/jpeg"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+
+	xdraw "golang.org/x/image/draw"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
+
+	"github.com/sirupsen/logrus"
+)
+
+const simulatedDevicePrefix = "simulated:"
+
+// Outcomes of simulated scans.
+const (
+	SimulateOk               = "ok"
+	SimulateEmpty            = "empty"
+	SimulateJam              = "jam"
+	SimulateCoverOpen        = "coveropen"
+	SimulateBusy             = "busy"
+	SimulateOffline          = "offline"
+	SimulateDoubleFeed       = "doublefeed"
+	SimulatePermissionDenied = "denied"
+)
+
+var replayExtensions = []string{".png", ".jpg", ".jpeg"}
+
+type SimulatedOptions struct {
+	// ReplayDir holds images that every scan returns in name order. Pages
+	// are generated if it is empty.
+	ReplayDir string `yaml:"replaydir"`
+	// Sheets is the number of generated sheets per scan, 2 by default.
+	// Duplex scans return two pages per sheet.
+	Sheets int `yaml:"sheets"`
+	// BlankBacks leaves the back sides of generated duplex pages empty.
+	BlankBacks bool `yaml:"blankbacks"`
+	// Schedule is the outcome of consecutive scans, repeated from the start
+	// when it is used up: "ok", "empty", "jam", "coveropen", "busy",
+	// "offline", "doublefeed" or "denied". All scans succeed if it is empty.
+	Schedule []string `yaml:"schedule"`
+}
+
+func (o SimulatedOptions) Validate() error {
+	if o.Sheets < 0 {
+		return fmt.Errorf("invalid number of sheets %d", o.Sheets)
+	}
+	for _, outcome := range o.Schedule {
+		switch outcome {
+		case SimulateOk, SimulateEmpty, SimulateJam, SimulateCoverOpen, SimulateBusy, SimulateOffline, SimulateDoubleFeed, SimulatePermissionDenied:
+		default:
+			return fmt.Errorf("unknown simulated outcome %q", outcome)
+		}
+	}
+	return nil
+}
+
+func (o SimulatedOptions) sheets() int {
+	if o.Sheets == 0 {
+		return 2
+	}
+	return o.Sheets
+}
+
+// SimulatedScanner stands in for a real device in development and tests.
+type SimulatedScanner struct {
+	mutex    sync.Mutex
+	options  Options
+	selector DeviceSelector
+	scans    int
+}
+
+func NewSimulatedScanner(opts Options, selector DeviceSelector) *SimulatedScanner {
+	return &SimulatedScanner{
+		options:  opts,
+		selector: selector,
+	}
+}
+
+func (s *SimulatedScanner) Device() string {
+	if s.selector.Name != "" {
+		return simulatedDevicePrefix + s.selector.Name
+	}
+	return strings.TrimSuffix(simulatedDevicePrefix, ":")
+}
+
+func (s *SimulatedScanner) Scan(dir string) ([]string, error) {
+	return s.ScanWith(dir, s.options.Settings)
+}
+
+// ScanWith scans with settings instead of the configured settings. They
+// decide the size, color and sides of generated pages.
+func (s *SimulatedScanner) ScanWith(dir string, settings Settings) ([]string, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	err := settings.Validate()
+	if err != nil {
+		return nil, fmt.Errorf("settings for %s: %w", s.Device(), err)
+	}
+
+	s.scans++
+	outcome := s.outcome()
+	log := logrus.WithField("device", s.Device()).WithField("scan", s.scans).WithField("outcome", outcome)
+	switch outcome {
+	case SimulateEmpty:
+		log.Info("Simulated scan found no pages")
+		return nil, ErrNoDocs
+	case SimulateOffline:
+		return nil, ErrDeviceAbsent
+	case SimulateDoubleFeed:
+		return nil, ErrDoubleFeed
+	case SimulatePermissionDenied:
+		return nil, ErrPermissionDenied
+	case SimulateJam:
+		return nil, ErrJammed
+	case SimulateCoverOpen:
+		return nil, ErrCoverOpen
+	case SimulateBusy:
+		return nil, ErrDeviceBusy
+	}
+
+	var pages []image.Image
+	if s.options.Simulated.ReplayDir != "" {
+		pages, err = s.replayPages()
+	} else {
+		pages = s.generatePages(settings.withDefaults())
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var imagePaths []string
+	for i, page := range pages {
+		imagePath := filepath.Join(dir, fmt.Sprintf("scan-%03d.png", i+1))
+		err = writePng(imagePath, page)
+		if err != nil {
+			for _, imagePath := range imagePaths {
+				os.Remove(imagePath)
+			}
+			return nil, err
+		}
+		imagePaths = append(imagePaths, imagePath)
+	}
+
+	log.WithField("pages", len(imagePaths)).Info("Simulated scan")
+	return imagePaths, nil
+}
+
+func (s *SimulatedScanner) outcome() string {
+	schedule := s.options.Simulated.Schedule
+	if len(schedule) == 0 {
+		return SimulateOk
+	}
+	return schedule[(s.scans-1)%len(schedule)]
+}
+
+func (s *SimulatedScanner) replayPages() ([]image.Image, error) {
+	entries, err := os.ReadDir(s.options.Simulated.ReplayDir)
+	if err != nil {
+		return nil, err
+	}
+
+	var pages []image.Image
+	for _, entry := range entries {
+		if entry.IsDir() || !slices.Contains(replayExtensions, strings.ToLower(filepath.Ext(entry.Name()))) {
+			continue
+		}
+
+		page, err := readImage(filepath.Join(s.options.Simulated.ReplayDir, entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("replay %s: %w", entry.Name(), err)
+		}
+		pages = append(pages, page)
+	}
+	return pages, nil
+}
+
+func readImage(filePath string) (image.Image, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	img, _, err := image.Decode(f)
+	return img, err
+}
+
+func (s *SimulatedScanner) generatePages(settings Settings) []image.Image {
+	sheets := s.options.Simulated.sheets()
+	if settings.singlePage() {
+		sheets = 1
+	}
+
+	var pages []image.Image
+	for sheet := 1; sheet <= sheets; sheet++ {
+		pages = append(pages, s.generatePage(settings, fmt.Sprintf("Sheet %d front", sheet)))
+		if settings.Source != SourceDuplex {
+			continue
+		}
+		if s.options.Simulated.BlankBacks {
+			pages = append(pages, s.generatePage(settings, ""))
+		} else {
+			pages = append(pages, s.generatePage(settings, fmt.Sprintf("Sheet %d back", sheet)))
+		}
+	}
+	return pages
+}
+
+// generatePage draws the label large enough for OCR. Pages without a label
+// are blank.
+func (s *SimulatedScanner) generatePage(settings Settings, label string) image.Image {
+	paperSize, ok := PaperSizes[settings.PaperSize]
+	if !ok {
+		paperSize = PaperSizes["a4"]
+	}
+	bounds := image.Rect(0, 0, mmToPixels(paperSize[0], settings.Resolution), mmToPixels(paperSize[1], settings.Resolution))
+
+	var page draw.Image
+	if settings.Mode == ModeColor {
+		page = image.NewRGBA(bounds)
+	} else {
+		page = image.NewGray(bounds)
+	}
+	draw.Draw(page, bounds, image.White, image.Point{}, draw.Src)
+	if label == "" {
+		return page
+	}
+
+	lines := []string{"Simulated scan", fmt.Sprintf("Scan %d", s.scans), label}
+	text := renderText(lines)
+	// the text spans two thirds of the page width
+	width := bounds.Dx() * 2 / 3
+	height := width * text.Bounds().Dy() / text.Bounds().Dx()
+	target := image.Rect(bounds.Dx()/6, bounds.Dy()/8, bounds.Dx()/6+width, bounds.Dy()/8+height)
+	xdraw.NearestNeighbor.Scale(page, target, text, text.Bounds(), draw.Src, nil)
+
+	if settings.Mode == ModeColor {
+		band := image.Rect(0, 0, bounds.Dx(), bounds.Dy()/40)
+		draw.Draw(page, band, image.NewUniform(color.RGBA{R: 0x30, G: 0x60, B: 0xc0, A: 0xff}), image.Point{}, draw.Src)
+	}
+	return page
+}
+
+// renderText writes the lines black on white with a bitmap font.
+func renderText(lines []string) image.Image {
+	face := basicfont.Face7x13
+	width := 0
+	for _, line := range lines {
+		width = max(width, font.MeasureString(face, line).Ceil())
+	}
+	lineHeight := face.Metrics().Height.Ceil()
+
+	text := image.NewGray(image.Rect(0, 0, width+2, lineHeight*len(lines)+2))
+	draw.Draw(text, text.Bounds(), image.White, image.Point{}, draw.Src)
+	drawer := &font.Drawer{Dst: text, Src: image.Black, Face: face}
+	for i, line := range lines {
+		drawer.Dot = fixed.P(1, (i+1)*lineHeight-face.Descent+1)
+		drawer.DrawString(line)
+	}
+	return text
+}
+
+func mmToPixels(mm float64, dpi int) int {
+	return int(mm / 25.4 * float64(dpi))
+}
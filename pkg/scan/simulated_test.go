@@ -0,0 +1,138 @@
+package scan
+
+import (
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func readPng(t *testing.T, filePath string) image.Image {
+	f, err := os.Open(filePath)
+	assert.NoError(t, err)
+	defer f.Close()
+	img, err := png.Decode(f)
+	assert.NoError(t, err)
+	return img
+}
+
+func isBlank(img image.Image) bool {
+	bounds := img.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			if r, g, b, _ := img.At(x, y).RGBA(); r != 0xffff || g != 0xffff || b != 0xffff {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func TestSimulatedScannerDuplex(t *testing.T) {
+	dir := t.TempDir()
+	scanner := NewSimulatedScanner(Options{
+		Settings:  Settings{Resolution: 50, Source: SourceDuplex, PaperSize: "a5"},
+		Simulated: SimulatedOptions{Sheets: 2, BlankBacks: true},
+	}, DeviceSelector{Name: "desk", Driver: DriverSimulated})
+	assert.Equal(t, "simulated:desk", scanner.Device())
+
+	imagePaths, err := scanner.Scan(dir)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		filepath.Join(dir, "scan-001.png"),
+		filepath.Join(dir, "scan-002.png"),
+		filepath.Join(dir, "scan-003.png"),
+		filepath.Join(dir, "scan-004.png"),
+	}, imagePaths)
+
+	front := readPng(t, imagePaths[0])
+	assert.Equal(t, image.Rect(0, 0, 291, 413), front.Bounds())
+	assert.False(t, isBlank(front))
+	assert.True(t, isBlank(readPng(t, imagePaths[1])))
+}
+
+func TestSimulatedScannerUsesSettings(t *testing.T) {
+	dir := t.TempDir()
+	scanner := NewSimulatedScanner(Options{Settings: Settings{Resolution: 50}}, DeviceSelector{Driver: DriverSimulated})
+	assert.Equal(t, "simulated", scanner.Device())
+
+	imagePaths, err := scanner.ScanWith(dir, Settings{Resolution: 30, Source: SourceFlatbed, Mode: ModeColor})
+	assert.NoError(t, err)
+	if assert.Len(t, imagePaths, 1) {
+		_, isGray := readPng(t, imagePaths[0]).ColorModel().Convert(color.White).(color.Gray)
+		assert.False(t, isGray)
+	}
+
+	_, err = scanner.ScanWith(dir, Settings{Mode: "sepia"})
+	assert.Error(t, err)
+}
+
+func TestSimulatedScannerReplaysDir(t *testing.T) {
+	replayDir := t.TempDir()
+	for _, name := range []string{"b.png", "a.png"} {
+		f, err := os.Create(filepath.Join(replayDir, name))
+		assert.NoError(t, err)
+		size := 10
+		if name == "b.png" {
+			size = 20
+		}
+		assert.NoError(t, png.Encode(f, image.NewGray(image.Rect(0, 0, size, size))))
+		f.Close()
+	}
+	assert.NoError(t, os.WriteFile(filepath.Join(replayDir, "notes.txt"), []byte("ignored"), 0644))
+
+	dir := t.TempDir()
+	scanner := NewSimulatedScanner(Options{Simulated: SimulatedOptions{ReplayDir: replayDir}}, DeviceSelector{Driver: DriverSimulated})
+	imagePaths, err := scanner.Scan(dir)
+	assert.NoError(t, err)
+	if assert.Len(t, imagePaths, 2) {
+		assert.Equal(t, 10, readPng(t, imagePaths[0]).Bounds().Dx())
+		assert.Equal(t, 20, readPng(t, imagePaths[1]).Bounds().Dx())
+	}
+}
+
+func TestSimulatedScannerSchedule(t *testing.T) {
+	dir := t.TempDir()
+	scanner := NewSimulatedScanner(Options{
+		Settings:  Settings{Resolution: 20, Source: SourceADF},
+		Simulated: SimulatedOptions{Sheets: 3, Schedule: []string{SimulateOk, SimulateEmpty, SimulateJam, SimulateCoverOpen, SimulateBusy}},
+	}, DeviceSelector{Driver: DriverSimulated})
+
+	imagePaths, err := scanner.Scan(dir)
+	assert.NoError(t, err)
+	assert.Len(t, imagePaths, 3)
+
+	imagePaths, err = scanner.Scan(dir)
+	assert.ErrorIs(t, err, ErrNoDocs)
+	assert.Empty(t, imagePaths)
+
+	_, err = scanner.Scan(dir)
+	assert.ErrorIs(t, err, ErrJammed)
+	_, err = scanner.Scan(dir)
+	assert.ErrorIs(t, err, ErrCoverOpen)
+	_, err = scanner.Scan(dir)
+	assert.ErrorIs(t, err, ErrDeviceBusy)
+
+	// the schedule starts over
+	imagePaths, err = scanner.Scan(dir)
+	assert.NoError(t, err)
+	assert.Len(t, imagePaths, 3)
+}
+
+func TestSimulatedOptionsValidate(t *testing.T) {
+	assert.NoError(t, SimulatedOptions{Schedule: []string{SimulateOk, SimulateOffline}}.Validate())
+	assert.Error(t, SimulatedOptions{Schedule: []string{"fire"}}.Validate())
+	assert.Error(t, SimulatedOptions{Sheets: -1}.Validate())
+	assert.NoError(t, DeviceSelector{Driver: DriverSimulated}.Validate())
+}
+
+func TestNewScannersSimulated(t *testing.T) {
+	scanners := NewScanners(Options{Devices: []DeviceSelector{{Driver: DriverSimulated}}})
+	if assert.Len(t, scanners, 1) {
+		assert.IsType(t, &SimulatedScanner{}, scanners[0])
+	}
+}
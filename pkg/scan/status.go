@@ -0,0 +1,139 @@
+package scan
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Conditions reported by the device while scanning.
+var (
+	ErrNoDocs           = errors.New("document feeder is empty")
+	ErrJammed           = errors.New("paper jam")
+	ErrCoverOpen        = errors.New("cover is open")
+	ErrDeviceBusy       = errors.New("device is busy")
+	ErrDoubleFeed       = errors.New("double feed")
+	ErrPermissionDenied = errors.New("permission denied")
+	// ErrDeviceAbsent is returned when the device is turned off, unplugged
+	// or unreachable.
+	ErrDeviceAbsent = errors.New("device is absent")
+)
+
+// errDeviceIO is the SANE I/O error. The DS-C490 reports it for an empty
+// feeder, so it is resolved by deviceIOError before it is returned.
+var errDeviceIO = errors.New("error during device I/O")
+
+// Condition classifies the outcome of a scan for status and metrics.
+type Condition string
+
+const (
+	ConditionOk               Condition = "ok"
+	ConditionFeederEmpty      Condition = "feeder_empty"
+	ConditionDeviceAbsent     Condition = "device_absent"
+	ConditionDeviceBusy       Condition = "device_busy"
+	ConditionJammed           Condition = "paper_jam"
+	ConditionCoverOpen        Condition = "cover_open"
+	ConditionDoubleFeed       Condition = "double_feed"
+	ConditionPermissionDenied Condition = "permission_denied"
+	// ConditionFailed is any error that could not be classified.
+	ConditionFailed Condition = "failed"
+)
+
+// Action tells how to react to a condition.
+type Action string
+
+const (
+	// ActionNone scans again as usual.
+	ActionNone Action = "none"
+	// ActionRetry repeats the scan soon, the condition passes by itself.
+	ActionRetry Action = "retry"
+	// ActionBackOff waits increasingly longer before scanning again.
+	ActionBackOff Action = "backoff"
+	// ActionAlert needs a person, e.g. to clear a jam. Scanning backs off
+	// until then.
+	ActionAlert Action = "alert"
+)
+
+var conditionErrors = []struct {
+	err       error
+	condition Condition
+}{
+	{ErrNoDocs, ConditionFeederEmpty},
+	{ErrDeviceAbsent, ConditionDeviceAbsent},
+	{ErrDeviceNotFound, ConditionDeviceAbsent},
+	{ErrDeviceBusy, ConditionDeviceBusy},
+	{ErrJammed, ConditionJammed},
+	{ErrCoverOpen, ConditionCoverOpen},
+	{ErrDoubleFeed, ConditionDoubleFeed},
+	{ErrPermissionDenied, ConditionPermissionDenied},
+}
+
+// Classify returns the condition a scan error stands for.
+func Classify(err error) Condition {
+	if err == nil {
+		return ConditionOk
+	}
+	for _, c := range conditionErrors {
+		if errors.Is(err, c.err) {
+			return c.condition
+		}
+	}
+	return ConditionFailed
+}
+
+func (c Condition) Action() Action {
+	switch c {
+	case ConditionOk, ConditionFeederEmpty:
+		return ActionNone
+	case ConditionDeviceBusy:
+		return ActionRetry
+	case ConditionJammed, ConditionCoverOpen, ConditionDoubleFeed, ConditionPermissionDenied:
+		return ActionAlert
+	default:
+		return ActionBackOff
+	}
+}
+
+// scanimageMessages map the SANE status messages and backend specific
+// messages scanimage prints to the conditions they stand for.
+var scanimageMessages = []struct {
+	pattern *regexp.Regexp
+	err     error
+}{
+	{regexp.MustCompile(`(?i)double[ -]?feed|multi[ -]?feed|multiple sheets`), ErrDoubleFeed},
+	{regexp.MustCompile(`(?i)feeder (is )?(out of documents|empty)|no documents`), ErrNoDocs},
+	{regexp.MustCompile(`(?i)feeder jammed|paper jam`), ErrJammed},
+	{regexp.MustCompile(`(?i)cover (is )?open`), ErrCoverOpen},
+	{regexp.MustCompile(`(?i)device busy`), ErrDeviceBusy},
+	{regexp.MustCompile(`(?i)access to resource has been denied|permission denied`), ErrPermissionDenied},
+	{regexp.MustCompile(`(?i)error during device I/O`), errDeviceIO},
+	{regexp.MustCompile(`(?i)no SANE devices found|open of device .* failed: invalid argument`), ErrDeviceAbsent},
+}
+
+// deviceIOError resolves errDeviceIO by detecting the device again: it is
+// absent if that fails, otherwise the feeder is empty. Other errors are
+// returned as they are.
+func deviceIOError(err error, detect func() error) error {
+	if !errors.Is(err, errDeviceIO) {
+		return err
+	}
+
+	detectErr := detect()
+	if detectErr != nil {
+		return fmt.Errorf("%w: %v: %v", ErrDeviceAbsent, err, detectErr)
+	}
+	return fmt.Errorf("%w: %v", ErrNoDocs, err)
+}
+
+// scanimageError classifies a failed scanimage run by its stderr. The
+// message is kept for the log.
+func scanimageError(runErr error, stderr string) error {
+	message := strings.TrimSpace(stderr)
+	for _, m := range scanimageMessages {
+		if m.pattern.MatchString(message) {
+			return fmt.Errorf("%w: %s", m.err, message)
+		}
+	}
+	return errors.Join(runErr, errors.New(message))
+}
@@ -0,0 +1,66 @@
+package scan
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClassify(t *testing.T) {
+	assert.Equal(t, ConditionOk, Classify(nil))
+	assert.Equal(t, ConditionFeederEmpty, Classify(ErrNoDocs))
+	assert.Equal(t, ConditionJammed, Classify(fmt.Errorf("settings for x: %w", ErrJammed)))
+	assert.Equal(t, ConditionDeviceAbsent, Classify(fmt.Errorf("%w: DS-C490", ErrDeviceNotFound)))
+	assert.Equal(t, ConditionDoubleFeed, Classify(ErrDoubleFeed))
+	assert.Equal(t, ConditionFailed, Classify(errors.New("out of memory")))
+}
+
+func TestConditionAction(t *testing.T) {
+	assert.Equal(t, ActionNone, ConditionFeederEmpty.Action())
+	assert.Equal(t, ActionRetry, ConditionDeviceBusy.Action())
+	assert.Equal(t, ActionBackOff, ConditionDeviceAbsent.Action())
+	assert.Equal(t, ActionBackOff, ConditionFailed.Action())
+	assert.Equal(t, ActionAlert, ConditionCoverOpen.Action())
+	assert.Equal(t, ActionAlert, ConditionPermissionDenied.Action())
+}
+
+func TestScanimageError(t *testing.T) {
+	exitErr := errors.New("exit status 7")
+	for stderr, expected := range map[string]error{
+		"scanimage: sane_start: Document feeder out of documents\n":                                    ErrNoDocs,
+		"scanimage: sane_start: Document feeder jammed\n":                                              ErrJammed,
+		"scanimage: sane_read: Scanner cover is open\n":                                                ErrCoverOpen,
+		"scanimage: sane_start: Device busy\n":                                                         ErrDeviceBusy,
+		"scanimage: sane_read: Error during device I/O\n":                                              errDeviceIO,
+		"scanimage: open of device epson2:libusb:001:004 failed: Invalid argument\n":                   ErrDeviceAbsent,
+		"scanimage: open of device epson2:libusb:001:004 failed: Access to resource has been denied\n": ErrPermissionDenied,
+		"scanimage: sane_read: Double feed detected\n":                                                 ErrDoubleFeed,
+	} {
+		err := scanimageError(exitErr, stderr)
+		assert.ErrorIs(t, err, expected, stderr)
+		assert.ErrorContains(t, err, "scanimage:")
+	}
+
+	err := scanimageError(exitErr, "scanimage: something new\n")
+	assert.ErrorIs(t, err, exitErr)
+	assert.Equal(t, ConditionFailed, Classify(err))
+}
+
+func TestDeviceIOError(t *testing.T) {
+	ioErr := scanimageError(errors.New("exit status 9"), "scanimage: sane_read: Error during device I/O\n")
+
+	// the DS-C490 reports an empty feeder like this
+	err := deviceIOError(ioErr, func() error { return nil })
+	assert.ErrorIs(t, err, ErrNoDocs)
+	assert.Equal(t, ConditionFeederEmpty, Classify(err))
+
+	err = deviceIOError(ioErr, func() error { return fmt.Errorf("%w: DS-C490", ErrDeviceNotFound) })
+	assert.ErrorIs(t, err, ErrDeviceAbsent)
+	assert.Equal(t, ConditionDeviceAbsent, Classify(err))
+
+	// other errors do not detect the device again
+	err = deviceIOError(ErrJammed, func() error { panic("detect") })
+	assert.Equal(t, ErrJammed, err)
+}
@@ -0,0 +1,196 @@
+package scan
+
+import (
+	"errors"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+var ErrScanPending = errors.New("a scan is already pending")
+
+// maxPendingTriggers limits how many scans can wait for a busy scanner.
+var maxPendingTriggers = 4
+
+var defaultButtonPollInterval = 2 * time.Second
+
+// OriginSchedule marks the triggers of schedules. All other triggers were
+// asked for by someone, e.g. with a button or the API.
+const OriginSchedule = "schedule"
+
+// Trigger asks a scanner to scan once.
+type Trigger struct {
+	// Profile is the name of the scan profile to use, empty for the default.
+	Profile string
+	// Origin tells what fired the trigger, e.g. "button:scan" or "api".
+	Origin string
+}
+
+// SensorReader is implemented by scanners that can read the buttons of their
+// device.
+type SensorReader interface {
+	// ReadSensors reads the named sensors, unknown names are left out.
+	ReadSensors(names []string) (map[string]bool, error)
+}
+
+type TriggerOptions struct {
+	// Buttons maps the sensor options of the device, e.g. "scan" or "email",
+	// to the profile to scan with when the button is pressed.
+	Buttons map[string]string `yaml:"buttons"`
+	// ButtonPollInterval is how often buttons are read, 2s by default.
+	// Without the sane build tag every read runs scanimage.
+	ButtonPollInterval time.Duration `yaml:"buttonpollinterval"`
+	// Schedule fires scans at fixed intervals.
+	Schedule []ScheduleOptions `yaml:"schedule"`
+	// Continuous scans whenever the scan handler runs, like before triggers
+	// existed. It is the default if no buttons and no schedule are set.
+	Continuous bool `yaml:"continuous"`
+}
+
+type ScheduleOptions struct {
+	Every   time.Duration `yaml:"every"`
+	Profile string        `yaml:"profile"`
+}
+
+// IsContinuous tells whether scans run without waiting for a trigger.
+func (o TriggerOptions) IsContinuous() bool {
+	return o.Continuous || len(o.Buttons) == 0 && len(o.Schedule) == 0
+}
+
+func (o TriggerOptions) Validate() error {
+	for _, schedule := range o.Schedule {
+		if schedule.Every <= 0 {
+			return errors.New("schedule needs a positive interval")
+		}
+	}
+	if o.ButtonPollInterval < 0 {
+		return errors.New("button poll interval must not be negative")
+	}
+	return nil
+}
+
+// Triggers collects the scan requests for one scanner from its buttons, the
+// schedule and API calls.
+type Triggers struct {
+	options  TriggerOptions
+	scanner  Scanner
+	pending  chan Trigger
+	stop     chan struct{}
+	wgClosed sync.WaitGroup
+}
+
+func NewTriggers(opts TriggerOptions, scanner Scanner) *Triggers {
+	return &Triggers{
+		options: opts,
+		scanner: scanner,
+		pending: make(chan Trigger, maxPendingTriggers),
+	}
+}
+
+func (t *Triggers) Start() {
+	t.stop = make(chan struct{})
+
+	if len(t.options.Buttons) > 0 {
+		if sensors, ok := t.scanner.(SensorReader); ok {
+			t.wgClosed.Add(1)
+			go t.pollButtons(sensors)
+		} else {
+			logrus.WithField("device", t.scanner.Device()).Warn("Scanner cannot read buttons, ignoring button triggers")
+		}
+	}
+
+	for _, schedule := range t.options.Schedule {
+		t.wgClosed.Add(1)
+		go t.runSchedule(schedule)
+	}
+}
+
+func (t *Triggers) Stop() {
+	if t.stop == nil {
+		return
+	}
+	close(t.stop)
+	t.wgClosed.Wait()
+	t.stop = nil
+}
+
+// Fire requests a scan. It fails if too many scans are pending already.
+func (t *Triggers) Fire(trigger Trigger) error {
+	select {
+	case t.pending <- trigger:
+		logrus.WithField("device", t.scanner.Device()).WithField("origin", trigger.Origin).WithField("profile", trigger.Profile).Info("Scan triggered")
+		return nil
+	default:
+		return ErrScanPending
+	}
+}
+
+// Next returns the next pending trigger without waiting.
+func (t *Triggers) Next() (Trigger, bool) {
+	select {
+	case trigger := <-t.pending:
+		return trigger, true
+	default:
+		return Trigger{}, false
+	}
+}
+
+func (t *Triggers) pollButtons(sensors SensorReader) {
+	defer t.wgClosed.Done()
+
+	interval := t.options.ButtonPollInterval
+	if interval == 0 {
+		interval = defaultButtonPollInterval
+	}
+	names := slices.Sorted(maps.Keys(t.options.Buttons))
+
+	pressed := make(map[string]bool)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-t.stop:
+			return
+		case <-ticker.C:
+		}
+
+		state, err := sensors.ReadSensors(names)
+		if err != nil {
+			logrus.WithError(err).WithField("device", t.scanner.Device()).Debug("Failed to read buttons")
+			continue
+		}
+
+		for button, profile := range t.options.Buttons {
+			// fire once per press, not while the button is held
+			if state[button] && !pressed[button] {
+				t.fire(Trigger{Profile: profile, Origin: "button:" + button})
+			}
+			pressed[button] = state[button]
+		}
+	}
+}
+
+func (t *Triggers) runSchedule(schedule ScheduleOptions) {
+	defer t.wgClosed.Done()
+
+	ticker := time.NewTicker(schedule.Every)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-t.stop:
+			return
+		case <-ticker.C:
+			t.fire(Trigger{Profile: schedule.Profile, Origin: OriginSchedule})
+		}
+	}
+}
+
+func (t *Triggers) fire(trigger Trigger) {
+	err := t.Fire(trigger)
+	if err != nil {
+		logrus.WithError(err).WithField("origin", trigger.Origin).Warn("Dropped scan trigger")
+	}
+}
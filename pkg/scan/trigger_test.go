@@ -0,0 +1,100 @@
+package scan
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testButtonScanner struct {
+	mutex   sync.Mutex
+	buttons map[string]bool
+}
+
+func (s *testButtonScanner) Scan(dir string) ([]string, error) {
+	return nil, nil
+}
+
+func (s *testButtonScanner) Device() string {
+	return "test"
+}
+
+func (s *testButtonScanner) ReadSensors(names []string) (map[string]bool, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	state := make(map[string]bool)
+	for _, name := range names {
+		state[name] = s.buttons[name]
+	}
+	return state, nil
+}
+
+func (s *testButtonScanner) press(button string, pressed bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.buttons[button] = pressed
+}
+
+func waitForTrigger(t *testing.T, triggers *Triggers) Trigger {
+	var trigger Trigger
+	assert.Eventually(t, func() bool {
+		var ok bool
+		trigger, ok = triggers.Next()
+		return ok
+	}, 2*time.Second, time.Millisecond)
+	return trigger
+}
+
+func TestButtonTriggers(t *testing.T) {
+	scanner := &testButtonScanner{buttons: map[string]bool{"scan": false, "email": false}}
+	triggers := NewTriggers(TriggerOptions{
+		Buttons:            map[string]string{"scan": "contracts", "email": "receipts"},
+		ButtonPollInterval: time.Millisecond,
+	}, scanner)
+	triggers.Start()
+	defer triggers.Stop()
+
+	scanner.press("email", true)
+	assert.Equal(t, Trigger{Profile: "receipts", Origin: "button:email"}, waitForTrigger(t, triggers))
+
+	// holding the button does not fire again
+	time.Sleep(20 * time.Millisecond)
+	_, ok := triggers.Next()
+	assert.False(t, ok)
+
+	scanner.press("email", false)
+	scanner.press("scan", true)
+	assert.Equal(t, Trigger{Profile: "contracts", Origin: "button:scan"}, waitForTrigger(t, triggers))
+}
+
+func TestScheduleTriggers(t *testing.T) {
+	triggers := NewTriggers(TriggerOptions{
+		Schedule: []ScheduleOptions{{Every: 5 * time.Millisecond, Profile: "nightly"}},
+	}, &testButtonScanner{})
+	triggers.Start()
+	defer triggers.Stop()
+
+	assert.Equal(t, Trigger{Profile: "nightly", Origin: "schedule"}, waitForTrigger(t, triggers))
+}
+
+func TestTriggersPending(t *testing.T) {
+	triggers := NewTriggers(TriggerOptions{}, &testButtonScanner{})
+	for i := 0; i < maxPendingTriggers; i++ {
+		assert.NoError(t, triggers.Fire(Trigger{Origin: "api"}))
+	}
+	assert.ErrorIs(t, triggers.Fire(Trigger{Origin: "api"}), ErrScanPending)
+
+	_, ok := triggers.Next()
+	assert.True(t, ok)
+	assert.NoError(t, triggers.Fire(Trigger{Origin: "api"}))
+}
+
+func TestTriggerOptions(t *testing.T) {
+	assert.True(t, TriggerOptions{}.IsContinuous())
+	assert.False(t, TriggerOptions{Buttons: map[string]string{"scan": ""}}.IsContinuous())
+	assert.True(t, TriggerOptions{Buttons: map[string]string{"scan": ""}, Continuous: true}.IsContinuous())
+	assert.Error(t, TriggerOptions{Schedule: []ScheduleOptions{{}}}.Validate())
+}
@@ -4,7 +4,6 @@ import (
 	"bytes"
 	"io"
 	"os/exec"
-	"strings"
 
 	"github.com/schidstorm/scanner-tool/pkg/ai"
 	queueoutputcreator "github.com/schidstorm/scanner-tool/pkg/queue_output_creator"
@@ -28,34 +27,36 @@ func (i *AiHandler) WithFileTagsGuesser(fileTagsGuesser ai.FileTagsGuesser) *AiH
 
 func (i *AiHandler) Run(logger *logrus.Logger, input chan InputFile, outputFiles queueoutputcreator.QueueZipFileWriter) (resErr error) {
 	for f := range input {
-		rc, err := f.Open()
-		if err != nil {
-			return err
-		}
-		defer rc.Close()
-		pdfData, err := io.ReadAll(rc)
+		fileName, fileTags, err := i.guessFileNameAndTags(f)
 		if err != nil {
+			logrus.Errorf("Failed to guess file name: %v", err)
 			return err
 		}
 
-		fileName, fileTags, err := i.guessFileNameAndTags(pdfData)
+		err = copyInputFile(f, fileName, outputFiles)
 		if err != nil {
-			logrus.Errorf("Failed to guess file name: %v", err)
 			return err
 		}
-
-		outputFiles.AddFile(fileName, pdfData)
-		metadata := &queueoutputcreator.Metadata{}
-		metadata.Set("tags", strings.Join(fileTags, ","))
-		outputFiles.AttachMetadata(fileName, metadata)
+		outputFiles.Manifest().AddFile(fileName).Tags = fileTags
 	}
 
 	return nil
 }
 
-func (i *AiHandler) guessFileNameAndTags(pdfData []byte) (string, []string, error) {
+// copyInputFile streams f into outputFiles as fileName.
+func copyInputFile(f InputFile, fileName string, outputFiles queueoutputcreator.QueueZipFileWriter) error {
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	return outputFiles.AddFileReader(fileName, rc).Error()
+}
+
+func (i *AiHandler) guessFileNameAndTags(f InputFile) (string, []string, error) {
 	logrus.Info("Extracting text from PDF")
-	text, err := extractTextFromPdf(pdfData)
+	text, err := extractTextFromInputFile(f)
 	if err != nil {
 		logrus.Errorf("Failed to extract text from PDF: %v", err)
 		return "", nil, err
@@ -79,11 +80,20 @@ func (i *AiHandler) guessFileNameAndTags(pdfData []byte) (string, []string, erro
 	return fileName, fileTags, nil
 }
 
-func extractTextFromPdf(pdfData []byte) (string, error) {
+func extractTextFromInputFile(f InputFile) (string, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return "", err
+	}
+	defer rc.Close()
+
+	return extractTextFromPdf(rc)
+}
+
+func extractTextFromPdf(pdf io.Reader) (string, error) {
 	cmd := exec.Command("pdftotext", "-", "-")
-	inBuffer := bytes.NewBuffer(pdfData)
 	outBuffer := &bytes.Buffer{}
-	cmd.Stdin = inBuffer
+	cmd.Stdin = pdf
 	cmd.Stdout = outBuffer
 	err := cmd.Run()
 	if err != nil {
@@ -1,9 +1,13 @@
 package server
 
 import (
+	"errors"
+	"fmt"
 	"io"
 	"io/fs"
+	"os"
 	"reflect"
+	"slices"
 	"sync"
 	"time"
 
@@ -19,7 +23,9 @@ var daemonScanWait = 5 * time.Second
 type InputFile interface {
 	Open() (io.ReadCloser, error)
 	FileInfo() fs.FileInfo
+	// Metadata is the flat view of Entry, kept for older handlers.
 	Metadata() map[string]string
+	Entry() *queueoutputcreator.FileEntry
 }
 
 type DaemonHandler interface {
@@ -27,31 +33,89 @@ type DaemonHandler interface {
 	Close() error
 }
 
+// MetadataInheritor can be implemented by handlers that manage the metadata
+// of their output themselves. If InheritMetadata returns false, the daemon
+// does not copy metadata from the input bundle.
+type MetadataInheritor interface {
+	InheritMetadata() bool
+}
+
+// BytesFinalizer is implemented by writers that keep the bundle in memory.
+// The daemon enqueues their data directly instead of a file.
+type BytesFinalizer interface {
+	FinalizeBytes() ([]byte, error)
+}
+
 type QueueFactory func(name string) filequeue.Queue
+type WriterFactory func() queueoutputcreator.QueueZipFileWriter
 type Daemon struct {
-	closeRequest chan struct{}
-	handlers     []DaemonHandler
-	wgClosed     *sync.WaitGroup
-	queueFactory QueueFactory
+	closeRequest  chan struct{}
+	handlers      []DaemonHandler
+	sources       []DaemonHandler
+	wgClosed      *sync.WaitGroup
+	queueFactory  QueueFactory
+	writerFactory WriterFactory
+	queues        map[string]filequeue.Queue
+	queuesMutex   *sync.Mutex
+	stages        []string
+	conflicts     queueoutputcreator.ConflictPolicy
+	jobs          *jobTracker
 }
 
 func NewDaemon(queueFactory QueueFactory, handlers []DaemonHandler) *Daemon {
 	return &Daemon{
-		handlers:     handlers,
-		wgClosed:     new(sync.WaitGroup),
-		queueFactory: queueFactory,
+		handlers:      handlers,
+		wgClosed:      new(sync.WaitGroup),
+		queueFactory:  queueFactory,
+		writerFactory: queueoutputcreator.CreateZipFileWriter,
+		queues:        make(map[string]filequeue.Queue),
+		queuesMutex:   new(sync.Mutex),
+		conflicts:     queueoutputcreator.ConflictFirst,
+		jobs:          newJobTracker(),
+	}
+}
+
+// WithStages restricts the daemon to run only the named handlers. The queues
+// between all stages are still set up, so the other stages can run in other
+// processes sharing the same queue backend.
+func (d *Daemon) WithStages(stages []string) *Daemon {
+	d.stages = stages
+	return d
+}
+
+// AddSource adds a handler that runs next to the first handler and feeds the
+// same queue, e.g. one scan handler per scanner.
+func (d *Daemon) AddSource(handler DaemonHandler) *Daemon {
+	d.sources = append(d.sources, handler)
+	return d
+}
+
+func (d *Daemon) runsStage(name string) bool {
+	return len(d.stages) == 0 || slices.Contains(d.stages, name)
+}
+
+func (d *Daemon) WithWriterFactory(writerFactory WriterFactory) *Daemon {
+	d.writerFactory = writerFactory
+	return d
+}
+
+// WithConflictPolicy sets how conflicting metadata is resolved when a handler
+// combines several files into one.
+func (d *Daemon) WithConflictPolicy(policy queueoutputcreator.ConflictPolicy) *Daemon {
+	if policy != "" {
+		d.conflicts = policy
 	}
+	return d
 }
 
 func (d *Daemon) Start() error {
 	log.Debug("Starting daemon")
 	d.closeRequest = make(chan struct{})
-	d.wgClosed.Add(len(d.handlers))
 
 	log.Debug("Starting handlers")
 	outputQueues := make([]filequeue.Queue, len(d.handlers)-1)
 	for i := 0; i < len(d.handlers)-1; i++ {
-		outputQueues[i] = d.queueFactory(handlerName(d.handlers[i]))
+		outputQueues[i] = d.queue(handlerName(d.handlers[i]))
 	}
 	log.Debugf("Output queues: %v", outputQueues)
 
@@ -64,12 +128,114 @@ func (d *Daemon) Start() error {
 			outputQueue = outputQueues[i]
 		}
 
+		if !d.runsStage(handlerName(handler)) {
+			logrus.WithField("handler", handlerName(handler)).Debug("Stage runs elsewhere, skipping handler")
+			continue
+		}
+
 		logrus.WithField("handler", handlerName(handler)).Debug("Starting handler")
+		d.wgClosed.Add(1)
 		go d.run(handler, inputQueue, outputQueue)
 	}
+
+	for _, source := range d.sources {
+		if !d.runsStage(handlerName(source)) || len(outputQueues) == 0 {
+			continue
+		}
+
+		logrus.WithField("handler", handlerName(source)).Debug("Starting source")
+		d.wgClosed.Add(1)
+		go d.run(source, nil, outputQueues[0])
+	}
+	return nil
+}
+
+// queue returns the shared queue instance for name, so all producers of a
+// queue go through the same instance.
+func (d *Daemon) queue(name string) filequeue.Queue {
+	d.queuesMutex.Lock()
+	defer d.queuesMutex.Unlock()
+
+	if q, ok := d.queues[name]; ok {
+		return q
+	}
+
+	q := d.queueFactory(name)
+	d.queues[name] = q
+	return q
+}
+
+// StageNames returns the handler names in pipeline order.
+func (d *Daemon) StageNames() []string {
+	names := make([]string, len(d.handlers))
+	for i, handler := range d.handlers {
+		names[i] = handlerName(handler)
+	}
+	return names
+}
+
+// InputQueue returns the queue the given stage reads from. The first stage
+// has no input queue.
+func (d *Daemon) InputQueue(stage string) (filequeue.Queue, error) {
+	for i, handler := range d.handlers {
+		if handlerName(handler) != stage {
+			continue
+		}
+		if i == 0 {
+			return nil, fmt.Errorf("stage %s has no input queue", stage)
+		}
+		return d.queue(handlerName(d.handlers[i-1])), nil
+	}
+
+	return nil, fmt.Errorf("unknown stage %s", stage)
+}
+
+// NewWriter creates an empty bundle for Inject.
+func (d *Daemon) NewWriter() queueoutputcreator.QueueZipFileWriter {
+	return d.writerFactory()
+}
+
+// Inject enqueues a bundle that was created outside of the handlers into the
+// input queue of stage. The bundle is discarded if it cannot be enqueued.
+func (d *Daemon) Inject(stage string, outputFiles queueoutputcreator.QueueZipFileWriter) error {
+	inputQueue, err := d.InputQueue(stage)
+	if err == nil {
+		err = inputQueue.Full()
+	}
+	if err != nil {
+		outputFiles.Discard()
+		return err
+	}
+
+	err = enqueueOutput(outputFiles, inputQueue)
+	if err != nil {
+		return err
+	}
+
+	d.jobs.update(outputFiles.Manifest().ID, stage, JobQueued, nil)
 	return nil
 }
 
+// Job returns the status of the job with the given manifest ID.
+func (d *Daemon) Job(id string) (JobStatus, bool) {
+	return d.jobs.get(id)
+}
+
+// nextStage is the name of the handler after handler, empty for the last one.
+// Sources feed the second handler.
+func (d *Daemon) nextStage(handler DaemonHandler) string {
+	next := 1
+	for i, h := range d.handlers {
+		if h == handler {
+			next = i + 1
+		}
+	}
+	if next >= len(d.handlers) {
+		return ""
+	}
+	return handlerName(d.handlers[next])
+}
+
 func (d *Daemon) Stop() error {
 	close(d.closeRequest)
 	d.wgClosed.Wait()
@@ -78,6 +244,7 @@ func (d *Daemon) Stop() error {
 
 func (d *Daemon) run(handler DaemonHandler, inputQueue, outputQueue filequeue.Queue) {
 	handlerLogger := logger.Logger(handler)
+	throttled := false
 
 	for {
 		select {
@@ -90,6 +257,20 @@ func (d *Daemon) run(handler DaemonHandler, inputQueue, outputQueue filequeue.Qu
 			handlerLogger.Debug("Running handler")
 		}
 
+		if outputQueue != nil {
+			if err := outputQueue.Full(); err != nil {
+				if !throttled {
+					handlerLogger.WithError(err).Warn("Output queue is not accepting work, pausing handler")
+					throttled = true
+				}
+				continue
+			}
+			if throttled {
+				handlerLogger.Info("Output queue is accepting work again, resuming handler")
+				throttled = false
+			}
+		}
+
 		var inputFile filequeue.QueueFile
 		if inputQueue != nil {
 			if p, err := inputQueue.Dequeue(); err == nil {
@@ -99,7 +280,6 @@ func (d *Daemon) run(handler DaemonHandler, inputQueue, outputQueue filequeue.Qu
 				}
 				handlerLogger.Debug("Dequeued from inputQueue")
 				inputFile = p
-				defer p.Close()
 			} else {
 				logrus.WithError(err).Error("Failed to dequeue")
 			}
@@ -111,30 +291,54 @@ func (d *Daemon) run(handler DaemonHandler, inputQueue, outputQueue filequeue.Qu
 		}
 
 		d.runHandler(handler, inputFile, outputQueue)
+		if inputFile != nil {
+			inputFile.Close()
+		}
 	}
 }
 
 func (d *Daemon) runHandler(handler DaemonHandler, inputZipFile filequeue.QueueFile, outputQueue filequeue.Queue) {
 	handlerLogger := logger.Logger(handler)
+	stage := handlerName(handler)
 
+	succeeded := false
+	quarantined := false
 	defer func() {
 		if r := recover(); r != nil {
 			handlerLogger.WithField("recover", r).Error("Recovered")
 		}
+
+		if inputZipFile == nil || quarantined {
+			return
+		}
+		if succeeded {
+			inputZipFile.Done()
+		} else {
+			inputZipFile.Nack()
+		}
 	}()
 
+	var zipReader queueoutputcreator.QueueZipFileReader
+	if inputZipFile != nil {
+		var err error
+		zipReader, err = queueoutputcreator.CreateZipFileReader(inputZipFile)
+		if errors.Is(err, queueoutputcreator.ErrCorruptBundle) {
+			handlerLogger.WithError(err).Error("Input bundle is corrupt, quarantining it")
+			inputZipFile.Quarantine(err)
+			quarantined = true
+			return
+		}
+		if err != nil {
+			handlerLogger.WithError(err).Error("Failed to create zip reader")
+			return
+		}
+	}
+
 	inputFiles := make(chan InputFile)
 	go func() {
 		defer close(inputFiles)
-		if inputZipFile != nil {
+		if zipReader != nil {
 			handlerLogger.Debug("Sending inputFile to handler")
-			zipReader, err := queueoutputcreator.CreateZipFileReader(inputZipFile)
-			if err != nil {
-				handlerLogger.WithError(err).Error("Failed to create zip reader")
-				inputFiles <- nil
-				return
-			}
-
 			for _, fileName := range zipReader.FileNames() {
 				f, err := zipReader.GetFile(fileName)
 				if err != nil {
@@ -146,24 +350,96 @@ func (d *Daemon) runHandler(handler DaemonHandler, inputZipFile filequeue.QueueF
 		}
 	}()
 
-	outputFiles := queueoutputcreator.CreateZipFileWriter()
+	outputFiles := d.writerFactory()
+	// outputs that are not enqueued, e.g. of failed or idle runs, leave no
+	// temporary files behind
+	defer outputFiles.Discard()
+	if zipReader != nil {
+		continueManifest(zipReader.Manifest(), outputFiles.Manifest())
+		if inheritsMetadata(handler) {
+			// the output has no files yet, only the bundle properties are
+			// inherited, so the handler sees e.g. the subject of a mail
+			queueoutputcreator.InheritMetadata(zipReader.Manifest(), outputFiles.Manifest(), d.conflicts)
+		}
+		d.jobs.update(outputFiles.Manifest().ID, stage, JobRunning, nil)
+	}
 
+	startedAt := time.Now()
 	err := handler.Run(handlerLogger, inputFiles, outputFiles)
+	// handlers may return before reading all input files
+	for range inputFiles {
+	}
+	outputFiles.Manifest().RecordStage(handlerName(handler), startedAt, time.Now())
+	if zipReader != nil && inheritsMetadata(handler) {
+		// the bundle properties were inherited before the run, the handler
+		// may have changed them
+		conflicts := queueoutputcreator.InheritFileMetadata(zipReader.Manifest(), outputFiles.Manifest(), d.conflicts)
+		for _, conflict := range conflicts {
+			handlerLogger.WithField("policy", d.conflicts).Warn(conflict.String())
+		}
+	}
+	if err == nil {
+		err = outputFiles.Error()
+	}
 	if err != nil {
 		handlerLogger.WithError(err).Error("Failed to run handler")
-	} else if outputFiles.Error() != nil {
-		handlerLogger.WithError(outputFiles.Error()).Error("Failed to run handler")
-	} else {
-		if outputFiles.FileCount() > 0 {
-			outputZipPath, _ := outputFiles.Finalize()
-			handlerLogger.Debugf("Handler %s created %d files", handlerName(handler), outputFiles.FileCount())
-			outputQueue.EnqueueFilePath(outputZipPath)
+		if zipReader != nil {
+			d.jobs.update(outputFiles.Manifest().ID, stage, JobFailed, err)
 		}
+		return
+	}
 
-		if inputZipFile != nil {
-			inputZipFile.Done()
+	if outputFiles.FileCount() > 0 {
+		handlerLogger.Debugf("Handler %s created %d files", handlerName(handler), outputFiles.FileCount())
+		err := enqueueOutput(outputFiles, outputQueue)
+		if err != nil {
+			handlerLogger.WithError(err).Error("Failed to enqueue output, keeping input for retry")
+			d.jobs.update(outputFiles.Manifest().ID, stage, JobFailed, err)
+			return
+		}
+		d.jobs.update(outputFiles.Manifest().ID, d.nextStage(handler), JobQueued, nil)
+	} else if zipReader != nil {
+		d.jobs.update(outputFiles.Manifest().ID, stage, JobDone, nil)
+	}
+
+	succeeded = true
+}
+
+func enqueueOutput(outputFiles queueoutputcreator.QueueZipFileWriter, outputQueue filequeue.Queue) error {
+	if finalizer, ok := outputFiles.(BytesFinalizer); ok {
+		data, err := finalizer.FinalizeBytes()
+		if err != nil {
+			return err
 		}
+		return outputQueue.Enqueue(data)
 	}
+
+	outputZipPath, err := outputFiles.Finalize()
+	if err != nil {
+		return err
+	}
+
+	err = outputQueue.EnqueueFilePath(outputZipPath)
+	if err != nil {
+		os.RemoveAll(outputZipPath)
+		return err
+	}
+	return nil
+}
+
+// continueManifest carries the bundle identity, source and stage history over
+// to the output bundle, so a job can be followed through the whole pipeline
+// and stages see the profile of the bundle.
+func continueManifest(input, output *queueoutputcreator.Manifest) {
+	output.ID = input.ID
+	output.CreatedAt = input.CreatedAt
+	output.Source = input.Source
+	output.History = append(output.History, input.History...)
+}
+
+func inheritsMetadata(handler DaemonHandler) bool {
+	inheritor, ok := handler.(MetadataInheritor)
+	return !ok || inheritor.InheritMetadata()
 }
 
 func handlerName(handler any) string {
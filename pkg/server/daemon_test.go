@@ -0,0 +1,330 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/schidstorm/scanner-tool/pkg/filequeue"
+	queueoutputcreator "github.com/schidstorm/scanner-tool/pkg/queue_output_creator"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+type testSourceHandler struct {
+	once sync.Once
+	tags []string
+}
+
+func (h *testSourceHandler) Run(logger *logrus.Logger, _ chan InputFile, outputFiles queueoutputcreator.QueueZipFileWriter) error {
+	h.once.Do(func() {
+		outputFiles.AddFile("page.txt", []byte("hello"))
+		outputFiles.Manifest().File("page.txt").Tags = h.tags
+		outputFiles.Manifest().Properties.Title = "letter"
+	})
+	return nil
+}
+
+func (h *testSourceHandler) Close() error {
+	return nil
+}
+
+type testUpperHandler struct {
+	failures int
+	isolated bool
+}
+
+func (h *testUpperHandler) InheritMetadata() bool {
+	return !h.isolated
+}
+
+func (h *testUpperHandler) Run(logger *logrus.Logger, input chan InputFile, outputFiles queueoutputcreator.QueueZipFileWriter) error {
+	for f := range input {
+		if h.failures > 0 {
+			h.failures--
+			return errors.New("transient failure")
+		}
+
+		data, err := readInputFile(f)
+		if err != nil {
+			return err
+		}
+		outputFiles.AddFile(f.FileInfo().Name(), []byte(strings.ToUpper(string(data))))
+	}
+	return nil
+}
+
+func (h *testUpperHandler) Close() error {
+	return nil
+}
+
+type testSinkHandler struct {
+	received chan string
+	entries  chan *queueoutputcreator.FileEntry
+}
+
+func (h *testSinkHandler) Run(logger *logrus.Logger, input chan InputFile, outputFiles queueoutputcreator.QueueZipFileWriter) error {
+	for f := range input {
+		data, err := readInputFile(f)
+		if err != nil {
+			return err
+		}
+		if h.entries != nil {
+			h.entries <- f.Entry()
+		}
+		h.received <- string(data)
+	}
+	return nil
+}
+
+func (h *testSinkHandler) Close() error {
+	return nil
+}
+
+func readInputFile(f InputFile) ([]byte, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	return io.ReadAll(rc)
+}
+
+func runMemDaemon(t *testing.T, handlers []DaemonHandler, sources ...DaemonHandler) map[string]*filequeue.MemQueryFileQueue {
+	_, queues := startMemDaemon(t, handlers, sources...)
+	return queues
+}
+
+func startMemDaemon(t *testing.T, handlers []DaemonHandler, sources ...DaemonHandler) (*Daemon, map[string]*filequeue.MemQueryFileQueue) {
+	oldScanWait := daemonScanWait
+	daemonScanWait = 10 * time.Millisecond
+	t.Cleanup(func() { daemonScanWait = oldScanWait })
+
+	queues := make(map[string]*filequeue.MemQueryFileQueue)
+	mutex := new(sync.Mutex)
+	d := NewDaemon(func(name string) filequeue.Queue {
+		mutex.Lock()
+		defer mutex.Unlock()
+		q := &filequeue.MemQueryFileQueue{DequeueWait: 20 * time.Millisecond}
+		queues[name] = q
+		return q
+	}, handlers).WithWriterFactory(func() queueoutputcreator.QueueZipFileWriter {
+		return queueoutputcreator.CreateMemZipFileCreator()
+	})
+	for _, source := range sources {
+		d.AddSource(source)
+	}
+
+	assert.NoError(t, d.Start())
+	t.Cleanup(func() { d.Stop() })
+
+	return d, queues
+}
+
+func TestDaemonPipeline(t *testing.T) {
+	sink := &testSinkHandler{received: make(chan string, 1)}
+	queues := runMemDaemon(t, []DaemonHandler{
+		&testSourceHandler{},
+		&testUpperHandler{},
+		sink,
+	})
+
+	select {
+	case data := <-sink.received:
+		assert.Equal(t, "HELLO", data)
+	case <-time.After(5 * time.Second):
+		t.Fatal("pipeline did not deliver the bundle")
+	}
+
+	assert.Eventually(t, func() bool {
+		return len(queues["testUpperHandler"].Acknowledged()) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Len(t, queues["testSourceHandler"].Acknowledged(), 1)
+	assert.Equal(t, 0, queues["testSourceHandler"].Len())
+}
+
+func TestDaemonRetriesFailedBundles(t *testing.T) {
+	sink := &testSinkHandler{received: make(chan string, 1)}
+	queues := runMemDaemon(t, []DaemonHandler{
+		&testSourceHandler{},
+		&testUpperHandler{failures: 2},
+		sink,
+	})
+
+	select {
+	case data := <-sink.received:
+		assert.Equal(t, "HELLO", data)
+	case <-time.After(5 * time.Second):
+		t.Fatal("pipeline did not deliver the bundle")
+	}
+
+	assert.Len(t, queues["testSourceHandler"].Acknowledged(), 1)
+}
+
+func TestDaemonBackpressure(t *testing.T) {
+	oldScanWait := daemonScanWait
+	daemonScanWait = 10 * time.Millisecond
+	t.Cleanup(func() { daemonScanWait = oldScanWait })
+
+	full := &filequeue.MemQueryFileQueue{Limits: filequeue.Limits{MaxItems: 1}, DequeueWait: 20 * time.Millisecond}
+	full.Enqueue([]byte("occupied"))
+
+	source := &testSourceHandler{}
+	d := NewDaemon(func(name string) filequeue.Queue {
+		return full
+	}, []DaemonHandler{source, &testSinkHandler{}})
+	d.WithStages([]string{"testSourceHandler"})
+	assert.NoError(t, d.Start())
+
+	time.Sleep(100 * time.Millisecond)
+	assert.NoError(t, d.Stop())
+	assert.Equal(t, 1, full.Len())
+}
+
+func TestDaemonInheritsMetadata(t *testing.T) {
+	for _, isolated := range []bool{false, true} {
+		t.Run(fmt.Sprintf("isolated=%v", isolated), func(t *testing.T) {
+			sink := &testSinkHandler{
+				received: make(chan string, 1),
+				entries:  make(chan *queueoutputcreator.FileEntry, 1),
+			}
+			runMemDaemon(t, []DaemonHandler{
+				&testSourceHandler{tags: []string{"invoice"}},
+				&testUpperHandler{isolated: isolated},
+				sink,
+			})
+
+			select {
+			case entry := <-sink.entries:
+				if isolated {
+					assert.Empty(t, entry.Tags)
+				} else {
+					assert.Equal(t, []string{"invoice"}, entry.Tags)
+					assert.Equal(t, []string{"page.txt"}, entry.DerivedFrom)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("pipeline did not deliver the bundle")
+			}
+		})
+	}
+}
+
+func TestDaemonDiscardsUnusedOutput(t *testing.T) {
+	root := useTempWorkspaces(t)
+	oldScanWait := daemonScanWait
+	daemonScanWait = 10 * time.Millisecond
+	t.Cleanup(func() { daemonScanWait = oldScanWait })
+
+	sink := &testSinkHandler{received: make(chan string, 1)}
+	d := NewDaemon(func(name string) filequeue.Queue {
+		return &filequeue.MemQueryFileQueue{DequeueWait: 20 * time.Millisecond}
+	}, []DaemonHandler{
+		&testSourceHandler{},
+		&testUpperHandler{failures: 1},
+		sink,
+	}).WithWriterFactory(queueoutputcreator.CreateZipFileWriter)
+	assert.NoError(t, d.Start())
+
+	select {
+	case <-sink.received:
+	case <-time.After(5 * time.Second):
+		t.Fatal("pipeline did not deliver the bundle")
+	}
+	// the source keeps running without output
+	time.Sleep(50 * time.Millisecond)
+	d.Stop()
+
+	entries, err := os.ReadDir(root)
+	assert.NoError(t, err)
+	for _, entry := range entries {
+		assert.Equal(t, ".lock", filepath.Ext(entry.Name()))
+	}
+}
+
+func TestDaemonQuarantinesCorruptBundles(t *testing.T) {
+	sink := &testSinkHandler{received: make(chan string, 1)}
+	queues := runMemDaemon(t, []DaemonHandler{
+		&testSourceHandler{},
+		&testUpperHandler{},
+		sink,
+	})
+
+	<-sink.received
+	assert.NoError(t, queues["testSourceHandler"].Enqueue([]byte("not a zip file")))
+
+	assert.Eventually(t, func() bool {
+		return len(queues["testSourceHandler"].Quarantined()) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, 0, queues["testSourceHandler"].Len())
+}
+
+func TestHandlerChainInMemory(t *testing.T) {
+	input := queueoutputcreator.CreateMemZipFileCreator()
+	input.AddFile("page1.txt", []byte("one"))
+	input.AddFile("page2.txt", []byte("two"))
+	input.Manifest().File("page2.txt").Tags = []string{"last"}
+
+	output := runHandlerChain(t, input, &testUpperHandler{}, &testUpperHandler{})
+
+	assert.Equal(t, []string{"page1.txt", "page2.txt"}, output.FileNames())
+	assert.Equal(t, "TWO", output.Files()["page2.txt"].String())
+	assert.Equal(t, []string{"last"}, output.Manifest().File("page2.txt").Tags)
+	assert.Equal(t, input.Manifest().ID, output.Manifest().ID)
+}
+
+func TestDaemonSources(t *testing.T) {
+	sink := &testSinkHandler{received: make(chan string, 2), entries: make(chan *queueoutputcreator.FileEntry, 2)}
+	runMemDaemon(t, []DaemonHandler{
+		&testSourceHandler{tags: []string{"first"}},
+		sink,
+	}, &testSourceHandler{tags: []string{"second"}})
+
+	var tags []string
+	for i := 0; i < 2; i++ {
+		select {
+		case <-sink.received:
+			tags = append(tags, (<-sink.entries).Tags...)
+		case <-time.After(5 * time.Second):
+			t.Fatal("pipeline did not deliver the bundles of all sources")
+		}
+	}
+	assert.ElementsMatch(t, []string{"first", "second"}, tags)
+}
+
+func TestDaemonTracksJobs(t *testing.T) {
+	sink := &testSinkHandler{received: make(chan string, 2)}
+	d, _ := startMemDaemon(t, []DaemonHandler{
+		&testSourceHandler{},
+		&testUpperHandler{failures: 1},
+		sink,
+	})
+
+	bundle := d.NewWriter()
+	bundle.AddFile("page.txt", []byte("injected"))
+	id := bundle.Manifest().ID
+	assert.NoError(t, d.Inject("testUpperHandler", bundle))
+
+	job, ok := d.Job(id)
+	assert.True(t, ok)
+	assert.Equal(t, JobQueued, job.State)
+	assert.Equal(t, "testUpperHandler", job.Stage)
+
+	assert.Eventually(t, func() bool {
+		job, _ := d.Job(id)
+		return job.State == JobDone
+	}, 5*time.Second, 10*time.Millisecond)
+	job, _ = d.Job(id)
+	assert.Equal(t, "testSinkHandler", job.Stage)
+	assert.Empty(t, job.Error)
+
+	_, ok = d.Job("unknown")
+	assert.False(t, ok)
+	assert.Error(t, d.Inject("testSourceHandler", d.NewWriter()))
+}
@@ -0,0 +1,182 @@
+package server
+
+import (
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"strings"
+
+	"github.com/schidstorm/scanner-tool/pkg/filequeue"
+	"github.com/schidstorm/scanner-tool/pkg/ingest"
+	"github.com/schidstorm/scanner-tool/pkg/scan"
+)
+
+// maxUploadBytes limits the size of all files of one upload.
+var maxUploadBytes int64 = 200 << 20
+
+// maxUploadMemory is how much of an upload is kept in memory, the rest is
+// buffered in temporary files.
+var maxUploadMemory int64 = 32 << 20
+
+var errBadUpload = errors.New("bad upload")
+
+//go:embed upload.html
+var uploadHtml string
+
+var uploadTemplate = template.Must(template.New("upload").Parse(uploadHtml))
+
+type uploadPage struct {
+	JobID string
+	Error string
+}
+
+func (s *Server) httpHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /api/scan", s.handleScan)
+	mux.HandleFunc("POST /api/upload", s.handleUpload)
+	mux.HandleFunc("GET /api/jobs/{id}", s.handleJob)
+	mux.HandleFunc("GET /api/scanners", s.handleScanners)
+	mux.HandleFunc("GET /metrics", s.handleMetrics)
+	mux.HandleFunc("GET /upload", s.handleUploadForm)
+	mux.HandleFunc("POST /upload", s.handleUploadForm)
+	return mux
+}
+
+// handleScan triggers a scan. The form values device and profile are
+// optional.
+func (s *Server) handleScan(w http.ResponseWriter, r *http.Request) {
+	device := r.FormValue("device")
+	trigger := scan.Trigger{Profile: r.FormValue("profile"), Origin: "api"}
+
+	err := s.TriggerScan(device, trigger)
+	switch {
+	case errors.Is(err, scan.ErrDeviceNotFound):
+		writeJsonError(w, http.StatusNotFound, err)
+	case errors.Is(err, scan.ErrScanPending):
+		writeJsonError(w, http.StatusConflict, err)
+	case err != nil:
+		writeJsonError(w, http.StatusBadRequest, err)
+	default:
+		writeJson(w, http.StatusAccepted, map[string]string{"device": device, "profile": trigger.Profile})
+	}
+}
+
+// handleUpload ingests the uploaded files as one job. Besides the files, the
+// form values title, tags (comma separated) and profile are optional.
+func (s *Server) handleUpload(w http.ResponseWriter, r *http.Request) {
+	id, err := s.ingestUpload(w, r)
+	if err != nil {
+		writeJsonError(w, uploadErrorStatus(err), err)
+		return
+	}
+
+	writeJson(w, http.StatusAccepted, map[string]string{"id": id, "status": "/api/jobs/" + id})
+}
+
+func (s *Server) handleJob(w http.ResponseWriter, r *http.Request) {
+	job, ok := s.daemon.Job(r.PathValue("id"))
+	if !ok {
+		writeJsonError(w, http.StatusNotFound, errors.New("unknown job"))
+		return
+	}
+
+	writeJson(w, http.StatusOK, job)
+}
+
+func (s *Server) handleScanners(w http.ResponseWriter, r *http.Request) {
+	writeJson(w, http.StatusOK, s.ScannerStatus())
+}
+
+func (s *Server) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	writeMetrics(w, s.ScannerStatus())
+}
+
+// handleUploadForm serves a form for phones and shows the job ID after an
+// upload.
+func (s *Server) handleUploadForm(w http.ResponseWriter, r *http.Request) {
+	var page uploadPage
+	if r.Method == http.MethodPost {
+		var err error
+		page.JobID, err = s.ingestUpload(w, r)
+		if err != nil {
+			page.Error = err.Error()
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			w.WriteHeader(uploadErrorStatus(err))
+			uploadTemplate.Execute(w, page)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	uploadTemplate.Execute(w, page)
+}
+
+func (s *Server) ingestUpload(w http.ResponseWriter, r *http.Request) (string, error) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxUploadBytes)
+	err := r.ParseMultipartForm(maxUploadMemory)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", errBadUpload, err)
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	batch := ingest.Batch{
+		Source:  "upload",
+		Profile: r.FormValue("profile"),
+		Title:   r.FormValue("title"),
+		Tags:    splitFormTags(r.FormValue("tags")),
+	}
+	for _, header := range r.MultipartForm.File["files"] {
+		batch.Files = append(batch.Files, uploadedFile(header))
+	}
+	if len(batch.Files) == 0 {
+		return "", fmt.Errorf("%w: no files uploaded", errBadUpload)
+	}
+
+	return s.Ingest(batch)
+}
+
+// uploadedFile is read from the temporary file of the form while the bundle
+// is written, large uploads are not held in memory.
+func uploadedFile(header *multipart.FileHeader) ingest.File {
+	return ingest.File{Name: header.Filename, Open: func() (io.ReadSeekCloser, error) {
+		return header.Open()
+	}}
+}
+
+func uploadErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, errBadUpload), errors.Is(err, ingest.ErrUnsupportedFile), errors.Is(err, ErrUnknownProfile):
+		return http.StatusBadRequest
+	case errors.Is(err, filequeue.ErrQueueFull), errors.Is(err, filequeue.ErrDiskFull):
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+func splitFormTags(value string) []string {
+	var tags []string
+	for _, tag := range strings.Split(value, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+func writeJson(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeJsonError(w http.ResponseWriter, status int, err error) {
+	writeJson(w, status, map[string]string{"error": err.Error()})
+}
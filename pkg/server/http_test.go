@@ -0,0 +1,174 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/schidstorm/scanner-tool/pkg/scan"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHttpTriggerScan(t *testing.T) {
+	scanner := &testScanner{device: "epson2:libusb:001:004"}
+	triggers := scan.NewTriggers(scan.TriggerOptions{}, scanner)
+	s := &Server{scanners: []scan.Scanner{scanner}, triggers: []*scan.Triggers{triggers}}
+	handler := s.httpHandler()
+
+	post := func(values url.Values) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/scan", strings.NewReader(values.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := post(url.Values{"profile": {"receipts"}})
+	assert.Equal(t, http.StatusAccepted, rec.Code)
+	trigger, ok := triggers.Next()
+	assert.True(t, ok)
+	assert.Equal(t, scan.Trigger{Profile: "receipts", Origin: "api"}, trigger)
+
+	rec = post(url.Values{"device": {"epson2:libusb:001:004"}})
+	assert.Equal(t, http.StatusAccepted, rec.Code)
+
+	rec = post(url.Values{"device": {"other"}})
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	assert.Contains(t, rec.Body.String(), "other")
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/scan", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+
+	s.triggers = nil
+	assert.Equal(t, http.StatusBadRequest, post(nil).Code)
+}
+
+func uploadRequest(t *testing.T, target string, fields map[string]string, files map[string][]byte) *http.Request {
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	for key, value := range fields {
+		assert.NoError(t, writer.WriteField(key, value))
+	}
+	for fileName, data := range files {
+		part, err := writer.CreateFormFile("files", fileName)
+		assert.NoError(t, err)
+		part.Write(data)
+	}
+	assert.NoError(t, writer.Close())
+
+	req := httptest.NewRequest(http.MethodPost, target, &body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	return req
+}
+
+func TestHttpUpload(t *testing.T) {
+	d, queues := testIngestDaemon()
+	handler := (&Server{daemon: d}).httpHandler()
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, uploadRequest(t, "/api/upload", map[string]string{
+		"title":   "receipt",
+		"tags":    "phone, food ,",
+		"profile": "receipts",
+	}, map[string][]byte{"photo.png": testPng(t)}))
+	assert.Equal(t, http.StatusAccepted, rec.Code)
+
+	var response map[string]string
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+	id := response["id"]
+	assert.NotEmpty(t, id)
+	assert.Equal(t, "/api/jobs/"+id, response["status"])
+
+	manifest := dequeueManifest(t, queues["ImageMirrorHandler"])
+	if manifest != nil {
+		assert.Equal(t, id, manifest.ID)
+		assert.Equal(t, "upload", manifest.Source.Device)
+		assert.Equal(t, "receipts", manifest.Source.Profile)
+		assert.Equal(t, "receipt", manifest.Properties.Title)
+		assert.Equal(t, []string{"phone", "food"}, manifest.Properties.Tags)
+	}
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/jobs/"+id, nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var job JobStatus
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &job))
+	assert.Equal(t, JobQueued, job.State)
+	assert.Equal(t, "TesseractHandler", job.Stage)
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/jobs/unknown", nil))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestHttpUploadRejectsBadFiles(t *testing.T) {
+	d, _ := testIngestDaemon()
+	handler := (&Server{daemon: d}).httpHandler()
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, uploadRequest(t, "/api/upload", nil, map[string][]byte{"notes.txt": []byte("hi")}))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, uploadRequest(t, "/api/upload", map[string]string{"title": "empty"}, nil))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/upload", strings.NewReader("x")))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestHttpUploadForm(t *testing.T) {
+	d, _ := testIngestDaemon()
+	handler := (&Server{daemon: d}).httpHandler()
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/upload", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `enctype="multipart/form-data"`)
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, uploadRequest(t, "/upload", nil, map[string][]byte{"photo.png": testPng(t)}))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), "/api/jobs/")
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, uploadRequest(t, "/upload", nil, map[string][]byte{"notes.txt": []byte("hi")}))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Contains(t, rec.Body.String(), "unsupported file")
+}
+
+func TestHttpScannerStatus(t *testing.T) {
+	scanner := &testScanner{device: "epson2:libusb:001:004", err: scan.ErrCoverOpen}
+	scanHandler := new(ScanHandler).WithScanner(scanner)
+	s := &Server{scanners: []scan.Scanner{scanner}, scanHandlers: []*ScanHandler{scanHandler}}
+	handler := s.httpHandler()
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/scanners", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"device":"epson2:libusb:001:004"`)
+
+	assert.NoError(t, scanHandler.Run(logrus.New(), nil, nil))
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/scanners", nil))
+	var statuses []ScannerStatus
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &statuses))
+	if assert.Len(t, statuses, 1) {
+		assert.Equal(t, scan.ConditionCoverOpen, statuses[0].Condition)
+		assert.Equal(t, 1, statuses[0].Scans[scan.ConditionCoverOpen])
+	}
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `scanner_tool_scans_total{device="epson2:libusb:001:004",condition="cover_open"} 1`)
+	assert.Contains(t, rec.Body.String(), `scanner_tool_scanner_condition{device="epson2:libusb:001:004",condition="cover_open",action="alert"} 1`)
+}
@@ -2,27 +2,41 @@ package server
 
 import (
 	"image"
+	"image/jpeg"
 	"image/png"
+	"io"
 
 	queueoutputcreator "github.com/schidstorm/scanner-tool/pkg/queue_output_creator"
 	"github.com/sirupsen/logrus"
 )
 
+// jpegQuality is used when mirrored JPEG pages are encoded again.
+var jpegQuality = 90
+
 type ImageMirrorHandler struct {
+	profiles Profiles
+}
+
+// WithProfiles lets profiles turn off the rotation.
+func (i *ImageMirrorHandler) WithProfiles(profiles Profiles) *ImageMirrorHandler {
+	i.profiles = profiles
+	return i
 }
 
 func (i *ImageMirrorHandler) Run(logger *logrus.Logger, input chan InputFile, outputFiles queueoutputcreator.QueueZipFileWriter) (resErr error) {
+	rotate := manifestProfile(i.profiles, outputFiles.Manifest()).rotation() != 0
 	for f := range input {
-		img, err := readImage(f)
-		if err != nil {
-			logger.Errorf("Failed to read image from file %s: %v", f.FileInfo().Name(), err)
-			return err
+		if !rotate {
+			err := copyInputFile(f, f.FileInfo().Name(), outputFiles)
+			if err != nil {
+				return err
+			}
+			continue
 		}
 
-		resultImage := mirrorImage(img)
-		file := outputFiles.OpenFile(f.FileInfo().Name())
-		err = png.Encode(file, resultImage)
+		err := mirrorPage(f, outputFiles.OpenFile(f.FileInfo().Name()))
 		if err != nil {
+			logger.Errorf("Failed to mirror image from file %s: %v", f.FileInfo().Name(), err)
 			return err
 		}
 	}
@@ -30,19 +44,29 @@ func (i *ImageMirrorHandler) Run(logger *logrus.Logger, input chan InputFile, ou
 	return nil
 }
 
-func readImage(f InputFile) (image.Image, error) {
-	rc, err := f.Open()
+// mirrorPage turns a page by 180 degrees. Pages keep their format, e.g.
+// JPEGs of network scanners.
+func mirrorPage(f InputFile, w io.Writer) error {
+	img, format, err := readImage(f)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	defer rc.Close()
 
-	img, err := png.Decode(rc)
+	resultImage := mirrorImage(img)
+	if format == "jpeg" {
+		return jpeg.Encode(w, resultImage, &jpeg.Options{Quality: jpegQuality})
+	}
+	return png.Encode(w, resultImage)
+}
+
+func readImage(f InputFile) (image.Image, string, error) {
+	rc, err := f.Open()
 	if err != nil {
-		return nil, err
+		return nil, "", err
 	}
+	defer rc.Close()
 
-	return img, nil
+	return image.Decode(rc)
 }
 
 func mirrorImage(img image.Image) image.Image {
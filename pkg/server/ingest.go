@@ -0,0 +1,191 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+	"github.com/schidstorm/scanner-tool/pkg/ingest"
+	queueoutputcreator "github.com/schidstorm/scanner-tool/pkg/queue_output_creator"
+)
+
+// pdfTextOperator matches the operators that show text in a content stream.
+var pdfTextOperator = regexp.MustCompile(`[)\]>]\s*T[jJ]\b`)
+
+// ocrImageTypes are the image types extracted from PDFs that tesseract reads.
+var ocrImageTypes = []string{"png", "jpg", "tif"}
+
+// Ingest makes one bundle of the batch and injects it into the pipeline. It
+// returns the ID of the bundle.
+func (s *Server) Ingest(batch ingest.Batch) (string, error) {
+	err := s.options.Profiles.Check(batch.Profile)
+	if err != nil {
+		return "", err
+	}
+
+	return ingestBundle(s.daemon, s.options.Profiles, batch)
+}
+
+func (s *Server) ingest(batch ingest.Batch) error {
+	_, err := s.Ingest(batch)
+	return err
+}
+
+// ingestBundle injects images at OCR. Bundles that only hold searchable PDFs
+// skip ahead to merging.
+func ingestBundle(d *Daemon, profiles Profiles, batch ingest.Batch) (string, error) {
+	if len(batch.Files) == 0 {
+		return "", errors.New("nothing to ingest")
+	}
+
+	outputFiles := d.NewWriter()
+	err := addIngestFiles(batch, outputFiles)
+	if err != nil {
+		outputFiles.Discard()
+		return "", err
+	}
+	profileName, profile := profiles.Select(batch.Profile)
+	applyProfile(outputFiles.Manifest(), profileName, profile)
+
+	stage := "MergeHandler"
+	if len(outputFiles.Manifest().Pages()) > 0 {
+		stage = "TesseractHandler"
+	}
+
+	err = d.Inject(stage, outputFiles)
+	if err != nil {
+		return "", err
+	}
+
+	log.WithField("source", batch.Source).WithField("id", outputFiles.Manifest().ID).WithField("stage", stage).Info("Ingested bundle")
+	return outputFiles.Manifest().ID, nil
+}
+
+func addIngestFiles(batch ingest.Batch, outputFiles queueoutputcreator.QueueZipFileWriter) error {
+	manifest := outputFiles.Manifest()
+	manifest.Source.Device = batch.Source
+	manifest.Source.Profile = batch.Profile
+	manifest.Properties.Title = batch.Title
+	manifest.Properties.Tags = slices.Clone(batch.Tags)
+	manifest.Properties.Correspondent = batch.Correspondent
+	if !batch.Created.IsZero() {
+		manifest.Properties.SetMetadata("created", batch.Created.Format(time.DateOnly))
+	}
+
+	for i, file := range batch.Files {
+		fileName := path.Base(file.Name)
+		if manifest.File(fileName) != nil {
+			fileName = fmt.Sprintf("%03d-%s", i+1, fileName)
+		}
+
+		err := addIngestFile(fileName, file, outputFiles)
+		if err != nil {
+			return err
+		}
+	}
+
+	return outputFiles.Error()
+}
+
+func addIngestFile(fileName string, file ingest.File, outputFiles queueoutputcreator.QueueZipFileWriter) error {
+	ext := strings.ToLower(path.Ext(fileName))
+	switch ext {
+	case ".png", ".jpg", ".jpeg", ".tif", ".tiff", ".pdf":
+	default:
+		return fmt.Errorf("%w: %s: type %q", ingest.ErrUnsupportedFile, file.Name, ext)
+	}
+
+	r, err := file.Open()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	if ext != ".pdf" {
+		return outputFiles.AddFileReader(fileName, r).Error()
+	}
+	err = addIngestPdf(fileName, r, outputFiles)
+	if err != nil {
+		return fmt.Errorf("%w: %s: %v", ingest.ErrUnsupportedFile, file.Name, err)
+	}
+	return outputFiles.Error()
+}
+
+// addIngestPdf adds searchable PDFs as documents. The page images of scanned
+// PDFs are added as pages, so they get OCR.
+func addIngestPdf(fileName string, r io.ReadSeeker, outputFiles queueoutputcreator.QueueZipFileWriter) error {
+	hasText, images, err := inspectPdf(r)
+	if err != nil {
+		return err
+	}
+
+	if hasText || images == nil {
+		_, err = r.Seek(0, io.SeekStart)
+		if err != nil {
+			return err
+		}
+		outputFiles.AddFileReader(fileName, r)
+		return nil
+	}
+
+	stem := strings.TrimSuffix(fileName, path.Ext(fileName))
+	for i, image := range images {
+		outputFiles.AddFileReader(fmt.Sprintf("%s-p%03d.%s", stem, i+1, image.FileType), image)
+	}
+	return nil
+}
+
+// inspectPdf tells whether a PDF has text and returns one image per page if
+// every page is a single image of a type tesseract reads.
+func inspectPdf(r io.ReadSeeker) (bool, []model.Image, error) {
+	conf := model.NewDefaultConfiguration()
+	conf.Cmd = model.EXTRACTIMAGES
+	ctx, err := api.ReadValidateAndOptimize(r, conf)
+	if err != nil {
+		return false, nil, err
+	}
+
+	var images []model.Image
+	imagesUsable := true
+	for pageNr := 1; pageNr <= ctx.PageCount; pageNr++ {
+		content, err := pdfcpu.ExtractPageContent(ctx, pageNr)
+		if err != nil {
+			return false, nil, err
+		}
+		if content != nil {
+			stream, err := io.ReadAll(content)
+			if err != nil {
+				return false, nil, err
+			}
+			if pdfTextOperator.Match(stream) {
+				return true, nil, nil
+			}
+		}
+
+		if !imagesUsable {
+			continue
+		}
+		pageImages, err := pdfcpu.ExtractPageImages(ctx, pageNr, false)
+		if err != nil {
+			return false, nil, err
+		}
+		imagesUsable = len(pageImages) == 1
+		for _, image := range pageImages {
+			imagesUsable = imagesUsable && slices.Contains(ocrImageTypes, image.FileType)
+			images = append(images, image)
+		}
+	}
+
+	if !imagesUsable {
+		return false, nil, nil
+	}
+	return false, images, nil
+}
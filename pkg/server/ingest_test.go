@@ -0,0 +1,178 @@
+package server
+
+import (
+	"bytes"
+	"encoding/base64"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"github.com/schidstorm/scanner-tool/pkg/filequeue"
+	"github.com/schidstorm/scanner-tool/pkg/ingest"
+	queueoutputcreator "github.com/schidstorm/scanner-tool/pkg/queue_output_creator"
+	"github.com/stretchr/testify/assert"
+)
+
+func testPng(t *testing.T) []byte {
+	img := image.NewGray(image.Rect(0, 0, 20, 30))
+	img.Set(5, 5, color.White)
+	var buf bytes.Buffer
+	assert.NoError(t, png.Encode(&buf, img))
+	return buf.Bytes()
+}
+
+func testImagePdf(t *testing.T, pages int) []byte {
+	var images []io.Reader
+	for i := 0; i < pages; i++ {
+		images = append(images, bytes.NewReader(testPng(t)))
+	}
+	var buf bytes.Buffer
+	assert.NoError(t, api.ImportImages(nil, &buf, images, nil, nil))
+	return buf.Bytes()
+}
+
+func testIngestDaemon() (*Daemon, map[string]*filequeue.MemQueryFileQueue) {
+	queues := make(map[string]*filequeue.MemQueryFileQueue)
+	mutex := new(sync.Mutex)
+	d := NewDaemon(func(name string) filequeue.Queue {
+		mutex.Lock()
+		defer mutex.Unlock()
+		queues[name] = &filequeue.MemQueryFileQueue{}
+		return queues[name]
+	}, []DaemonHandler{
+		new(ScanHandler),
+		new(ImageMirrorHandler),
+		new(TesseractHandler),
+		new(MergeHandler),
+	}).WithWriterFactory(func() queueoutputcreator.QueueZipFileWriter {
+		return queueoutputcreator.CreateMemZipFileCreator()
+	})
+	return d, queues
+}
+
+func dequeueManifest(t *testing.T, queue *filequeue.MemQueryFileQueue) *queueoutputcreator.Manifest {
+	if !assert.NotNil(t, queue) || !assert.Equal(t, 1, queue.Len()) {
+		return nil
+	}
+	file, err := queue.Dequeue()
+	assert.NoError(t, err)
+	reader, err := queueoutputcreator.CreateZipFileReader(file)
+	assert.NoError(t, err)
+	return reader.Manifest()
+}
+
+func TestInspectPdf(t *testing.T) {
+	textPdf, _ := base64.StdEncoding.DecodeString(testTextPdf)
+	hasText, images, err := inspectPdf(bytes.NewReader(textPdf))
+	assert.NoError(t, err)
+	assert.True(t, hasText)
+	assert.Nil(t, images)
+
+	hasText, images, err = inspectPdf(bytes.NewReader(testImagePdf(t, 2)))
+	assert.NoError(t, err)
+	assert.False(t, hasText)
+	if assert.Len(t, images, 2) {
+		assert.Equal(t, "png", images[0].FileType)
+	}
+
+	_, _, err = inspectPdf(bytes.NewReader([]byte("no pdf")))
+	assert.Error(t, err)
+}
+
+func TestIngestImagesGoToOcr(t *testing.T) {
+	d, queues := testIngestDaemon()
+	textPdf, _ := base64.StdEncoding.DecodeString(testTextPdf)
+
+	id, err := ingestBundle(d, nil, ingest.Batch{
+		Source:        "watch:inbox",
+		Profile:       "receipts",
+		Title:         "receipt",
+		Tags:          []string{"phone"},
+		Correspondent: "Acme",
+		Created:       time.Date(2026, 10, 5, 10, 0, 0, 0, time.UTC),
+		Files: []ingest.File{
+			ingest.DataFile("photo.png", testPng(t)),
+			ingest.DataFile("scanned.pdf", testImagePdf(t, 2)),
+			ingest.DataFile("letter.pdf", textPdf),
+		},
+	})
+	assert.NoError(t, err)
+
+	manifest := dequeueManifest(t, queues["ImageMirrorHandler"])
+	if manifest == nil {
+		return
+	}
+	assert.Equal(t, id, manifest.ID)
+	assert.Equal(t, "watch:inbox", manifest.Source.Device)
+	assert.Equal(t, "receipts", manifest.Source.Profile)
+	assert.Equal(t, "receipt", manifest.Properties.Title)
+	assert.Equal(t, []string{"phone"}, manifest.Properties.Tags)
+	assert.Equal(t, "Acme", manifest.Properties.Correspondent)
+	assert.Equal(t, "2026-10-05", manifest.Properties.Extra["created"])
+	assert.Equal(t, []string{"photo.png", "scanned-p001.png", "scanned-p002.png", "letter.pdf"}, manifest.FileNames())
+	assert.Equal(t, queueoutputcreator.KindDocument, manifest.File("letter.pdf").Kind)
+}
+
+func TestIngestSearchablePdfSkipsOcr(t *testing.T) {
+	d, queues := testIngestDaemon()
+	textPdf, _ := base64.StdEncoding.DecodeString(testTextPdf)
+
+	_, err := ingestBundle(d, nil, ingest.Batch{Files: []ingest.File{ingest.DataFile("letter.pdf", textPdf)}})
+	assert.NoError(t, err)
+
+	manifest := dequeueManifest(t, queues["TesseractHandler"])
+	if manifest != nil {
+		assert.Equal(t, []string{"letter.pdf"}, manifest.FileNames())
+	}
+}
+
+func TestIngestRejectsUnknownFiles(t *testing.T) {
+	d, _ := testIngestDaemon()
+
+	_, err := ingestBundle(d, nil, ingest.Batch{Files: []ingest.File{ingest.DataFile("notes.txt", []byte("hi"))}})
+	assert.Error(t, err)
+
+	_, err = ingestBundle(d, nil, ingest.Batch{})
+	assert.Error(t, err)
+}
+
+func TestIngestDiscardsRejectedBundles(t *testing.T) {
+	root := useTempWorkspaces(t)
+	d, _ := testIngestDaemon()
+	d.WithWriterFactory(func() queueoutputcreator.QueueZipFileWriter {
+		return queueoutputcreator.CreateZipFileWriter()
+	})
+
+	_, err := ingestBundle(d, nil, ingest.Batch{Files: []ingest.File{
+		ingest.DataFile("photo.png", testPng(t)),
+		ingest.DataFile("notes.txt", []byte("hi")),
+	}})
+	assert.ErrorIs(t, err, ingest.ErrUnsupportedFile)
+
+	entries, err := os.ReadDir(root)
+	assert.NoError(t, err)
+	for _, entry := range entries {
+		assert.Equal(t, ".lock", filepath.Ext(entry.Name()))
+	}
+}
+
+func TestTesseractHandlerPassesDocumentsThrough(t *testing.T) {
+	textPdf, _ := base64.StdEncoding.DecodeString(testTextPdf)
+	result := prepareHandlerThings(t, map[string][]byte{"letter.pdf": textPdf}, func(input chan InputFile, outputFiles queueoutputcreator.QueueZipFileWriter) error {
+		return new(TesseractHandler).Run(nil, input, outputFiles)
+	})
+
+	assert.Equal(t, textPdf, result["letter.pdf"])
+}
+
+func TestPdfFileName(t *testing.T) {
+	assert.Equal(t, "scan-001.pdf", pdfFileName("scan-001.png"))
+	assert.Equal(t, "photo.pdf", pdfFileName("photo.jpg"))
+}
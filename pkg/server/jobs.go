@@ -0,0 +1,83 @@
+package server
+
+import (
+	"sync"
+	"time"
+)
+
+// jobRetention is how long jobs can be looked up after their last update.
+var jobRetention = 24 * time.Hour
+
+const (
+	JobQueued  = "queued"
+	JobRunning = "running"
+	JobFailed  = "failed"
+	JobDone    = "done"
+)
+
+// JobStatus tells where a bundle is in the pipeline. A job is identified by
+// the manifest ID of its bundle.
+type JobStatus struct {
+	ID string `json:"id"`
+	// Stage is the handler that runs or will run the job next.
+	Stage     string    `json:"stage,omitempty"`
+	State     string    `json:"state"`
+	Error     string    `json:"error,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// jobTracker remembers the state of the jobs this process has seen. Stages
+// running in other processes are not reflected.
+type jobTracker struct {
+	mutex sync.Mutex
+	jobs  map[string]*JobStatus
+}
+
+func newJobTracker() *jobTracker {
+	return &jobTracker{jobs: make(map[string]*JobStatus)}
+}
+
+func (t *jobTracker) update(id, stage, state string, err error) {
+	if id == "" {
+		return
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	now := time.Now().UTC()
+	job, ok := t.jobs[id]
+	if !ok {
+		job = &JobStatus{ID: id, CreatedAt: now}
+		t.jobs[id] = job
+	}
+	job.Stage = stage
+	job.State = state
+	job.Error = ""
+	if err != nil {
+		job.Error = err.Error()
+	}
+	job.UpdatedAt = now
+
+	t.prune(now)
+}
+
+func (t *jobTracker) prune(now time.Time) {
+	for id, job := range t.jobs {
+		if now.Sub(job.UpdatedAt) > jobRetention {
+			delete(t.jobs, id)
+		}
+	}
+}
+
+func (t *jobTracker) get(id string) (JobStatus, bool) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	job, ok := t.jobs[id]
+	if !ok {
+		return JobStatus{}, false
+	}
+	return *job, true
+}
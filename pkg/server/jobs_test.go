@@ -0,0 +1,45 @@
+package server
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJobTracker(t *testing.T) {
+	tracker := newJobTracker()
+	tracker.update("job", "TesseractHandler", JobFailed, errors.New("tesseract missing"))
+
+	job, ok := tracker.get("job")
+	assert.True(t, ok)
+	assert.Equal(t, JobFailed, job.State)
+	assert.Equal(t, "tesseract missing", job.Error)
+	createdAt := job.CreatedAt
+
+	tracker.update("job", "MergeHandler", JobQueued, nil)
+	job, _ = tracker.get("job")
+	assert.Equal(t, "MergeHandler", job.Stage)
+	assert.Empty(t, job.Error)
+	assert.Equal(t, createdAt, job.CreatedAt)
+
+	tracker.update("", "MergeHandler", JobQueued, nil)
+	assert.Len(t, tracker.jobs, 1)
+}
+
+func TestJobTrackerPrunesOldJobs(t *testing.T) {
+	oldRetention := jobRetention
+	jobRetention = time.Millisecond
+	t.Cleanup(func() { jobRetention = oldRetention })
+
+	tracker := newJobTracker()
+	tracker.update("old", "PaperlessUploadHandler", JobDone, nil)
+	time.Sleep(5 * time.Millisecond)
+	tracker.update("new", "ScanHandler", JobQueued, nil)
+
+	_, ok := tracker.get("old")
+	assert.False(t, ok)
+	_, ok = tracker.get("new")
+	assert.True(t, ok)
+}
@@ -1,16 +1,14 @@
 package server
 
 import (
-	"fmt"
 	"io"
 	"os"
 	"path"
-	"sort"
-	"time"
 
 	"github.com/pdfcpu/pdfcpu/pkg/api"
 	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
 	queueoutputcreator "github.com/schidstorm/scanner-tool/pkg/queue_output_creator"
+	"github.com/schidstorm/scanner-tool/pkg/workspace"
 	"github.com/sirupsen/logrus"
 )
 
@@ -18,63 +16,54 @@ type MergeHandler struct {
 }
 
 func (m *MergeHandler) Run(logger *logrus.Logger, input chan InputFile, outputFiles queueoutputcreator.QueueZipFileWriter) (resErr error) {
-	var tmpFiles []string
-	defer func() {
-		for _, tmpFile := range tmpFiles {
-			os.Remove(tmpFile)
-		}
-	}()
-
-	tmpDir, err := os.MkdirTemp("", "scanner-tool-*")
+	// a bundle that fails to merge is retried, it keeps one workspace
+	ws, err := workspace.Reuse("merge", outputFiles.Manifest().ID)
 	if err != nil {
 		return err
 	}
-	defer os.RemoveAll(tmpDir)
+	defer keepOnError(logger, ws, &resErr)
 
-	tmpFiles, err = unpackAllFilesInZip(input, tmpDir)
+	// the merged file is named apart from the unpacked pages
+	unpackDir := ws.Path("pages")
+	err = os.Mkdir(unpackDir, 0700)
 	if err != nil {
 		return err
 	}
 
-	tmpMergedFileName := fmt.Sprintf("%d_%d.pdf", time.Now().Unix(), time.Now().Nanosecond())
-	tmpMergedFilePath := path.Join(os.TempDir(), tmpMergedFileName)
-	defer os.Remove(tmpMergedFilePath)
+	tmpFiles, err := unpackAllFilesInZip(input, unpackDir)
+	if err != nil {
+		return err
+	}
 
+	tmpMergedFilePath := ws.Path("merged.pdf")
 	err = api.MergeCreateFile(tmpFiles, tmpMergedFilePath, false, model.NewDefaultConfiguration())
 	if err != nil {
 		return err
 	}
 
-	zipBytes, err := os.ReadFile(tmpMergedFilePath)
+	mergedFile, err := os.Open(tmpMergedFilePath)
 	if err != nil {
 		return err
 	}
+	defer mergedFile.Close()
 
-	outputFiles.AddFile("out.pdf", zipBytes)
-
-	return nil
+	return outputFiles.AddFileReader("out.pdf", mergedFile).Error()
 }
 
+// unpackAllFilesInZip keeps the order of the input files, which is the page
+// order of the bundle. Files of unencrypted directory bundles are used in
+// place, everything else is copied to destDir.
 func unpackAllFilesInZip(files chan InputFile, destDir string) ([]string, error) {
 	var tmpFiles []string
 	var loopErr error
 	for f := range files {
-		fileHandle, err := f.Open()
-		if err != nil {
-			loopErr = err
-			break
+		if local, ok := f.(interface{ Path() string }); ok && local.Path() != "" {
+			tmpFiles = append(tmpFiles, local.Path())
+			continue
 		}
-		defer fileHandle.Close()
 
 		tmpFilePath := path.Join(destDir, f.FileInfo().Name())
-		tmpFile, err := os.Create(tmpFilePath)
-		if err != nil {
-			loopErr = err
-			break
-		}
-		defer tmpFile.Close()
-
-		_, err = io.Copy(tmpFile, fileHandle)
+		err := unpackFile(f, tmpFilePath)
 		if err != nil {
 			loopErr = err
 			break
@@ -84,17 +73,31 @@ func unpackAllFilesInZip(files chan InputFile, destDir string) ([]string, error)
 	}
 
 	if loopErr != nil {
-		for _, tmpFile := range tmpFiles {
-			os.Remove(tmpFile)
-		}
 		return nil, loopErr
 	}
 
-	sort.Strings(tmpFiles)
-
 	return tmpFiles, nil
 }
 
+func unpackFile(f InputFile, filePath string) error {
+	fileHandle, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer fileHandle.Close()
+
+	tmpFile, err := os.Create(filePath)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(tmpFile, fileHandle)
+	if closeErr := tmpFile.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
 func (m *MergeHandler) Close() error {
 	return nil
 }
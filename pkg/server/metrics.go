@@ -0,0 +1,41 @@
+package server
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+
+	"github.com/schidstorm/scanner-tool/pkg/scan"
+)
+
+// writeMetrics writes the scanner status in the Prometheus text format.
+func writeMetrics(w io.Writer, statuses []ScannerStatus) {
+	fmt.Fprintln(w, "# HELP scanner_tool_scans_total Scans by device and condition.")
+	fmt.Fprintln(w, "# TYPE scanner_tool_scans_total counter")
+	for _, status := range statuses {
+		conditions := make([]scan.Condition, 0, len(status.Scans))
+		for condition := range status.Scans {
+			conditions = append(conditions, condition)
+		}
+		slices.Sort(conditions)
+		for _, condition := range conditions {
+			fmt.Fprintf(w, "scanner_tool_scans_total{device=%s,condition=%s} %d\n", strconv.Quote(status.Device), strconv.Quote(string(condition)), status.Scans[condition])
+		}
+	}
+
+	fmt.Fprintln(w, "# HELP scanner_tool_scanned_pages_total Pages scanned by device.")
+	fmt.Fprintln(w, "# TYPE scanner_tool_scanned_pages_total counter")
+	for _, status := range statuses {
+		fmt.Fprintf(w, "scanner_tool_scanned_pages_total{device=%s} %d\n", strconv.Quote(status.Device), status.Pages)
+	}
+
+	fmt.Fprintln(w, "# HELP scanner_tool_scanner_condition Condition of the scanner after its last scan.")
+	fmt.Fprintln(w, "# TYPE scanner_tool_scanner_condition gauge")
+	for _, status := range statuses {
+		if status.Condition == "" {
+			continue
+		}
+		fmt.Fprintf(w, "scanner_tool_scanner_condition{device=%s,condition=%s,action=%s} 1\n", strconv.Quote(status.Device), strconv.Quote(string(status.Condition)), strconv.Quote(string(status.Condition.Action())))
+	}
+}
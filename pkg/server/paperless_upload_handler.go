@@ -1,11 +1,18 @@
 package server
 
 import (
-	"bytes"
+	"cmp"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"io"
+	"os"
+	"path"
+	"path/filepath"
 	"slices"
 	"sort"
 	"strings"
+	"time"
 
 	"github.com/schidstorm/scanner-tool/pkg/paperless"
 	queueoutputcreator "github.com/schidstorm/scanner-tool/pkg/queue_output_creator"
@@ -14,6 +21,7 @@ import (
 
 type PaperlessUploadHandler struct {
 	paperless *paperless.Paperless
+	profiles  Profiles
 }
 
 func (u *PaperlessUploadHandler) WithPaperless(paperless *paperless.Paperless) *PaperlessUploadHandler {
@@ -21,45 +29,136 @@ func (u *PaperlessUploadHandler) WithPaperless(paperless *paperless.Paperless) *
 	return u
 }
 
+// WithProfiles adds the profile tags to uploads and sends documents to the
+// sinks of their profile.
+func (u *PaperlessUploadHandler) WithProfiles(profiles Profiles) *PaperlessUploadHandler {
+	u.profiles = profiles
+	return u
+}
+
 func (u *PaperlessUploadHandler) Run(logger *logrus.Logger, input chan InputFile, outputFiles queueoutputcreator.QueueZipFileWriter) (resErr error) {
+	manifest := outputFiles.Manifest()
+	profile := manifestProfile(u.profiles, manifest)
 	for f := range input {
-		rc, err := f.Open()
-		if err != nil {
-			logrus.Errorf("Failed to open file %s: %v", f.FileInfo().Name(), err)
-			return err
-		}
-		defer rc.Close()
+		entry := f.Entry()
+		for _, sink := range profile.sinks() {
+			if dir, ok := strings.CutPrefix(sink, SinkDirPrefix); ok {
+				filePath, err := copyToDir(f, dir, manifest.ID)
+				if err != nil {
+					logger.WithError(err).WithField("dir", dir).Error("Failed to copy document")
+					return err
+				}
 
-		pdfData, err := io.ReadAll(rc)
-		if err != nil {
-			logrus.Errorf("Failed to read file: %v", err)
-			return err
-		}
+				logger.WithField("file", entry.Name).WithField("path", filePath).Info("Copied document")
+				continue
+			}
 
-		fileReader := bytes.NewReader(pdfData)
-		tags := strings.Split(f.Metadata()["tags"], ",")
-		tags = mapT(tags, strings.TrimSpace)
-		tags = mapT(tags, strings.ToLower)
-		sort.Strings(tags)
-		tags = slices.Compact(tags)
-		tags = filterT(tags, func(tag string) bool {
-			return tag != ""
-		})
-
-		err = u.paperless.Upload(fileReader, paperless.UploadOptions{
-			Title: f.FileInfo().Name(),
-			Tags:  tags,
-		})
-
-		if err != nil {
-			logrus.Errorf("Failed to upload file to Paperless: %v", err)
-			return err
+			err := u.upload(f, manifest.Properties, profile.Tags)
+			if err != nil {
+				logrus.Errorf("Failed to upload file to Paperless: %v", err)
+				return err
+			}
+
+			logger.WithFields(logrus.Fields{
+				"file":   entry.Name,
+				"sha256": entry.SHA256,
+				"size":   entry.Size,
+			}).Info("Uploaded document to Paperless")
 		}
 	}
 
 	return nil
 }
 
+// copyToDir keeps the file name unless another document has it already.
+// Copies left by a failed earlier run are recognized by their checksum.
+func copyToDir(f InputFile, dir, bundleID string) (string, error) {
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return "", err
+	}
+
+	fileName := f.FileInfo().Name()
+	filePath := filepath.Join(dir, fileName)
+	if _, err := os.Stat(filePath); err == nil && bundleID != "" {
+		if sameChecksum(filePath, f.Entry().SHA256) {
+			return filePath, nil
+		}
+		ext := path.Ext(fileName)
+		filePath = filepath.Join(dir, strings.TrimSuffix(fileName, ext)+"-"+bundleID+ext)
+	}
+
+	rc, err := f.Open()
+	if err != nil {
+		return "", err
+	}
+	defer rc.Close()
+
+	tmp, err := os.CreateTemp(dir, ".copy-*")
+	if err != nil {
+		return "", err
+	}
+	_, err = io.Copy(tmp, rc)
+	err = errors.Join(err, tmp.Close())
+	if err == nil {
+		err = os.Rename(tmp.Name(), filePath)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return "", err
+	}
+	return filePath, nil
+}
+
+func sameChecksum(filePath, sum string) bool {
+	if sum == "" {
+		return false
+	}
+
+	f, err := os.Open(filePath)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	_, err = io.Copy(h, f)
+	return err == nil && hex.EncodeToString(h.Sum(nil)) == sum
+}
+
+// upload sends the properties of the document. Those of the bundle fill in
+// what the document lacks, e.g. the subject and sender of an ingested mail.
+func (u *PaperlessUploadHandler) upload(f InputFile, bundle queueoutputcreator.Properties, profileTags []string) error {
+	rc, err := f.Open()
+	if err != nil {
+		logrus.Errorf("Failed to open file %s: %v", f.FileInfo().Name(), err)
+		return err
+	}
+	defer rc.Close()
+
+	entry := f.Entry()
+	tags := mapT(slices.Concat(entry.Tags, bundle.Tags, profileTags), strings.TrimSpace)
+	tags = mapT(tags, strings.ToLower)
+	sort.Strings(tags)
+	tags = slices.Compact(tags)
+	tags = filterT(tags, func(tag string) bool {
+		return tag != ""
+	})
+
+	options := paperless.UploadOptions{
+		Title: cmp.Or(entry.Title, bundle.Title, f.FileInfo().Name()),
+		Tags:  tags,
+	}
+	if correspondent := cmp.Or(entry.Correspondent, bundle.Correspondent); correspondent != "" {
+		options.Correspondent = &correspondent
+	}
+	if created, err := time.Parse(time.DateOnly, cmp.Or(entry.Extra["created"], bundle.Extra["created"])); err == nil {
+		options.Created = &created
+	}
+
+	return u.paperless.Upload(rc, options)
+}
+
 func mapT[T any](input []T, mapper func(T) T) []T {
 	result := make([]T, len(input))
 	for i, v := range input {
@@ -0,0 +1,217 @@
+package server
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/emersion/go-imap/backend/memory"
+	"github.com/emersion/go-imap/client"
+	imapserver "github.com/emersion/go-imap/server"
+	"github.com/schidstorm/scanner-tool/pkg/filequeue"
+	"github.com/schidstorm/scanner-tool/pkg/ingest"
+	"github.com/schidstorm/scanner-tool/pkg/paperless"
+	queueoutputcreator "github.com/schidstorm/scanner-tool/pkg/queue_output_creator"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakePaperless records the form fields of uploaded documents. Tags and
+// correspondents are created on demand, their ID is their 1-based index.
+type fakePaperless struct {
+	*httptest.Server
+	mutex   sync.Mutex
+	uploads []url.Values
+	objects map[string][]string
+}
+
+func startFakePaperless(t *testing.T) *fakePaperless {
+	f := &fakePaperless{objects: make(map[string][]string)}
+	f.Server = httptest.NewServer(http.HandlerFunc(f.serve))
+	t.Cleanup(f.Close)
+	return f
+}
+
+func (f *fakePaperless) serve(w http.ResponseWriter, r *http.Request) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if r.URL.Path == "/api/documents/post_document/" {
+		err := r.ParseMultipartForm(1 << 20)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		f.uploads = append(f.uploads, url.Values(r.MultipartForm.Value))
+		return
+	}
+
+	if r.Method == http.MethodPost {
+		var object struct{ Name string }
+		json.NewDecoder(r.Body).Decode(&object)
+		f.objects[r.URL.Path] = append(f.objects[r.URL.Path], object.Name)
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprintf(w, `{"id": %d, "name": %q}`, len(f.objects[r.URL.Path]), object.Name)
+		return
+	}
+
+	var results []map[string]any
+	for i, name := range f.objects[r.URL.Path] {
+		if filter := r.URL.Query().Get("name__iexact"); filter == "" || strings.EqualFold(filter, name) {
+			results = append(results, map[string]any{"id": i + 1, "name": name})
+		}
+	}
+	json.NewEncoder(w).Encode(map[string]any{"count": len(results), "results": results})
+}
+
+func (f *fakePaperless) received() []url.Values {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return append([]url.Values(nil), f.uploads...)
+}
+
+// names resolves the IDs of an upload field.
+func (f *fakePaperless) names(path string, ids []string) []string {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	var names []string
+	for _, id := range ids {
+		i, _ := strconv.Atoi(id)
+		if i > 0 && i <= len(f.objects[path]) {
+			names = append(names, f.objects[path][i-1])
+		}
+	}
+	return names
+}
+
+func startTestImap(t *testing.T) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+
+	s := imapserver.New(memory.New())
+	s.AllowInsecureAuth = true
+	go s.Serve(listener)
+	t.Cleanup(func() { s.Close() })
+	return listener.Addr().String()
+}
+
+func appendTestMail(t *testing.T, addr string, attachment []byte) {
+	var mail bytes.Buffer
+	mail.WriteString("From: Acme Billing <billing@acme.example>\r\n")
+	mail.WriteString("Subject: Invoice 42\r\n")
+	mail.WriteString("Date: Mon, 05 Oct 2026 10:00:00 +0000\r\n")
+	mail.WriteString("MIME-Version: 1.0\r\n")
+	mail.WriteString("Content-Type: multipart/mixed; boundary=BOUNDARY\r\n\r\n")
+	mail.WriteString("--BOUNDARY\r\nContent-Type: text/plain\r\n\r\nPlease find attached.\r\n")
+	mail.WriteString("--BOUNDARY\r\nContent-Type: application/pdf\r\n")
+	mail.WriteString("Content-Disposition: attachment; filename=\"invoice.pdf\"\r\n")
+	mail.WriteString("Content-Transfer-Encoding: base64\r\n\r\n")
+	mail.WriteString(base64.StdEncoding.EncodeToString(attachment) + "\r\n")
+	mail.WriteString("--BOUNDARY--\r\n")
+
+	c, err := client.Dial(addr)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer c.Logout()
+	assert.NoError(t, c.Login("username", "password"))
+	assert.NoError(t, c.Append("INBOX", nil, time.Now(), &mail))
+}
+
+func TestMailReachesPaperless(t *testing.T) {
+	useTempWorkspaces(t)
+	oldScanWait := daemonScanWait
+	daemonScanWait = 10 * time.Millisecond
+	t.Cleanup(func() { daemonScanWait = oldScanWait })
+
+	fake := startFakePaperless(t)
+	d := NewDaemon(func(name string) filequeue.Queue {
+		return &filequeue.MemQueryFileQueue{DequeueWait: 20 * time.Millisecond}
+	}, []DaemonHandler{
+		new(ScanHandler),
+		new(ImageMirrorHandler),
+		new(TesseractHandler),
+		new(MergeHandler),
+		new(PaperlessUploadHandler).WithPaperless(paperless.NewPaperless(fake.URL, "token")),
+	}).WithWriterFactory(func() queueoutputcreator.QueueZipFileWriter {
+		return queueoutputcreator.CreateMemZipFileCreator()
+	}).WithStages([]string{"MergeHandler", "PaperlessUploadHandler"})
+	assert.NoError(t, d.Start())
+	t.Cleanup(func() { d.Stop() })
+
+	addr := startTestImap(t)
+	textPdf, _ := base64.StdEncoding.DecodeString(testTextPdf)
+	appendTestMail(t, addr, textPdf)
+	mailbox := ingest.NewMailbox(ingest.MailboxOptions{Addr: addr, Security: ingest.SecurityNone, Username: "username", Password: "password", Tags: []string{"mail"}}, func(batch ingest.Batch) error {
+		_, err := ingestBundle(d, nil, batch)
+		return err
+	})
+	assert.NoError(t, mailbox.Poll())
+
+	assert.Eventually(t, func() bool {
+		return len(fake.received()) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+	uploads := fake.received()
+	if len(uploads) != 1 {
+		return
+	}
+	upload := uploads[0]
+	assert.Equal(t, "Invoice 42", upload.Get("title"))
+	assert.True(t, strings.HasPrefix(upload.Get("created"), "2026-10-05"), upload.Get("created"))
+	assert.Equal(t, []string{"Acme Billing"}, fake.names("/api/correspondents/", upload["correspondent"]))
+	assert.Equal(t, []string{"mail"}, fake.names("/api/tags/", upload["tags"]))
+}
+
+func TestUploadPrefersDocumentProperties(t *testing.T) {
+	fake := startFakePaperless(t)
+	input := queueoutputcreator.CreateMemZipFileCreator()
+	input.Manifest().Properties = queueoutputcreator.Properties{Title: "Invoice 42", Correspondent: "Acme Billing", Tags: []string{"mail"}}
+	input.AddFile("merged.pdf", []byte("%PDF-1.4"))
+	entry := input.Manifest().File("merged.pdf")
+	entry.Title = "Invoice 42 (corrected)"
+	entry.Tags = []string{"Invoice"}
+
+	handler := new(PaperlessUploadHandler).WithPaperless(paperless.NewPaperless(fake.URL, "token"))
+	runHandlerFunc(t, input, func(inputFiles chan InputFile, outputFiles queueoutputcreator.QueueZipFileWriter) error {
+		return handler.Run(logrus.New(), inputFiles, outputFiles)
+	})
+
+	uploads := fake.received()
+	if !assert.Len(t, uploads, 1) {
+		return
+	}
+	assert.Equal(t, "Invoice 42 (corrected)", uploads[0].Get("title"))
+	assert.Equal(t, []string{"Acme Billing"}, fake.names("/api/correspondents/", uploads[0]["correspondent"]))
+	assert.ElementsMatch(t, []string{"invoice", "mail"}, fake.names("/api/tags/", uploads[0]["tags"]))
+	assert.Empty(t, uploads[0]["created"])
+}
+
+func TestUploadSendsProfileCorrespondent(t *testing.T) {
+	fake := startFakePaperless(t)
+	profiles := Profiles{"receipts": {Correspondent: "Shop", Tags: []string{"receipt"}}}
+	input := queueoutputcreator.CreateMemZipFileCreator()
+	applyProfile(input.Manifest(), "receipts", profiles["receipts"])
+	input.AddFile("merged.pdf", []byte("%PDF-1.4"))
+
+	handler := new(PaperlessUploadHandler).WithPaperless(paperless.NewPaperless(fake.URL, "token")).WithProfiles(profiles)
+	runHandlerFunc(t, input, func(inputFiles chan InputFile, outputFiles queueoutputcreator.QueueZipFileWriter) error {
+		return handler.Run(logrus.New(), inputFiles, outputFiles)
+	})
+
+	uploads := fake.received()
+	if !assert.Len(t, uploads, 1) {
+		return
+	}
+	assert.Equal(t, []string{"Shop"}, fake.names("/api/correspondents/", uploads[0]["correspondent"]))
+	assert.Equal(t, []string{"receipt"}, fake.names("/api/tags/", uploads[0]["tags"]))
+}
@@ -0,0 +1,151 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	queueoutputcreator "github.com/schidstorm/scanner-tool/pkg/queue_output_creator"
+	"github.com/schidstorm/scanner-tool/pkg/scan"
+)
+
+var ErrUnknownProfile = errors.New("unknown profile")
+
+// DefaultProfile is used when a scan or ingest does not select a profile.
+const DefaultProfile = "default"
+
+const (
+	SinkPaperless = "paperless"
+	// SinkDirPrefix is followed by the directory documents are copied to.
+	SinkDirPrefix = "dir:"
+)
+
+// ocrLanguage matches tesseract language names like "deu" or "chi_sim".
+var ocrLanguage = regexp.MustCompile(`^[A-Za-z_]+$`)
+
+// Profile bundles everything that depends on the kind of document, e.g.
+// receipts, colour photos or long contracts.
+type Profile struct {
+	// Settings replace the scan settings of the scan options.
+	Settings *scan.Settings `yaml:"settings"`
+	// Rotate turns scanned pages by 180 (default) or 0 degrees. A cover
+	// sheet that selects the profile turns the following pages again if
+	// they were turned differently.
+	Rotate *int `yaml:"rotate"`
+	// OcrLanguages are tesseract languages, e.g. "deu". Tesseract uses its
+	// default if none are set.
+	OcrLanguages  []string `yaml:"ocrlanguages"`
+	Tags          []string `yaml:"tags"`
+	Correspondent string   `yaml:"correspondent"`
+	// Sinks receive the finished documents: "paperless" (default) or
+	// "dir:<path>".
+	Sinks []string `yaml:"sinks"`
+}
+
+func (p Profile) Validate() error {
+	if p.Settings != nil {
+		err := p.Settings.Validate()
+		if err != nil {
+			return err
+		}
+	}
+	if p.Rotate != nil && *p.Rotate != 0 && *p.Rotate != 180 {
+		return fmt.Errorf("rotate must be 0 or 180, not %d", *p.Rotate)
+	}
+	for _, language := range p.OcrLanguages {
+		if !ocrLanguage.MatchString(language) {
+			return fmt.Errorf("invalid ocr language %q", language)
+		}
+	}
+	for _, sink := range p.Sinks {
+		if sink != SinkPaperless && (!strings.HasPrefix(sink, SinkDirPrefix) || sink == SinkDirPrefix) {
+			return fmt.Errorf("unknown sink %q", sink)
+		}
+	}
+	return nil
+}
+
+func (p Profile) rotation() int {
+	if p.Rotate == nil {
+		return 180
+	}
+	return *p.Rotate
+}
+
+func (p Profile) sinks() []string {
+	if len(p.Sinks) == 0 {
+		return []string{SinkPaperless}
+	}
+	return p.Sinks
+}
+
+// Profiles are keyed by their name.
+type Profiles map[string]Profile
+
+func (p Profiles) Validate() error {
+	for name, profile := range p {
+		err := profile.Validate()
+		if err != nil {
+			return fmt.Errorf("profile %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// Check fails for names that are not configured. Without any configured
+// profiles, names are only recorded and every name is accepted.
+func (p Profiles) Check(name string) error {
+	if name == "" || len(p) == 0 {
+		return nil
+	}
+	if _, ok := p[name]; !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownProfile, name)
+	}
+	return nil
+}
+
+// Select returns the profile with the given name, or the default profile if
+// name is empty. Unknown names get a profile with default settings.
+func (p Profiles) Select(name string) (string, Profile) {
+	if name == "" {
+		if _, ok := p[DefaultProfile]; ok {
+			name = DefaultProfile
+		}
+	}
+	return name, p[name]
+}
+
+// applyProfile records the profile in the manifest and adds its tags and
+// correspondent to the bundle properties.
+func applyProfile(manifest *queueoutputcreator.Manifest, name string, profile Profile) {
+	manifest.Source.Profile = name
+	for _, tag := range profile.Tags {
+		if !slices.Contains(manifest.Properties.Tags, tag) {
+			manifest.Properties.Tags = append(manifest.Properties.Tags, tag)
+		}
+	}
+	if manifest.Properties.Correspondent == "" {
+		manifest.Properties.Correspondent = profile.Correspondent
+	}
+}
+
+// replaceProfile switches the bundle to another profile, e.g. when a cover
+// sheet selects one. The tags and correspondent of the previous profile are
+// removed first, values from other sources are kept.
+func replaceProfile(manifest *queueoutputcreator.Manifest, previous Profile, name string, profile Profile) {
+	manifest.Properties.Tags = slices.DeleteFunc(manifest.Properties.Tags, func(tag string) bool {
+		return slices.ContainsFunc(previous.Tags, func(t string) bool { return strings.EqualFold(t, tag) })
+	})
+	if manifest.Properties.Correspondent == previous.Correspondent {
+		manifest.Properties.Correspondent = ""
+	}
+	applyProfile(manifest, name, profile)
+}
+
+// manifestProfile returns the profile recorded in the manifest.
+func manifestProfile(profiles Profiles, manifest *queueoutputcreator.Manifest) Profile {
+	_, profile := profiles.Select(manifest.Source.Profile)
+	return profile
+}
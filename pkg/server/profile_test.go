@@ -0,0 +1,182 @@
+package server
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	queueoutputcreator "github.com/schidstorm/scanner-tool/pkg/queue_output_creator"
+	"github.com/schidstorm/scanner-tool/pkg/scan"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProfileValidate(t *testing.T) {
+	noRotation := 0
+	badRotation := 90
+	assert.NoError(t, Profile{}.Validate())
+	assert.NoError(t, Profile{Rotate: &noRotation, OcrLanguages: []string{"deu", "chi_sim"}, Sinks: []string{"paperless", "dir:/srv/scans"}}.Validate())
+	assert.Error(t, Profile{Rotate: &badRotation}.Validate())
+	assert.Error(t, Profile{OcrLanguages: []string{"deu -psm"}}.Validate())
+	assert.Error(t, Profile{Sinks: []string{"dir:"}}.Validate())
+	assert.Error(t, Profile{Sinks: []string{"ftp"}}.Validate())
+	assert.Error(t, Profile{Settings: &scan.Settings{Mode: "sepia"}}.Validate())
+}
+
+func TestProfilesSelect(t *testing.T) {
+	profiles := Profiles{
+		"default":  {Tags: []string{"inbox"}},
+		"receipts": {Tags: []string{"receipt"}},
+	}
+
+	name, profile := profiles.Select("")
+	assert.Equal(t, "default", name)
+	assert.Equal(t, []string{"inbox"}, profile.Tags)
+
+	name, profile = profiles.Select("receipts")
+	assert.Equal(t, "receipts", name)
+	assert.Equal(t, []string{"receipt"}, profile.Tags)
+
+	assert.NoError(t, profiles.Check("receipts"))
+	assert.ErrorIs(t, profiles.Check("photos"), ErrUnknownProfile)
+	assert.NoError(t, Profiles(nil).Check("photos"))
+
+	name, _ = Profiles(nil).Select("")
+	assert.Equal(t, "", name)
+}
+
+func TestApplyProfile(t *testing.T) {
+	manifest := queueoutputcreator.NewManifest()
+	manifest.Properties.Tags = []string{"phone"}
+	manifest.Properties.Correspondent = "Acme"
+
+	applyProfile(manifest, "receipts", Profile{Tags: []string{"receipt", "phone"}, Correspondent: "Shop"})
+	assert.Equal(t, "receipts", manifest.Source.Profile)
+	assert.Equal(t, []string{"phone", "receipt"}, manifest.Properties.Tags)
+	assert.Equal(t, "Acme", manifest.Properties.Correspondent)
+}
+
+func TestCoverSheetProfile(t *testing.T) {
+	handler := new(TesseractHandler).WithProfiles(Profiles{"receipts": {}})
+
+	name, ok := handler.coverSheetProfile("Cover sheet\n\nScan Profile: Receipts\n")
+	assert.True(t, ok)
+	assert.Equal(t, "receipts", name)
+
+	_, ok = handler.coverSheetProfile("Scan profile: photos\n")
+	assert.False(t, ok)
+	_, ok = handler.coverSheetProfile("Dear customer, please choose a scan profile: receipts or photos.")
+	assert.False(t, ok)
+}
+
+// fakeTesseract reads "COVER" as a cover sheet for photos and returns the
+// page itself as the PDF.
+func fakeTesseract(t *testing.T) {
+	dir := t.TempDir()
+	script := `#!/bin/sh
+if [ "$3" = "pdf" ] || [ "$5" = "pdf" ]; then
+	exec cat
+fi
+if grep -q COVER; then
+	echo "Scan profile: photos"
+else
+	echo "page"
+fi
+`
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "tesseract"), []byte(script), 0755))
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
+
+func TestCoverSheetProfileTurnsPages(t *testing.T) {
+	fakeTesseract(t)
+	page := image.NewGray(image.Rect(0, 0, 2, 1))
+	page.SetGray(1, 0, color.Gray{Y: 255})
+	var pageData bytes.Buffer
+	assert.NoError(t, png.Encode(&pageData, page))
+
+	noRotation := 0
+	handler := new(TesseractHandler).WithProfiles(Profiles{"photos": {Rotate: &noRotation, Correspondent: "Photo Lab"}})
+	for _, mirrored := range []bool{true, false} {
+		input := queueoutputcreator.CreateMemZipFileCreator()
+		if mirrored {
+			input.Manifest().RecordStage("ImageMirrorHandler", time.Now(), time.Now())
+		}
+		input.AddFile("cover.png", []byte("COVER"))
+		input.AddFile("page.png", pageData.Bytes())
+
+		output := runHandlerChain(t, input, handler)
+		assert.Equal(t, "photos", output.Manifest().Source.Profile)
+		assert.Equal(t, "Photo Lab", output.Manifest().Properties.Correspondent)
+		assert.Equal(t, []string{"page.pdf"}, output.FileNames())
+		result, err := png.Decode(bytes.NewReader(output.Files()["page.pdf"].Bytes()))
+		if !assert.NoError(t, err) {
+			continue
+		}
+
+		// the pages were turned by the default profile, photos are not
+		// turned, so scanned pages are turned back; ingested pages are
+		// never turned
+		r, _, _, _ := result.At(0, 0).RGBA()
+		if mirrored {
+			assert.Equal(t, uint32(0xffff), r)
+		} else {
+			assert.Equal(t, uint32(0), r)
+		}
+	}
+}
+
+func TestImageMirrorHandlerKeepsPagesWithoutRotation(t *testing.T) {
+	noRotation := 0
+	input := queueoutputcreator.CreateMemZipFileCreator()
+	input.Manifest().Source.Profile = "photos"
+	input.AddFile("page.png", []byte("png"))
+
+	output := runHandlerChain(t, input, new(ImageMirrorHandler).WithProfiles(Profiles{"photos": {Rotate: &noRotation}}))
+	assert.Equal(t, "png", output.Files()["page.png"].String())
+	assert.Equal(t, "photos", output.Manifest().Source.Profile)
+}
+
+func TestUploadHandlerCopiesToDirSink(t *testing.T) {
+	dir := t.TempDir()
+	input := queueoutputcreator.CreateMemZipFileCreator()
+	input.Manifest().Source.Profile = "archive"
+	input.AddFile("contract.pdf", []byte("pdf"))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "contract.pdf"), []byte("older"), 0644))
+
+	handler := new(PaperlessUploadHandler).WithProfiles(Profiles{"archive": {Sinks: []string{"dir:" + dir}}})
+	for i := 0; i < 2; i++ {
+		runHandlerFunc(t, input, func(inputFiles chan InputFile, outputFiles queueoutputcreator.QueueZipFileWriter) error {
+			return handler.Run(logrus.New(), inputFiles, outputFiles)
+		})
+	}
+
+	entries, err := os.ReadDir(dir)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 2)
+	data, err := os.ReadFile(filepath.Join(dir, "contract-"+input.Manifest().ID+".pdf"))
+	assert.NoError(t, err)
+	assert.Equal(t, "pdf", string(data))
+}
+
+func TestCoverSheetReplacesDefaultProfile(t *testing.T) {
+	fakeTesseract(t)
+	profiles := Profiles{
+		DefaultProfile: {Correspondent: "Unknown", Tags: []string{"inbox"}},
+		"photos":       {Correspondent: "Photo Lab", Tags: []string{"photo"}},
+	}
+	input := queueoutputcreator.CreateMemZipFileCreator()
+	input.Manifest().Properties.Tags = []string{"mail"}
+	applyProfile(input.Manifest(), DefaultProfile, profiles[DefaultProfile])
+	input.AddFile("cover.png", []byte("COVER"))
+	input.AddFile("page.png", []byte("page"))
+
+	output := runHandlerChain(t, input, new(TesseractHandler).WithProfiles(profiles))
+	assert.Equal(t, "photos", output.Manifest().Source.Profile)
+	assert.Equal(t, "Photo Lab", output.Manifest().Properties.Correspondent)
+	assert.Equal(t, []string{"mail", "photo"}, output.Manifest().Properties.Tags)
+}
@@ -1,15 +1,29 @@
 package server
 
 import (
+	"io"
 	"os"
+	"path/filepath"
+	"time"
 
 	queueoutputcreator "github.com/schidstorm/scanner-tool/pkg/queue_output_creator"
 	"github.com/schidstorm/scanner-tool/pkg/scan"
+	"github.com/schidstorm/scanner-tool/pkg/workspace"
 	"github.com/sirupsen/logrus"
 )
 
+// scanBackOff is the first pause after a scan failed in a way that repeating
+// it right away would not fix. It doubles up to maxScanBackOff.
+var scanBackOff = 30 * time.Second
+var maxScanBackOff = 10 * time.Minute
+
 type ScanHandler struct {
-	scanner scan.Scanner
+	scanner  scan.Scanner
+	triggers *scan.Triggers
+	profiles Profiles
+	status   scannerStatus
+	backOff  time.Duration
+	nextScan time.Time
 }
 
 func (s *ScanHandler) WithScanner(scanner scan.Scanner) *ScanHandler {
@@ -18,37 +32,172 @@ func (s *ScanHandler) WithScanner(scanner scan.Scanner) *ScanHandler {
 	return s
 }
 
-func (s *ScanHandler) Run(logger *logrus.Logger, _ chan InputFile, outputFiles queueoutputcreator.QueueZipFileWriter) error {
-	imagePaths, err := s.scanner.Scan()
+// WithTriggers makes the handler scan only when triggered. Without triggers
+// it scans on every run.
+func (s *ScanHandler) WithTriggers(triggers *scan.Triggers) *ScanHandler {
+	s.triggers = triggers
+
+	return s
+}
+
+// WithProfiles makes triggered scans use the settings of their profile.
+func (s *ScanHandler) WithProfiles(profiles Profiles) *ScanHandler {
+	s.profiles = profiles
+
+	return s
+}
+
+// Status reports the condition of the scanner after the last scan.
+func (s *ScanHandler) Status() ScannerStatus {
+	status := s.status.get()
+	if status.Device == "" {
+		status.Device = s.scanner.Device()
+	}
+	return status
+}
+
+func (s *ScanHandler) Run(logger *logrus.Logger, _ chan InputFile, outputFiles queueoutputcreator.QueueZipFileWriter) (resErr error) {
+	paused := time.Now().Before(s.nextScan)
+	if paused && s.triggers == nil {
+		return nil
+	}
+
+	var trigger scan.Trigger
+	if s.triggers != nil {
+		var ok bool
+		trigger, ok = s.triggers.Next()
+		if !ok {
+			return nil
+		}
+		// someone asked for the scan, e.g. after plugging the scanner in,
+		// so only scheduled scans wait for the pause
+		if paused && trigger.Origin == scan.OriginSchedule {
+			logger.WithField("device", s.scanner.Device()).Debug("Scanner is paused, skipping scheduled scan")
+			return nil
+		}
+	}
+
+	ws, err := workspace.New("scan")
+	if err != nil {
+		return err
+	}
+	defer keepOnError(logger, ws, &resErr)
+
+	profileName, profile := s.profiles.Select(trigger.Profile)
+	imagePaths, err := s.scan(logger, ws.Dir(), profile)
+	err = s.react(logger, trigger, err, len(imagePaths))
 	if err != nil {
 		return err
 	}
 
 	if len(imagePaths) == 0 {
+		if s.triggers != nil {
+			logger.WithField("device", s.scanner.Device()).WithField("origin", trigger.Origin).Info("Triggered scan found no pages")
+		}
 		return nil
 	}
 
-	logger.WithField("images", len(imagePaths)).WithField("files", imagePaths).Info("Scanned")
+	logger.WithField("device", s.scanner.Device()).WithField("images", len(imagePaths)).WithField("files", imagePaths).Info("Scanned")
+
+	outputFiles.Manifest().Source.Device = s.scanner.Device()
+	applyProfile(outputFiles.Manifest(), profileName, profile)
 
 	for _, imagePath := range imagePaths {
-		rc, err := os.OpenFile(imagePath, os.O_RDONLY, 0o644)
+		err := addImageFile(imagePath, outputFiles)
 		if err != nil {
 			return err
 		}
-		defer rc.Close()
+	}
 
-		fileInfo, err := rc.Stat()
-		if err != nil {
-			return err
-		}
+	return nil
+}
+
+// react records the outcome of a scan and decides whether to retry, back off
+// or alert. Only errors that could not be classified are returned.
+func (s *ScanHandler) react(logger *logrus.Logger, trigger scan.Trigger, err error, pages int) error {
+	device := s.scanner.Device()
+	condition := scan.Classify(err)
+	previous := s.status.record(device, condition, err, pages)
+	scanLogger := logger.WithField("device", device).WithField("condition", condition)
+	if err != nil {
+		scanLogger = scanLogger.WithError(err)
+	}
 
-		fileName := fileInfo.Name()
-		outputFiles.AddFileReader(fileName, rc)
+	switch condition.Action() {
+	case scan.ActionNone:
+		s.backOff = 0
+		s.nextScan = time.Time{}
+		return nil
+	case scan.ActionRetry:
+		scanLogger.Info("Scanner is busy, retrying")
+		if s.triggers != nil {
+			if err := s.triggers.Fire(trigger); err != nil {
+				scanLogger.WithError(err).Warn("Dropped scan trigger")
+			}
+		}
+		return nil
 	}
 
+	s.backOff = min(max(2*s.backOff, scanBackOff), maxScanBackOff)
+	s.nextScan = time.Now().Add(s.backOff)
+	s.status.backOff(s.nextScan)
+	scanLogger = scanLogger.WithField("backoff", s.backOff)
+
+	switch {
+	case condition == scan.ConditionFailed:
+		return err
+	case condition.Action() == scan.ActionAlert && condition != previous:
+		scanLogger.Error("Scanner needs attention")
+	case condition != previous:
+		scanLogger.Warn("Scanner is unavailable, pausing scans")
+	default:
+		scanLogger.Debug("Scanner is still unavailable")
+	}
 	return nil
 }
 
+func (s *ScanHandler) scan(logger *logrus.Logger, dir string, profile Profile) ([]string, error) {
+	if profile.Settings == nil {
+		return s.scanner.Scan(dir)
+	}
+
+	settingsScanner, ok := s.scanner.(scan.SettingsScanner)
+	if !ok {
+		logger.WithField("device", s.scanner.Device()).Warn("Scanner cannot change its settings, ignoring the profile settings")
+		return s.scanner.Scan(dir)
+	}
+	return settingsScanner.ScanWith(dir, *profile.Settings)
+}
+
+// keepOnError removes the workspace of a job that succeeded. Failed jobs
+// leave theirs for inspection, it is swept on the next start.
+func keepOnError(logger *logrus.Logger, ws *workspace.Workspace, resErr *error) {
+	if *resErr != nil {
+		logger.WithField("workspace", ws.Dir()).Warn("Keeping workspace of failed job")
+		return
+	}
+
+	err := ws.Remove()
+	if err != nil {
+		logger.WithError(err).WithField("workspace", ws.Dir()).Warn("Failed to remove workspace")
+	}
+}
+
+func addImageFile(imagePath string, outputFiles queueoutputcreator.QueueZipFileWriter) error {
+	rc, err := os.Open(imagePath)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	return outputFiles.AddFileReader(filepath.Base(imagePath), rc).Error()
+}
+
+// Close releases the scanner if it holds the device open, e.g. the native
+// libsane scanner.
 func (s *ScanHandler) Close() error {
+	if closer, ok := s.scanner.(io.Closer); ok {
+		return closer.Close()
+	}
 	return nil
 }
@@ -0,0 +1,267 @@
+package server
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	queueoutputcreator "github.com/schidstorm/scanner-tool/pkg/queue_output_creator"
+	"github.com/schidstorm/scanner-tool/pkg/scan"
+	"github.com/schidstorm/scanner-tool/pkg/workspace"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+type testScanner struct {
+	device string
+	images []string
+	err    error
+	scans  int
+	dir    string
+}
+
+// Scan copies the images into dir like a scanner writes its pages.
+func (s *testScanner) Scan(dir string) ([]string, error) {
+	s.scans++
+	s.dir = dir
+	if s.err != nil {
+		return nil, s.err
+	}
+
+	var imagePaths []string
+	for _, image := range s.images {
+		data, err := os.ReadFile(image)
+		if err != nil {
+			return nil, err
+		}
+		imagePath := filepath.Join(dir, filepath.Base(image))
+		err = os.WriteFile(imagePath, data, 0o644)
+		if err != nil {
+			return nil, err
+		}
+		imagePaths = append(imagePaths, imagePath)
+	}
+	return imagePaths, nil
+}
+
+// useTempWorkspaces keeps the workspaces of a test in its temp dir.
+func useTempWorkspaces(t *testing.T) string {
+	oldRoot := workspace.Root()
+	workspace.SetRoot(t.TempDir())
+	t.Cleanup(func() { workspace.SetRoot(oldRoot) })
+	return workspace.Root()
+}
+
+func (s *testScanner) Device() string {
+	return s.device
+}
+
+// closingScanner is a scanner that holds its device open.
+type closingScanner struct {
+	testScanner
+	closed bool
+}
+
+func (s *closingScanner) Close() error {
+	s.closed = true
+	return nil
+}
+
+func TestScanHandlerClosesScanner(t *testing.T) {
+	scanner := &closingScanner{}
+	assert.NoError(t, new(ScanHandler).WithScanner(scanner).Close())
+	assert.True(t, scanner.closed)
+
+	assert.NoError(t, new(ScanHandler).WithScanner(&testScanner{}).Close())
+}
+
+func TestScanHandlerTagsSourceDevice(t *testing.T) {
+	useTempWorkspaces(t)
+	imagePath := filepath.Join(t.TempDir(), "scan-001.png")
+	assert.NoError(t, os.WriteFile(imagePath, []byte("png"), 0o644))
+
+	output := queueoutputcreator.CreateMemZipFileCreator()
+	handler := new(ScanHandler).WithScanner(&testScanner{device: "epson2:libusb:001:004", images: []string{imagePath}})
+	assert.NoError(t, handler.Run(logrus.New(), nil, output))
+
+	assert.Equal(t, "epson2:libusb:001:004", output.Manifest().Source.Device)
+	assert.Equal(t, "png", output.Files()["scan-001.png"].String())
+}
+
+func TestScanHandlerWaitsForTrigger(t *testing.T) {
+	imagePath := filepath.Join(t.TempDir(), "scan-001.png")
+	assert.NoError(t, os.WriteFile(imagePath, []byte("png"), 0o644))
+
+	scanner := &testScanner{device: "scanner", images: []string{imagePath}}
+	triggers := scan.NewTriggers(scan.TriggerOptions{}, scanner)
+	handler := new(ScanHandler).WithScanner(scanner).WithTriggers(triggers)
+
+	output := queueoutputcreator.CreateMemZipFileCreator()
+	assert.NoError(t, handler.Run(logrus.New(), nil, output))
+	assert.Equal(t, 0, output.FileCount())
+
+	assert.NoError(t, triggers.Fire(scan.Trigger{Profile: "receipts", Origin: "api"}))
+	assert.NoError(t, handler.Run(logrus.New(), nil, output))
+	assert.Equal(t, 1, output.FileCount())
+	assert.Equal(t, "receipts", output.Manifest().Source.Profile)
+}
+
+type testSettingsScanner struct {
+	testScanner
+	settings []scan.Settings
+}
+
+func (s *testSettingsScanner) ScanWith(dir string, settings scan.Settings) ([]string, error) {
+	s.settings = append(s.settings, settings)
+	return s.images, nil
+}
+
+func TestScanHandlerUsesProfile(t *testing.T) {
+	imagePath := filepath.Join(t.TempDir(), "scan-001.png")
+	assert.NoError(t, os.WriteFile(imagePath, []byte("png"), 0o644))
+
+	scanner := &testSettingsScanner{testScanner: testScanner{device: "scanner", images: []string{imagePath}}}
+	triggers := scan.NewTriggers(scan.TriggerOptions{}, scanner)
+	photos := scan.Settings{Mode: scan.ModeColor, Source: scan.SourceFlatbed}
+	handler := new(ScanHandler).WithScanner(scanner).WithTriggers(triggers).WithProfiles(Profiles{
+		"default": {Tags: []string{"inbox"}},
+		"photos":  {Settings: &photos, Tags: []string{"photo"}, Correspondent: "Family"},
+	})
+
+	assert.NoError(t, triggers.Fire(scan.Trigger{Profile: "photos", Origin: "api"}))
+	output := queueoutputcreator.CreateMemZipFileCreator()
+	assert.NoError(t, handler.Run(logrus.New(), nil, output))
+	assert.Equal(t, []scan.Settings{photos}, scanner.settings)
+	assert.Equal(t, "photos", output.Manifest().Source.Profile)
+	assert.Equal(t, []string{"photo"}, output.Manifest().Properties.Tags)
+	assert.Equal(t, "Family", output.Manifest().Properties.Correspondent)
+
+	// the default profile has no settings, so the configured ones are used
+	assert.NoError(t, triggers.Fire(scan.Trigger{Origin: "schedule"}))
+	output = queueoutputcreator.CreateMemZipFileCreator()
+	assert.NoError(t, handler.Run(logrus.New(), nil, output))
+	assert.Len(t, scanner.settings, 1)
+	assert.Equal(t, "default", output.Manifest().Source.Profile)
+	assert.Equal(t, []string{"inbox"}, output.Manifest().Properties.Tags)
+}
+
+func TestDaemonRunsSimulatedScanner(t *testing.T) {
+	useTempWorkspaces(t)
+
+	scanner := scan.NewSimulatedScanner(scan.Options{
+		Settings:  scan.Settings{Resolution: 20, Source: scan.SourceDuplex},
+		Simulated: scan.SimulatedOptions{Sheets: 1, Schedule: []string{scan.SimulateBusy, scan.SimulateOk}},
+	}, scan.DeviceSelector{Name: "ci", Driver: scan.DriverSimulated})
+	sink := &testSinkHandler{received: make(chan string, 16)}
+	runMemDaemon(t, []DaemonHandler{
+		new(ScanHandler).WithScanner(scanner),
+		new(ImageMirrorHandler),
+		sink,
+	})
+
+	for i := 0; i < 2; i++ {
+		select {
+		case page := <-sink.received:
+			assert.True(t, strings.HasPrefix(page, "\x89PNG"))
+		case <-time.After(5 * time.Second):
+			t.Fatal("pipeline did not deliver the simulated pages")
+		}
+	}
+}
+
+func TestScanHandlerReactsToConditions(t *testing.T) {
+	scanner := &testScanner{device: "scanner", err: scan.ErrNoDocs}
+	triggers := scan.NewTriggers(scan.TriggerOptions{}, scanner)
+	handler := new(ScanHandler).WithScanner(scanner).WithTriggers(triggers)
+	run := func() {
+		assert.NoError(t, handler.Run(logrus.New(), nil, queueoutputcreator.CreateMemZipFileCreator()))
+	}
+
+	// an empty feeder is no failure
+	assert.NoError(t, triggers.Fire(scan.Trigger{Origin: "api"}))
+	run()
+	assert.Equal(t, scan.ConditionFeederEmpty, handler.Status().Condition)
+	assert.Nil(t, handler.Status().BackOffUntil)
+
+	// a busy scanner is retried with the same trigger
+	scanner.err = scan.ErrDeviceBusy
+	assert.NoError(t, triggers.Fire(scan.Trigger{Profile: "receipts", Origin: "api"}))
+	run()
+	trigger, ok := triggers.Next()
+	assert.True(t, ok)
+	assert.Equal(t, "receipts", trigger.Profile)
+
+	// a jam pauses scanning
+	scanner.err = scan.ErrJammed
+	assert.NoError(t, triggers.Fire(scan.Trigger{Origin: "api"}))
+	run()
+	status := handler.Status()
+	assert.Equal(t, scan.ConditionJammed, status.Condition)
+	assert.Contains(t, status.Error, "paper jam")
+	assert.NotNil(t, status.BackOffUntil)
+	assert.Equal(t, scanBackOff, handler.backOff)
+
+	// scheduled scans are dropped during the pause
+	assert.NoError(t, triggers.Fire(scan.Trigger{Origin: scan.OriginSchedule}))
+	run()
+	assert.Equal(t, 3, scanner.scans)
+	_, ok = triggers.Next()
+	assert.False(t, ok)
+
+	// explicit triggers do not wait, the pause doubles while the condition
+	// lasts and ends with a good scan
+	assert.NoError(t, triggers.Fire(scan.Trigger{Origin: "button:scan"}))
+	run()
+	assert.Equal(t, 4, scanner.scans)
+	assert.Equal(t, 2*scanBackOff, handler.backOff)
+
+	scanner.err = nil
+	assert.NoError(t, triggers.Fire(scan.Trigger{Origin: "api"}))
+	run()
+	assert.Equal(t, time.Duration(0), handler.backOff)
+	assert.True(t, handler.nextScan.IsZero())
+	assert.Nil(t, handler.Status().BackOffUntil)
+	assert.Equal(t, map[scan.Condition]int{
+		scan.ConditionFeederEmpty: 1,
+		scan.ConditionDeviceBusy:  1,
+		scan.ConditionJammed:      2,
+		scan.ConditionOk:          1,
+	}, handler.Status().Scans)
+}
+
+func TestScanHandlerReturnsUnknownErrors(t *testing.T) {
+	useTempWorkspaces(t)
+	scanner := &testScanner{device: "scanner", err: assert.AnError}
+	handler := new(ScanHandler).WithScanner(scanner)
+
+	err := handler.Run(logrus.New(), nil, queueoutputcreator.CreateMemZipFileCreator())
+	assert.ErrorIs(t, err, assert.AnError)
+	assert.Equal(t, scan.ConditionFailed, handler.Status().Condition)
+	assert.NotNil(t, handler.Status().BackOffUntil)
+	// the workspace of the failed scan is kept for inspection
+	assert.DirExists(t, scanner.dir)
+}
+
+func TestScanHandlerRemovesWorkspace(t *testing.T) {
+	root := useTempWorkspaces(t)
+	imagePath := filepath.Join(t.TempDir(), "scan-001.png")
+	assert.NoError(t, os.WriteFile(imagePath, []byte("png"), 0o644))
+
+	scanner := &testScanner{device: "scanner", images: []string{imagePath}}
+	handler := new(ScanHandler).WithScanner(scanner)
+
+	output := queueoutputcreator.CreateMemZipFileCreator()
+	assert.NoError(t, handler.Run(logrus.New(), nil, output))
+	firstDir := scanner.dir
+	assert.Equal(t, root, filepath.Dir(firstDir))
+	assert.NoDirExists(t, firstDir)
+
+	// every scan gets its own directory
+	output = queueoutputcreator.CreateMemZipFileCreator()
+	assert.NoError(t, handler.Run(logrus.New(), nil, output))
+	assert.NotEqual(t, firstDir, scanner.dir)
+	assert.NoDirExists(t, scanner.dir)
+	assert.Equal(t, "png", output.Files()["scan-001.png"].String())
+}
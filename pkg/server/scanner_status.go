@@ -0,0 +1,72 @@
+package server
+
+import (
+	"maps"
+	"sync"
+	"time"
+
+	"github.com/schidstorm/scanner-tool/pkg/scan"
+)
+
+// ScannerStatus is what a scan handler knows about its scanner.
+type ScannerStatus struct {
+	Device    string         `json:"device"`
+	Condition scan.Condition `json:"condition"`
+	Error     string         `json:"error,omitempty"`
+	// Since is when the scanner entered its condition.
+	Since    time.Time `json:"since"`
+	LastScan time.Time `json:"lastScan"`
+	// BackOffUntil is set while scans are paused after a failure.
+	BackOffUntil *time.Time `json:"backOffUntil,omitempty"`
+	Pages        int        `json:"pages"`
+	// Scans counts the scans per condition.
+	Scans map[scan.Condition]int `json:"scans"`
+}
+
+type scannerStatus struct {
+	mutex  sync.Mutex
+	status ScannerStatus
+}
+
+// record returns the condition of the previous scan.
+func (s *scannerStatus) record(device string, condition scan.Condition, err error, pages int) scan.Condition {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := time.Now().UTC()
+	previous := s.status.Condition
+	if condition != previous {
+		s.status.Since = now
+	}
+	s.status.Device = device
+	s.status.Condition = condition
+	s.status.Error = ""
+	if err != nil {
+		s.status.Error = err.Error()
+	}
+	s.status.LastScan = now
+	s.status.BackOffUntil = nil
+	s.status.Pages += pages
+	if s.status.Scans == nil {
+		s.status.Scans = make(map[scan.Condition]int)
+	}
+	s.status.Scans[condition]++
+	return previous
+}
+
+func (s *scannerStatus) backOff(until time.Time) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	until = until.UTC()
+	s.status.BackOffUntil = &until
+}
+
+func (s *scannerStatus) get() ScannerStatus {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	status := s.status
+	status.Scans = maps.Clone(s.status.Scans)
+	return status
+}
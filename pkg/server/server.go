@@ -1,10 +1,23 @@
 package server
 
 import (
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
 	"github.com/schidstorm/scanner-tool/pkg/ai"
+	"github.com/schidstorm/scanner-tool/pkg/encryption"
 	"github.com/schidstorm/scanner-tool/pkg/filequeue"
+	"github.com/schidstorm/scanner-tool/pkg/ingest"
 	"github.com/schidstorm/scanner-tool/pkg/paperless"
+	queueoutputcreator "github.com/schidstorm/scanner-tool/pkg/queue_output_creator"
 	"github.com/schidstorm/scanner-tool/pkg/scan"
+	"github.com/schidstorm/scanner-tool/pkg/workspace"
 )
 
 type Options struct {
@@ -12,47 +25,398 @@ type Options struct {
 	ChatGptApiKey  string       `yaml:"chatgptapikey"`
 	PaperlessToken string       `yaml:"paperlesstoken"`
 	PaperlessUrl   string       `yaml:"paperlessurl"`
+	QueueOptions   QueueOptions `yaml:"queueoptions"`
+	// Encryption enables encryption at rest of all queued bundles.
+	Encryption encryption.Options `yaml:"encryption"`
+	// MetadataConflictPolicy resolves differing metadata of pages that are
+	// merged into one document: "first" (default) or "drop".
+	MetadataConflictPolicy queueoutputcreator.ConflictPolicy `yaml:"metadataconflictpolicy"`
+	// BundleFormat is "zip" (default) or "dir". Directory bundles are not
+	// packed and unpacked by every stage, which saves I/O and CPU on small
+	// hardware. They need the fs queue backend.
+	BundleFormat string `yaml:"bundleformat"`
+	// Http serves the API, it is disabled if no address is set.
+	Http HttpOptions `yaml:"http"`
+	// WatchFolders are ingested like scans: images get OCR, searchable PDFs
+	// skip ahead to merging.
+	WatchFolders []ingest.WatchFolderOptions `yaml:"watchfolders"`
+	// Mailboxes are IMAP folders whose mail attachments are ingested.
+	Mailboxes []ingest.MailboxOptions `yaml:"mailboxes"`
+	// Profiles are selected by buttons, schedules, API calls, ingest sources
+	// or cover sheets. The "default" profile applies if none is selected.
+	Profiles Profiles `yaml:"profiles"`
+	// WorkDir holds the working directories of scans and merges and the
+	// temporary bundle files. It should be on the filesystem of the queue.
+	WorkDir string `yaml:"workdir"`
+}
+
+type QueueOptions struct {
+	// Backend selects where bundles are queued: "fs" (default) or "nats".
+	Backend string                `yaml:"backend"`
+	Nats    filequeue.NatsOptions `yaml:"nats"`
+	// Stages limits this process to the named handlers. All stages run if
+	// it is empty. Combined with the nats backend, stages can be spread
+	// over several hosts.
+	Stages []string `yaml:"stages"`
+	// MinFreeDiskBytes pauses all producing handlers while the queue
+	// filesystem has less free space than this.
+	MinFreeDiskBytes int64 `yaml:"minfreediskbytes"`
+	// DefaultLimits apply to every queue without an entry in Limits.
+	DefaultLimits filequeue.Limits `yaml:"defaultlimits"`
+	// Limits are keyed by the name of the handler producing into the queue.
+	Limits map[string]filequeue.Limits `yaml:"limits"`
+	// Archive keeps finished bundles per queue, keyed like Limits. The
+	// "ScanHandler" queue holds the raw scans.
+	Archive map[string]filequeue.ArchiveOptions `yaml:"archive"`
 }
 
 type HttpOptions struct {
-	Addr *string
+	Addr *string `yaml:"addr"`
+}
+
+// Stages are the handlers of the pipeline in order. Every stage reads the
+// queue named after the stage before it.
+var Stages = []string{
+	"ScanHandler",
+	"ImageMirrorHandler",
+	"TesseractHandler",
+	"MergeHandler",
+	"AiHandler",
+	"PaperlessUploadHandler",
+}
+
+// InputQueueName returns the name of the queue the given stage reads from.
+// The first stage has no input queue.
+func InputQueueName(stage string) (string, error) {
+	i := slices.Index(Stages, stage)
+	switch {
+	case i < 0:
+		return "", fmt.Errorf("unknown stage %s", stage)
+	case i == 0:
+		return "", fmt.Errorf("stage %s has no input queue", stage)
+	}
+	return Stages[i-1], nil
 }
 
+// archivePruneInterval is how often archived bundles are checked against
+// their TTL and size limit.
+var archivePruneInterval = time.Hour
+
 type Server struct {
-	scanner scan.Scanner
-	daemon  *Daemon
-	options Options
+	daemon       *Daemon
+	scanners     []scan.Scanner
+	scanHandlers []*ScanHandler
+	triggers     []*scan.Triggers
+	watchers     []*ingest.Watcher
+	mailboxes    []*ingest.Mailbox
+	http         *http.Server
+	options      Options
+	cipher       *encryption.Cipher
+	queues       map[string]filequeue.Queue
+	jetStream    jetstream.JetStream
+	natsConn     *nats.Conn
+	stopPrune    chan struct{}
+	wgPrune      sync.WaitGroup
 }
 
-func NewServer(opts Options) *Server {
+func NewServer(opts Options) (*Server, error) {
 	s := &Server{
 		options: opts,
 	}
 
-	s.scanner = scan.NewScanner(s.options.ScanOptions)
+	cipher, err := encryption.NewCipherFromOptions(s.options.Encryption)
+	if err != nil {
+		return nil, err
+	}
+	s.cipher = cipher
+
+	switch s.options.MetadataConflictPolicy {
+	case "", queueoutputcreator.ConflictFirst, queueoutputcreator.ConflictDrop:
+	default:
+		return nil, fmt.Errorf("unknown metadata conflict policy %q", s.options.MetadataConflictPolicy)
+	}
+
+	switch s.options.BundleFormat {
+	case "", "zip":
+	case "dir":
+		if s.options.QueueOptions.Backend == "nats" {
+			return nil, fmt.Errorf("bundle format dir is not supported by the nats queue backend")
+		}
+	default:
+		return nil, fmt.Errorf("unknown bundle format %q", s.options.BundleFormat)
+	}
+
+	if s.options.QueueOptions.Backend == "nats" && len(s.options.QueueOptions.Archive) > 0 {
+		return nil, fmt.Errorf("archive is not supported by the nats queue backend")
+	}
+
+	err = s.options.ScanOptions.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, watchFolder := range s.options.WatchFolders {
+		err = errors.Join(watchFolder.Validate(), s.options.Profiles.Check(watchFolder.Profile))
+		if err != nil {
+			return nil, err
+		}
+	}
+	for _, mailbox := range s.options.Mailboxes {
+		err = errors.Join(mailbox.Validate(), s.options.Profiles.Check(mailbox.Profile))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = s.validateProfiles()
+	if err != nil {
+		return nil, err
+	}
+
+	filequeue.SetMinFreeDiskBytes(s.options.QueueOptions.MinFreeDiskBytes)
+	if s.options.WorkDir != "" {
+		workspace.SetRoot(s.options.WorkDir)
+	}
+
+	if s.options.QueueOptions.Backend == "nats" {
+		err = s.connectNats()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = s.createQueues()
+	if err != nil {
+		if s.natsConn != nil {
+			s.natsConn.Close()
+		}
+		return nil, err
+	}
+
+	s.scanners = scan.NewScanners(s.options.ScanOptions)
+	scanHandlers := make([]*ScanHandler, len(s.scanners))
+	for i, scanner := range s.scanners {
+		scanHandlers[i] = new(ScanHandler).WithScanner(scanner).WithProfiles(s.options.Profiles)
+		if !s.options.ScanOptions.Triggers.IsContinuous() {
+			triggers := scan.NewTriggers(s.options.ScanOptions.Triggers, scanner)
+			scanHandlers[i].WithTriggers(triggers)
+			s.triggers = append(s.triggers, triggers)
+		}
+	}
+
 	aiInstance := ai.NewChatGPTClient(s.options.ChatGptApiKey)
-	s.daemon = NewDaemon(queueFactory, []DaemonHandler{
-		new(ScanHandler).WithScanner(s.scanner),
-		new(ImageMirrorHandler),
-		new(TesseractHandler),
+	s.daemon = NewDaemon(s.queueFactory, []DaemonHandler{
+		scanHandlers[0],
+		new(ImageMirrorHandler).WithProfiles(s.options.Profiles),
+		new(TesseractHandler).WithProfiles(s.options.Profiles),
 		new(MergeHandler),
 		new(AiHandler).WithFileNameGuesser(ai.NewChatGPTFileNameGuesser(aiInstance)).WithFileTagsGuesser(ai.NewChatGPTFileTagsGuesser(aiInstance)),
-		new(PaperlessUploadHandler).WithPaperless(paperless.NewPaperless(s.options.PaperlessUrl, s.options.PaperlessToken)),
-	})
+		new(PaperlessUploadHandler).WithPaperless(paperless.NewPaperless(s.options.PaperlessUrl, s.options.PaperlessToken)).WithProfiles(s.options.Profiles),
+	}).WithWriterFactory(s.writerFactory).
+		WithStages(s.options.QueueOptions.Stages).
+		WithConflictPolicy(s.options.MetadataConflictPolicy)
+	for _, scanHandler := range scanHandlers[1:] {
+		s.daemon.AddSource(scanHandler)
+	}
+	s.scanHandlers = scanHandlers
+	for _, watchFolder := range s.options.WatchFolders {
+		s.watchers = append(s.watchers, ingest.NewWatcher(watchFolder, s.ingest))
+	}
+	for _, mailbox := range s.options.Mailboxes {
+		s.mailboxes = append(s.mailboxes, ingest.NewMailbox(mailbox, s.ingest))
+	}
 
-	return s
+	return s, nil
 }
 
-func queueFactory(name string) filequeue.Queue {
-	return filequeue.NewFsQueue(name)
+// validateProfiles checks the profiles and the profile names used by the
+// scan triggers.
+func (s *Server) validateProfiles() error {
+	err := s.options.Profiles.Validate()
+	if err != nil {
+		return err
+	}
+
+	triggers := s.options.ScanOptions.Triggers
+	for _, profile := range triggers.Buttons {
+		if err := s.options.Profiles.Check(profile); err != nil {
+			return err
+		}
+	}
+	for _, schedule := range triggers.Schedule {
+		if err := s.options.Profiles.Check(schedule.Profile); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Server) connectNats() error {
+	var natsOpts []nats.Option
+	if s.options.QueueOptions.Nats.CredsFile != "" {
+		natsOpts = append(natsOpts, nats.UserCredentials(s.options.QueueOptions.Nats.CredsFile))
+	}
+
+	nc, err := nats.Connect(s.options.QueueOptions.Nats.Url, natsOpts...)
+	if err != nil {
+		return err
+	}
+
+	js, err := jetstream.New(nc)
+	if err != nil {
+		nc.Close()
+		return err
+	}
+
+	s.natsConn = nc
+	s.jetStream = js
+	return nil
+}
+
+// createQueues creates the queue between every two stages. Each is named
+// after the stage producing into it.
+func (s *Server) createQueues() error {
+	s.queues = make(map[string]filequeue.Queue)
+	for _, name := range Stages[:len(Stages)-1] {
+		q, err := s.createQueue(name)
+		if err != nil {
+			return fmt.Errorf("queue %s: %w", name, err)
+		}
+		s.queues[name] = q
+	}
+	return nil
+}
+
+func (s *Server) createQueue(name string) (filequeue.Queue, error) {
+	limits, ok := s.options.QueueOptions.Limits[name]
+	if !ok {
+		limits = s.options.QueueOptions.DefaultLimits
+	}
+
+	if s.jetStream != nil {
+		q, err := filequeue.NewNatsQueue(s.jetStream, name, s.options.QueueOptions.Nats.LeaseTime)
+		if err != nil {
+			return nil, err
+		}
+		return q.WithLimits(limits).WithCipher(s.cipher), nil
+	}
+
+	return filequeue.NewFsQueue(name).
+		WithLimits(limits).
+		WithCipher(s.cipher).
+		WithArchive(s.options.QueueOptions.Archive[name]), nil
+}
+
+// queueFactory hands the queues created by NewServer to the daemon.
+func (s *Server) queueFactory(name string) filequeue.Queue {
+	return s.queues[name]
+}
+
+// TriggerScan requests a scan on the scanner with the given device name, or
+// on the first scanner if device is empty.
+func (s *Server) TriggerScan(device string, trigger scan.Trigger) error {
+	if len(s.triggers) == 0 {
+		return errors.New("scanners scan continuously, no triggers are configured")
+	}
+	err := s.options.Profiles.Check(trigger.Profile)
+	if err != nil {
+		return err
+	}
+
+	for i, scanner := range s.scanners {
+		if device == "" || scanner.Device() == device {
+			return s.triggers[i].Fire(trigger)
+		}
+	}
+	return fmt.Errorf("%w: %s", scan.ErrDeviceNotFound, device)
+}
+
+// ScannerStatus reports the condition of every scanner.
+func (s *Server) ScannerStatus() []ScannerStatus {
+	statuses := make([]ScannerStatus, len(s.scanHandlers))
+	for i, scanHandler := range s.scanHandlers {
+		statuses[i] = scanHandler.Status()
+	}
+	return statuses
+}
+
+func (s *Server) writerFactory() queueoutputcreator.QueueZipFileWriter {
+	if s.options.BundleFormat == "dir" {
+		return queueoutputcreator.CreateDirWriter(s.cipher)
+	}
+	return queueoutputcreator.CreateEncryptedZipFileWriter(s.cipher)
 }
 
 func (s *Server) Start() error {
+	// workspaces of crashed runs are not cleaned up by their jobs
+	removed, err := workspace.Sweep()
+	if err != nil {
+		log.WithError(err).Warn("Failed to remove orphaned workspaces")
+	}
+	if removed > 0 {
+		log.WithField("count", removed).WithField("dir", workspace.Root()).Info("Removed orphaned workspaces")
+	}
+
+	var archivedQueues []*filequeue.FsQueue
+	for _, q := range s.queues {
+		if fsQueue, ok := q.(*filequeue.FsQueue); ok {
+			archivedQueues = append(archivedQueues, fsQueue)
+		}
+	}
+	s.stopPrune = make(chan struct{})
+	s.wgPrune.Add(1)
+	go func() {
+		defer s.wgPrune.Done()
+		filequeue.PruneArchives(archivedQueues, archivePruneInterval, s.stopPrune)
+	}()
+
+	for _, triggers := range s.triggers {
+		triggers.Start()
+	}
 	s.daemon.Start()
+	for _, watcher := range s.watchers {
+		err := watcher.Start()
+		if err != nil {
+			return err
+		}
+	}
+	for _, mailbox := range s.mailboxes {
+		mailbox.Start()
+	}
+
+	if s.options.Http.Addr != nil && *s.options.Http.Addr != "" {
+		s.http = &http.Server{Addr: *s.options.Http.Addr, Handler: s.httpHandler()}
+		go func() {
+			err := s.http.ListenAndServe()
+			if err != nil && err != http.ErrServerClosed {
+				log.WithError(err).Error("Http server failed")
+			}
+		}()
+	}
 	return nil
 }
 
 func (s *Server) Stop() error {
+	if s.http != nil {
+		s.http.Close()
+	}
+	for _, watcher := range s.watchers {
+		watcher.Stop()
+	}
+	for _, mailbox := range s.mailboxes {
+		mailbox.Stop()
+	}
+	for _, triggers := range s.triggers {
+		triggers.Stop()
+	}
 	s.daemon.Stop()
+	if s.stopPrune != nil {
+		close(s.stopPrune)
+		s.wgPrune.Wait()
+		s.stopPrune = nil
+	}
+	if s.natsConn != nil {
+		s.natsConn.Close()
+	}
 	return nil
 }
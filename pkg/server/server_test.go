@@ -0,0 +1,57 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	natsserver "github.com/nats-io/nats-server/v2/server"
+	"github.com/schidstorm/scanner-tool/pkg/filequeue"
+	"github.com/schidstorm/scanner-tool/pkg/scan"
+	"github.com/stretchr/testify/assert"
+)
+
+func simulatedOptions() Options {
+	return Options{
+		ScanOptions:  scan.Options{Devices: []scan.DeviceSelector{{Driver: scan.DriverSimulated}}},
+		PaperlessUrl: "http://paperless.local",
+	}
+}
+
+func TestStagesMatchPipeline(t *testing.T) {
+	s, err := NewServer(simulatedOptions())
+	assert.NoError(t, err)
+	assert.Equal(t, Stages, s.daemon.StageNames())
+
+	queueName, err := InputQueueName("TesseractHandler")
+	assert.NoError(t, err)
+	assert.Equal(t, "ImageMirrorHandler", queueName)
+	_, err = InputQueueName("ScanHandler")
+	assert.Error(t, err)
+	_, err = InputQueueName("OcrHandler")
+	assert.Error(t, err)
+}
+
+func TestNewServerRejectsArchiveWithNats(t *testing.T) {
+	opts := simulatedOptions()
+	opts.QueueOptions.Backend = "nats"
+	opts.QueueOptions.Archive = map[string]filequeue.ArchiveOptions{"ScanHandler": {}}
+	_, err := NewServer(opts)
+	assert.ErrorContains(t, err, "archive")
+}
+
+func TestNewServerReportsQueueErrors(t *testing.T) {
+	// without JetStream no queue can be created
+	ns, err := natsserver.NewServer(&natsserver.Options{Host: "127.0.0.1", Port: -1})
+	assert.NoError(t, err)
+	go ns.Start()
+	if !ns.ReadyForConnections(10 * time.Second) {
+		t.Fatal("nats server did not start")
+	}
+	t.Cleanup(ns.Shutdown)
+
+	opts := simulatedOptions()
+	opts.QueueOptions.Backend = "nats"
+	opts.QueueOptions.Nats.Url = ns.ClientURL()
+	_, err = NewServer(opts)
+	assert.ErrorContains(t, err, "queue ScanHandler")
+}
@@ -1,6 +1,11 @@
 package server
 
 import (
+	"bytes"
+	"io"
+	"path"
+	"regexp"
+	"slices"
 	"strings"
 
 	queueoutputcreator "github.com/schidstorm/scanner-tool/pkg/queue_output_creator"
@@ -8,21 +13,74 @@ import (
 	"github.com/sirupsen/logrus"
 )
 
+// coverSheetMarker is the line on a cover sheet that selects a profile, e.g.
+// "Scan profile: receipts".
+var coverSheetMarker = regexp.MustCompile(`(?im)^\s*scan\s*profile\s*:\s*([\w-]+)\s*$`)
+
 type TesseractHandler struct {
+	profiles Profiles
+}
+
+// WithProfiles sets the OCR languages per profile and lets a cover sheet in
+// front of the pages select the profile.
+func (t *TesseractHandler) WithProfiles(profiles Profiles) *TesseractHandler {
+	t.profiles = profiles
+	return t
 }
 
 func (t *TesseractHandler) Run(logger *logrus.Logger, input chan InputFile, outputFiles queueoutputcreator.QueueZipFileWriter) (resErr error) {
+	profile := manifestProfile(t.profiles, outputFiles.Manifest())
+	languages := profile.OcrLanguages
+	firstPage := true
+	mirrored := slices.ContainsFunc(outputFiles.Manifest().History, func(record queueoutputcreator.StageRecord) bool {
+		return record.Stage == "ImageMirrorHandler"
+	})
+	// turn is set when a cover sheet selects a profile with another
+	// rotation than the one the scanned pages were mirrored with
+	turn := false
 	for f := range input {
-		text, err := fileToText(f)
+		// documents that are ingested as searchable PDFs need no OCR
+		if f.Entry().Kind == queueoutputcreator.KindDocument {
+			err := copyInputFile(f, f.FileInfo().Name(), outputFiles)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		open := f.Open
+		if turn {
+			var page bytes.Buffer
+			err := mirrorPage(f, &page)
+			if err != nil {
+				return err
+			}
+			open = func() (io.ReadCloser, error) {
+				return io.NopCloser(bytes.NewReader(page.Bytes())), nil
+			}
+		}
+
+		text, err := pageToText(open, languages)
 		if err != nil {
 			return err
 		}
 
+		if firstPage {
+			firstPage = false
+			if name, ok := t.coverSheetProfile(text); ok {
+				logger.WithField("profile", name).Info("Found cover sheet, dropping it")
+				replaceProfile(outputFiles.Manifest(), profile, name, t.profiles[name])
+				languages = t.profiles[name].OcrLanguages
+				turn = mirrored && t.profiles[name].rotation() != profile.rotation()
+				continue
+			}
+		}
+
 		if strings.Trim(text, " \n") == "" {
 			continue
 		}
 
-		err = fileToPdf(f, outputFiles)
+		err = pageToPdf(open, pdfFileName(f.FileInfo().Name()), languages, outputFiles)
 		if err != nil {
 			return err
 		}
@@ -31,30 +89,46 @@ func (t *TesseractHandler) Run(logger *logrus.Logger, input chan InputFile, outp
 	return nil
 }
 
-func fileToText(zipFile InputFile) (string, error) {
-	fileHandle, err := zipFile.Open()
+// coverSheetProfile finds the marker of a configured profile in the text of
+// a page.
+func (t *TesseractHandler) coverSheetProfile(text string) (string, bool) {
+	match := coverSheetMarker.FindStringSubmatch(text)
+	if match == nil {
+		return "", false
+	}
+
+	for name := range t.profiles {
+		if strings.EqualFold(name, match[1]) {
+			return name, true
+		}
+	}
+	return "", false
+}
+
+func pageToText(open func() (io.ReadCloser, error), languages []string) (string, error) {
+	fileHandle, err := open()
 	if err != nil {
 		return "", err
 	}
 	defer fileHandle.Close()
 
-	return tesseract.ConvertImageToText(fileHandle)
+	return tesseract.ConvertImageToText(fileHandle, languages...)
 }
 
-func fileToPdf(zipFile InputFile, outputFiles queueoutputcreator.QueueZipFileWriter) error {
-	fileHandle, err := zipFile.Open()
+func pageToPdf(open func() (io.ReadCloser, error), fileName string, languages []string, outputFiles queueoutputcreator.QueueZipFileWriter) error {
+	fileHandle, err := open()
 	if err != nil {
 		return err
 	}
 	defer fileHandle.Close()
 
-	pdfWriter := outputFiles.OpenFile(pdfFileName(zipFile.FileInfo().Name()))
+	pdfWriter := outputFiles.OpenFile(fileName)
 
-	return tesseract.ConvertImageToPdf(fileHandle, pdfWriter)
+	return tesseract.ConvertImageToPdf(fileHandle, pdfWriter, languages...)
 }
 
 func pdfFileName(fileName string) string {
-	return strings.TrimSuffix(fileName, ".png") + ".pdf"
+	return strings.TrimSuffix(fileName, path.Ext(fileName)) + ".pdf"
 }
 
 func (t *TesseractHandler) Close() error {
@@ -1,37 +1,47 @@
 package server
 
 import (
-	"os"
 	"testing"
 
-	"github.com/schidstorm/scanner-tool/pkg/filequeue"
 	queueoutputcreator "github.com/schidstorm/scanner-tool/pkg/queue_output_creator"
+	"github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
 )
 
 func prepareHandlerThings(t *testing.T, inoutFiles map[string][]byte, h func(input chan InputFile, outputFiles queueoutputcreator.QueueZipFileWriter) error) map[string][]byte {
-	creator := queueoutputcreator.CreateZipFileWriter()
-
+	creator := queueoutputcreator.CreateMemZipFileCreator()
 	for fileName, data := range inoutFiles {
 		creator.AddFile(fileName, data)
 	}
 
-	zipFilePath, err := creator.Finalize()
-	assert.NoError(t, err)
-	defer os.Remove(zipFilePath)
-	zipData, err := os.ReadFile(zipFilePath)
-	assert.NoError(t, err)
+	outputZipCreator := runHandlerFunc(t, creator, h)
+	assert.Equal(t, 1, len(outputZipCreator.Files()))
+
+	result := make(map[string][]byte)
+	for fileName, buf := range outputZipCreator.Files() {
+		result[fileName] = buf.Bytes()
+	}
+	return result
+}
 
-	inputZipFile := &filequeue.MemQueryFile{
-		Name: "test.zip",
-		Data: zipData,
+// runHandlerChain feeds input through handlers like the daemon does, but
+// entirely in memory. The output of every handler is the input of the next.
+func runHandlerChain(t *testing.T, input *queueoutputcreator.MemZipFileCreator, handlers ...DaemonHandler) *queueoutputcreator.MemZipFileCreator {
+	for _, handler := range handlers {
+		input = runHandlerFunc(t, input, func(inputFiles chan InputFile, outputFiles queueoutputcreator.QueueZipFileWriter) error {
+			return handler.Run(logrus.New(), inputFiles, outputFiles)
+		})
 	}
+	return input
+}
+
+func runHandlerFunc(t *testing.T, input *queueoutputcreator.MemZipFileCreator, h func(input chan InputFile, outputFiles queueoutputcreator.QueueZipFileWriter) error) *queueoutputcreator.MemZipFileCreator {
+	zipReader, err := input.Reader()
+	assert.NoError(t, err)
 
 	inputFiles := make(chan InputFile)
 	go func() {
 		defer close(inputFiles)
-		zipReader, err := queueoutputcreator.CreateZipFileReader(inputZipFile)
-		assert.NoError(t, err)
 		for _, fileName := range zipReader.FileNames() {
 			file, err := zipReader.GetFile(fileName)
 			assert.NoError(t, err)
@@ -39,17 +49,16 @@ func prepareHandlerThings(t *testing.T, inoutFiles map[string][]byte, h func(inp
 		}
 	}()
 
-	outputZipCreator := queueoutputcreator.CreateMemZipFileCreator()
-
-	err = h(inputFiles, outputZipCreator)
-	assert.NoError(t, err)
+	output := queueoutputcreator.CreateMemZipFileCreator()
+	continueManifest(zipReader.Manifest(), output.Manifest())
+	queueoutputcreator.InheritMetadata(zipReader.Manifest(), output.Manifest(), queueoutputcreator.ConflictFirst)
 
+	err = h(inputFiles, output)
+	for range inputFiles {
+	}
 	assert.NoError(t, err)
-	assert.Equal(t, 1, len(outputZipCreator.Files()))
+	assert.NoError(t, output.Error())
 
-	result := make(map[string][]byte)
-	for fileName, buf := range outputZipCreator.Files() {
-		result[fileName] = buf.Bytes()
-	}
-	return result
+	queueoutputcreator.InheritFileMetadata(zipReader.Manifest(), output.Manifest(), queueoutputcreator.ConflictFirst)
+	return output
 }
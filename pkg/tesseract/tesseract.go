@@ -5,13 +5,16 @@ import (
 	"errors"
 	"io"
 	"os/exec"
+	"strings"
 
 	"github.com/sirupsen/logrus"
 )
 
-func ConvertImageToPdf(inputImage io.Reader, output io.Writer) error {
+// ConvertImageToPdf runs OCR with the given languages, e.g. "deu", or with
+// the tesseract default if none are given.
+func ConvertImageToPdf(inputImage io.Reader, output io.Writer, languages ...string) error {
 	logrus.Info("Converting image to pdf")
-	cmd := exec.Command("tesseract", "-", "-", "pdf")
+	cmd := exec.Command("tesseract", append(languageArgs(languages), "pdf")...)
 	cmd.Stdin = inputImage
 	cmd.Stdout = output
 	errorBuffer := &bytes.Buffer{}
@@ -25,9 +28,9 @@ func ConvertImageToPdf(inputImage io.Reader, output io.Writer) error {
 	return nil
 }
 
-func ConvertImageToText(inputImage io.Reader) (string, error) {
+func ConvertImageToText(inputImage io.Reader, languages ...string) (string, error) {
 	logrus.Info("Converting image to text")
-	cmd := exec.Command("tesseract", "-", "-")
+	cmd := exec.Command("tesseract", languageArgs(languages)...)
 	cmd.Stdin = inputImage
 	outputBuffer := &bytes.Buffer{}
 	cmd.Stdout = outputBuffer
@@ -41,3 +44,11 @@ func ConvertImageToText(inputImage io.Reader) (string, error) {
 
 	return outputBuffer.String(), nil
 }
+
+func languageArgs(languages []string) []string {
+	args := []string{"-", "-"}
+	if len(languages) > 0 {
+		args = append(args, "-l", strings.Join(languages, "+"))
+	}
+	return args
+}
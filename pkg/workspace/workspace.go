@@ -0,0 +1,233 @@
+package workspace
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const lockSuffix = ".lock"
+
+// root holds the working directories and temporary files of all jobs. It
+// should be on the filesystem of the queue, finished bundles are moved
+// into the queue.
+var root = filepath.Join(os.TempDir(), "scanner-tool-work")
+
+// instance tells the files of this process apart from those of earlier
+// processes. Process ids repeat, e.g. every container runs as pid 1.
+var instance = fmt.Sprintf("%d.%s", os.Getpid(), strconv.FormatInt(time.Now().UnixNano(), 36))
+
+var (
+	lockMutex sync.Mutex
+	// locks are held open while the process lives, they mark the files of
+	// the instance as in use.
+	locks = make(map[string]*os.File)
+)
+
+func SetRoot(dir string) {
+	lockMutex.Lock()
+	defer lockMutex.Unlock()
+	root = dir
+}
+
+func Root() string {
+	lockMutex.Lock()
+	defer lockMutex.Unlock()
+	return root
+}
+
+// Workspace is the working directory of a single job, e.g. a scan or a
+// merge.
+type Workspace struct {
+	dir string
+}
+
+// New creates a workspace. kind names the job, it must not contain "-".
+func New(kind string) (*Workspace, error) {
+	dir, err := prepareRoot()
+	if err != nil {
+		return nil, err
+	}
+
+	dir, err = os.MkdirTemp(dir, pattern(kind, ""))
+	if err != nil {
+		return nil, err
+	}
+	return &Workspace{dir: dir}, nil
+}
+
+// Reuse creates the workspace of a job that is retried, e.g. the merge of a
+// bundle. The workspace an earlier attempt kept is replaced, so failed
+// attempts do not pile up. id is part of the name, e.g. the bundle ID.
+func Reuse(kind string, id string) (*Workspace, error) {
+	if id == "" || id != filepath.Base(id) || strings.HasPrefix(id, ".") {
+		return nil, fmt.Errorf("invalid workspace id %q", id)
+	}
+
+	dir, err := prepareRoot()
+	if err != nil {
+		return nil, err
+	}
+
+	dir = filepath.Join(dir, fmt.Sprintf("%s-%s-%s", kind, instance, id))
+	err = os.RemoveAll(dir)
+	if err != nil {
+		return nil, err
+	}
+	err = os.Mkdir(dir, 0700)
+	if err != nil {
+		return nil, err
+	}
+	return &Workspace{dir: dir}, nil
+}
+
+func (w *Workspace) Dir() string {
+	return w.dir
+}
+
+// Path returns the path of a file in the workspace.
+func (w *Workspace) Path(name string) string {
+	return filepath.Join(w.dir, name)
+}
+
+// Remove deletes the workspace with everything in it.
+func (w *Workspace) Remove() error {
+	return os.RemoveAll(w.dir)
+}
+
+// CreateTemp creates a temporary file next to the workspaces, for files
+// that are moved elsewhere when they are complete.
+func CreateTemp(kind string, ext string) (*os.File, error) {
+	dir, err := prepareRoot()
+	if err != nil {
+		return nil, err
+	}
+	return os.CreateTemp(dir, pattern(kind, ext))
+}
+
+func pattern(kind string, ext string) string {
+	return fmt.Sprintf("%s-%s-*%s", kind, instance, ext)
+}
+
+// prepareRoot creates the root and locks it for the instance before the
+// first file is created in it.
+func prepareRoot() (string, error) {
+	lockMutex.Lock()
+	defer lockMutex.Unlock()
+
+	if locks[root] != nil {
+		return root, nil
+	}
+
+	err := os.MkdirAll(root, 0700)
+	if err != nil {
+		return "", err
+	}
+
+	// the lock is taken before the file gets a name Sweep looks at
+	lockFile, err := os.CreateTemp(root, ".lock-*")
+	if err != nil {
+		return "", err
+	}
+	err = syscall.Flock(int(lockFile.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+	if err == nil {
+		err = os.Rename(lockFile.Name(), filepath.Join(root, instance+lockSuffix))
+	}
+	if err != nil {
+		lockFile.Close()
+		os.Remove(lockFile.Name())
+		return "", err
+	}
+
+	locks[root] = lockFile
+	return root, nil
+}
+
+// Sweep removes the workspaces and temporary files of processes that are
+// gone. It runs on startup, other processes may share the root.
+func Sweep() (int, error) {
+	dir := Root()
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	owned := make(map[string][]string)
+	for _, entry := range entries {
+		owner, ok := owner(entry.Name())
+		if ok && owner != instance {
+			owned[owner] = append(owned[owner], entry.Name())
+		}
+	}
+
+	removed := 0
+	var sweepErr error
+	for owner, names := range owned {
+		lockFile, alive := lockOwner(filepath.Join(dir, owner+lockSuffix))
+		if alive {
+			continue
+		}
+
+		for _, name := range names {
+			if strings.HasSuffix(name, lockSuffix) {
+				continue
+			}
+			err = os.RemoveAll(filepath.Join(dir, name))
+			if err != nil {
+				sweepErr = errors.Join(sweepErr, err)
+				continue
+			}
+			logrus.WithField("path", name).Debug("Removed orphaned workspace")
+			removed++
+		}
+		if lockFile != nil {
+			os.Remove(lockFile.Name())
+			lockFile.Close()
+		}
+	}
+	return removed, sweepErr
+}
+
+// lockOwner takes the lock of an instance. It fails while the instance
+// lives. The returned file holds the lock, it is nil if there is no lock.
+func lockOwner(lockPath string) (*os.File, bool) {
+	lockFile, err := os.Open(lockPath)
+	if err != nil {
+		return nil, false
+	}
+
+	err = syscall.Flock(int(lockFile.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+	if err != nil {
+		lockFile.Close()
+		return nil, true
+	}
+	return lockFile, false
+}
+
+// owner parses the instance out of names like "scan-1234.abc-567890" and
+// "1234.abc.lock".
+func owner(name string) (string, bool) {
+	if strings.HasPrefix(name, ".") {
+		return "", false
+	}
+	if instance, ok := strings.CutSuffix(name, lockSuffix); ok {
+		return instance, true
+	}
+
+	parts := strings.SplitN(name, "-", 3)
+	if len(parts) != 3 || parts[1] == "" {
+		return "", false
+	}
+	return parts[1], true
+}
@@ -0,0 +1,109 @@
+package workspace
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWorkspace(t *testing.T) {
+	SetRoot(t.TempDir())
+
+	first, err := New("scan")
+	assert.NoError(t, err)
+	second, err := New("scan")
+	assert.NoError(t, err)
+	assert.NotEqual(t, first.Dir(), second.Dir())
+	assert.Equal(t, Root(), filepath.Dir(first.Dir()))
+
+	assert.NoError(t, os.WriteFile(first.Path("scan-001.png"), []byte("page"), 0644))
+	assert.NoError(t, first.Remove())
+	_, err = os.Stat(first.Dir())
+	assert.True(t, os.IsNotExist(err))
+	assert.DirExists(t, second.Dir())
+
+	tmpFile, err := CreateTemp("bundle", ".zip")
+	assert.NoError(t, err)
+	tmpFile.Close()
+	assert.Equal(t, ".zip", filepath.Ext(tmpFile.Name()))
+	assert.FileExists(t, filepath.Join(Root(), instance+lockSuffix))
+}
+
+func TestReuse(t *testing.T) {
+	SetRoot(t.TempDir())
+
+	first, err := Reuse("merge", "bundle1")
+	assert.NoError(t, err)
+	assert.NoError(t, os.WriteFile(first.Path("merged.pdf"), []byte("pdf"), 0644))
+
+	// the retry starts empty in the same place
+	second, err := Reuse("merge", "bundle1")
+	assert.NoError(t, err)
+	assert.Equal(t, first.Dir(), second.Dir())
+	assert.NoFileExists(t, second.Path("merged.pdf"))
+	owner, ok := owner(filepath.Base(second.Dir()))
+	assert.True(t, ok)
+	assert.Equal(t, instance, owner)
+
+	other, err := Reuse("merge", "bundle-2")
+	assert.NoError(t, err)
+	assert.NotEqual(t, first.Dir(), other.Dir())
+
+	_, err = Reuse("merge", "../escape")
+	assert.Error(t, err)
+	_, err = Reuse("merge", "")
+	assert.Error(t, err)
+}
+
+func TestSweep(t *testing.T) {
+	SetRoot(t.TempDir())
+
+	own, err := New("merge")
+	assert.NoError(t, err)
+
+	// an instance that crashed, its lock is free
+	assert.NoError(t, os.WriteFile(filepath.Join(Root(), "1.dead"+lockSuffix), nil, 0600))
+	assert.NoError(t, os.MkdirAll(filepath.Join(Root(), "scan-1.dead-123", "nested"), 0700))
+	assert.NoError(t, os.WriteFile(filepath.Join(Root(), "bundle-1.dead-456.zip"), nil, 0600))
+	// an instance without a lock file is gone as well
+	assert.NoError(t, os.Mkdir(filepath.Join(Root(), "scan-2.gone-789"), 0700))
+
+	// an instance that still runs
+	assert.NoError(t, os.WriteFile(filepath.Join(Root(), "3.alive"+lockSuffix), nil, 0600))
+	lockFile, err := os.Open(filepath.Join(Root(), "3.alive"+lockSuffix))
+	assert.NoError(t, err)
+	defer lockFile.Close()
+	assert.NoError(t, syscall.Flock(int(lockFile.Fd()), syscall.LOCK_EX|syscall.LOCK_NB))
+	assert.NoError(t, os.Mkdir(filepath.Join(Root(), "scan-3.alive-123"), 0700))
+
+	assert.NoError(t, os.Mkdir(filepath.Join(Root(), "unrelated"), 0700))
+
+	removed, err := Sweep()
+	assert.NoError(t, err)
+	assert.Equal(t, 3, removed)
+
+	entries, err := os.ReadDir(Root())
+	assert.NoError(t, err)
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	assert.ElementsMatch(t, []string{
+		filepath.Base(own.Dir()),
+		instance + lockSuffix,
+		"3.alive" + lockSuffix,
+		"scan-3.alive-123",
+		"unrelated",
+	}, names)
+}
+
+func TestSweepWithoutRoot(t *testing.T) {
+	SetRoot(filepath.Join(t.TempDir(), "missing"))
+
+	removed, err := Sweep()
+	assert.NoError(t, err)
+	assert.Zero(t, removed)
+}